@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	recipedb "github.com/jacksonopp/go-recipe/db"
 	"github.com/jacksonopp/go-recipe/domain"
 	"github.com/jacksonopp/go-recipe/handlers"
+	"github.com/jacksonopp/go-recipe/platform/authenticator"
+	"github.com/jacksonopp/go-recipe/platform/mailer"
 	"github.com/jacksonopp/go-recipe/services"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -27,15 +31,40 @@ func main() {
 		log.Panicf("failed to create minio client %v", err)
 	}
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		// bodies are streamed so that account archives, which can include every
+		// file a user has uploaded, do not have to fit under the body limit;
+		// BodyLimitMiddleware holds every other route to it
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	})
 	app.Use(logger.New())
+	app.Use(handlers.BodyLimitMiddleware(fiber.DefaultBodyLimit, handlers.ARCHIVE_IMPORT_PATH))
 	api := app.Group("/api")
 
-	authHandler := handlers.NewAuthHandler(api, db)
+	auth, err := authenticator.New(context.Background(), authenticator.ConfigFromEnv())
+	if err != nil {
+		// the rest of the api works without single sign-on
+		log.Printf("WARNING: OIDC sign in disabled: %v", err)
+		auth = nil
+	}
+
+	mail, err := mailer.New(mailer.ConfigFromEnv())
+	if err != nil {
+		log.Panicf("failed to create mailer %v", err)
+	}
+
+	authHandler := handlers.NewAuthHandler(api, db, auth, mail, os.Getenv("APP_URL"))
 	recipeHandler := handlers.NewRecipeHandler(api, db)
-	userHandler := handlers.NewUserHandler(api, db)
+	userHandler := handlers.NewUserHandler(api, minioClient, db)
 	tagHandler := handlers.NewTagHandler(api, db)
 	fileHandler := handlers.NewFileHandler(api, minioClient, db)
+	collectionHandler := handlers.NewCollectionHandler(api, db)
+	commentHandler := handlers.NewCommentHandler(api, db)
+	feedHandler := handlers.NewFeedHandler(api, db)
+	mealPlanHandler := handlers.NewMealPlanHandler(api, db)
+	shoppingListHandler := handlers.NewShoppingListHandler(api, db)
+	pantryHandler := handlers.NewPantryHandler(api, db)
 
 	createApiRoutes(
 		authHandler,
@@ -43,6 +72,12 @@ func main() {
 		userHandler,
 		tagHandler,
 		fileHandler,
+		collectionHandler,
+		commentHandler,
+		feedHandler,
+		mealPlanHandler,
+		shoppingListHandler,
+		pantryHandler,
 	)
 
 	sessionService := services.NewSessionService(db)
@@ -55,6 +90,15 @@ func main() {
 		}
 	}()
 
+	publishService := services.NewPublishService(db)
+
+	go func() {
+		_, err := publishService.PublishOnSchedule(time.Minute)
+		if err != nil {
+			log.Printf("ERROR: failed to start publish job %v", err)
+		}
+	}()
+
 	app.Get("/", func(c *fiber.Ctx) error {
 		log.Println("request to /")
 
@@ -88,6 +132,11 @@ func createDb() (*gorm.DB, error) {
 		return nil, err
 	}
 
+	err = recipedb.DropUniqueEmailIndex(db)
+	if err != nil {
+		return nil, err
+	}
+
 	err = db.AutoMigrate(
 		&domain.User{},
 		&domain.Session{},
@@ -96,11 +145,45 @@ func createDb() (*gorm.DB, error) {
 		&domain.Instruction{},
 		&domain.Tag{},
 		&domain.File{},
+		&domain.RecipeSearchDocument{},
+		&domain.RecipeVersion{},
+		&domain.RecipeShare{},
+		&domain.Collection{},
+		&domain.CollectionRecipe{},
+		&domain.Favorite{},
+		&domain.Review{},
+		&domain.Comment{},
+		&domain.Follow{},
+		&domain.MealPlanEntry{},
+		&domain.ShoppingList{},
+		&domain.ShoppingListItem{},
+		&domain.ShoppingListMember{},
+		&domain.PantryItem{},
+		&domain.UserIdentity{},
+		&domain.OIDCLogin{},
+		&domain.APIToken{},
+		&domain.PasswordReset{},
+		&domain.EmailVerification{},
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	err = recipedb.BackfillIngredients(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = services.NewSearchService(db).IndexMissing()
+	if err != nil {
+		return nil, err
+	}
+
+	err = services.RecordMissingVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+)
+
+// BackfillIngredients parses the quantity and unit of ingredients that were
+// created before ingredients had structured amounts and units.
+//
+// Ingredients whose quantity and unit cannot be parsed are checked again every
+// time this runs, which is cheap enough to do on startup.
+func BackfillIngredients(tx *gorm.DB) error {
+	var ingredients []domain.Ingredient
+	updated := 0
+	update := tx.Session(&gorm.Session{NewDB: true})
+
+	err := tx.
+		// canonical_unit is NULL rather than empty on rows from before it was added
+		Where("amount IS NULL AND COALESCE(canonical_unit, '') = ''").
+		Where("quantity <> '' OR unit <> ''").
+		FindInBatches(&ingredients, 500, func(_ *gorm.DB, _ int) error {
+			for _, ingredient := range ingredients {
+				ingredient.Parse()
+				if ingredient.Amount == nil && ingredient.CanonicalUnit == "" {
+					continue
+				}
+
+				err := update.Model(&domain.Ingredient{}).
+					Where("id = ?", ingredient.ID).
+					UpdateColumns(map[string]any{
+						"amount":         ingredient.Amount,
+						"amount_max":     ingredient.AmountMax,
+						"canonical_unit": ingredient.CanonicalUnit,
+					}).
+					Error
+				if err != nil {
+					return err
+				}
+				updated++
+			}
+			return nil
+		}).
+		Error
+	if err != nil {
+		return err
+	}
+
+	if updated > 0 {
+		log.Printf("backfilled %d ingredients", updated)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestBackfillIngredients(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn, DriverName: "postgres"}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rows from before the migration have NULL in the columns it added
+	columns := []string{"id", "name", "quantity", "unit", "amount", "amount_max", "canonical_unit", "recipe_id"}
+	mock.ExpectQuery(`SELECT \* FROM "ingredients" WHERE \(amount IS NULL AND COALESCE\(canonical_unit, ''\) = ''\)`).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "milk", "1 1/2", "cups", nil, nil, nil, 1).
+			AddRow(2, "salt", "a pinch", "", nil, nil, nil, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "ingredients" SET`).
+		WithArgs(1.5, nil, "cup", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err = BackfillIngredients(db); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
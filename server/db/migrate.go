@@ -0,0 +1,28 @@
+package db
+
+import (
+	"gorm.io/gorm"
+	"log"
+)
+
+// DropUniqueEmailIndex drops the unique index on users' email addresses from
+// before only verified addresses had to be unique. It has to run before
+// AutoMigrate, which then adds the index back without the constraint.
+func DropUniqueEmailIndex(tx *gorm.DB) error {
+	var unique int64
+	err := tx.Raw(
+		"SELECT count(*) FROM pg_indexes WHERE tablename = 'users' AND indexname = 'idx_users_email' AND indexdef LIKE 'CREATE UNIQUE INDEX%'",
+	).Scan(&unique).Error
+	if err != nil {
+		return err
+	}
+	if unique == 0 {
+		return nil
+	}
+
+	if err = tx.Exec("DROP INDEX idx_users_email").Error; err != nil {
+		return err
+	}
+	log.Println("dropped unique index on users' email addresses")
+	return nil
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestDropUniqueEmailIndex(t *testing.T) {
+	tests := map[string]struct {
+		unique  int
+		dropped bool
+	}{
+		"unique index":     {1, true},
+		"already migrated": {0, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conn, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn, DriverName: "postgres"}), &gorm.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mock.ExpectQuery(`SELECT count\(\*\) FROM pg_indexes WHERE tablename = 'users' AND indexname = 'idx_users_email'`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.unique))
+			if tt.dropped {
+				mock.ExpectExec(`DROP INDEX idx_users_email`).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+
+			if err = DropUniqueEmailIndex(db); err != nil {
+				t.Fatal(err)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
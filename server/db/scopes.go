@@ -6,18 +6,25 @@ import (
 
 func Paginate(page, limit int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		if page <= 0 {
-			page = 1
-		}
-
-		switch {
-		case limit > 100:
-			limit = 100
-		case limit <= 0:
-			limit = 10
-		}
+		page, limit = PageBounds(page, limit)
 
 		offset := (page - 1) * limit
 		return db.Offset(offset).Limit(limit)
 	}
 }
+
+// PageBounds clamps page and limit to the values Paginate actually uses.
+func PageBounds(page, limit int) (int, int) {
+	if page <= 0 {
+		page = 1
+	}
+
+	switch {
+	case limit > 100:
+		limit = 100
+	case limit <= 0:
+		limit = 10
+	}
+
+	return page, limit
+}
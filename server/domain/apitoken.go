@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"net/http"
+	"time"
+)
+
+// API token scopes.
+const (
+	// TokenScopeRead tokens can only make requests that do not change anything.
+	TokenScopeRead = "read"
+	// TokenScopeWrite tokens can make any request the user can.
+	TokenScopeWrite = "write"
+)
+
+// IsValidTokenScope reports whether scope is one of the API token scopes.
+func IsValidTokenScope(scope string) bool {
+	return scope == TokenScopeRead || scope == TokenScopeWrite
+}
+
+// APIToken is a personal access token a user creates for scripts and
+// integrations. It is sent as a bearer token and authenticates as its user.
+type APIToken struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UserID    uint      `gorm:"not null;index"`
+	Name      string    `gorm:"not null"`
+	Scope     string    `gorm:"not null;default:read"`
+	// TokenHash is the SHA-256 of the token; the token itself is only shown once.
+	TokenHash string `gorm:"not null;uniqueIndex"`
+	// Prefix is the start of the token, so users can tell their tokens apart.
+	Prefix     string `gorm:"not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// APITokenDto is a DTO for an APIToken.
+// Token is only set in the response that creates the token.
+type APITokenDto struct {
+	ID         uint       `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Prefix     string     `json:"prefix"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Revoked    bool       `json:"revoked"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// ToDto converts an APIToken to an APITokenDto.
+func (t *APIToken) ToDto() Dto {
+	return APITokenDto{
+		ID:         t.ID,
+		CreatedAt:  t.CreatedAt,
+		Name:       t.Name,
+		Scope:      t.Scope,
+		Prefix:     t.Prefix,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		Revoked:    t.RevokedAt != nil,
+	}
+}
+
+// Active reports whether the token can still be used at time now.
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// Allows reports whether the token's scope allows a request with the given HTTP method.
+// Read tokens are limited to methods that do not change anything.
+func (t *APIToken) Allows(method string) bool {
+	if t.Scope == TokenScopeWrite {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
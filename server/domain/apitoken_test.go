@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPIToken_Active(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := map[string]struct {
+		token  APIToken
+		active bool
+	}{
+		"no expiry":   {APIToken{}, true},
+		"not expired": {APIToken{ExpiresAt: &future}, true},
+		"expired":     {APIToken{ExpiresAt: &past}, false},
+		"revoked":     {APIToken{RevokedAt: &past}, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.token.Active(now); got != tt.active {
+				t.Errorf("expected %v, got %v", tt.active, got)
+			}
+		})
+	}
+}
+
+func TestAPIToken_Allows(t *testing.T) {
+	tests := []struct {
+		scope   string
+		method  string
+		allowed bool
+	}{
+		{TokenScopeRead, "GET", true},
+		{TokenScopeRead, "HEAD", true},
+		{TokenScopeRead, "POST", false},
+		{TokenScopeRead, "PATCH", false},
+		{TokenScopeRead, "DELETE", false},
+		{TokenScopeWrite, "GET", true},
+		{TokenScopeWrite, "POST", true},
+		{TokenScopeWrite, "DELETE", true},
+	}
+
+	for _, tt := range tests {
+		token := APIToken{Scope: tt.scope}
+		if got := token.Allows(tt.method); got != tt.allowed {
+			t.Errorf("%s token, %s: expected %v, got %v", tt.scope, tt.method, tt.allowed, got)
+		}
+	}
+}
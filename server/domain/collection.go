@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Collection is a user's ordered list of recipes, e.g. "Weeknight dinners".
+// It can include other users' public recipes.
+type Collection struct {
+	gorm.Model
+	Name        string `gorm:"not null"`
+	Description string
+	UserID      uint               `gorm:"not null;index"`
+	Visibility  string             `gorm:"not null;default:private"`
+	Recipes     []CollectionRecipe `gorm:"foreignKey:CollectionID"`
+}
+
+// CollectionRecipe places a Recipe in a Collection. Positions start at 1.
+type CollectionRecipe struct {
+	CollectionID uint `gorm:"primaryKey;autoIncrement:false"`
+	RecipeID     uint `gorm:"primaryKey;autoIncrement:false"`
+	Position     int  `gorm:"not null"`
+	CreatedAt    time.Time
+	Recipe       Recipe `gorm:"foreignKey:RecipeID"`
+}
+
+// CollectionDto is a DTO for a Collection.
+// Recipes is left out when collections are listed.
+type CollectionDto struct {
+	ID          uint         `json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	UserID      uint         `json:"user"`
+	Visibility  string       `json:"visibility"`
+	Recipes     *[]RecipeDto `json:"recipes,omitempty"`
+}
+
+// ToDto converts a Collection to a CollectionDto for an anonymous viewer, with its recipes in order.
+func (c *Collection) ToDto() Dto {
+	return c.ToDtoFor(0)
+}
+
+// ToDtoFor converts a Collection to a CollectionDto for the user with viewerID, with its recipes in order.
+func (c *Collection) ToDtoFor(viewerID uint) Dto {
+	var recipes *[]RecipeDto
+	if c.Recipes != nil {
+		dtos := make([]RecipeDto, len(c.Recipes))
+		for i, cr := range c.Recipes {
+			dtos[i] = cr.Recipe.ToDtoFor(viewerID).(RecipeDto)
+		}
+		recipes = &dtos
+	}
+
+	return CollectionDto{
+		ID:          c.ID,
+		CreatedAt:   c.CreatedAt,
+		Name:        c.Name,
+		Description: c.Description,
+		UserID:      c.UserID,
+		Visibility:  c.Visibility,
+		Recipes:     recipes,
+	}
+}
+
+// VisibleTo reports whether the user with viewerID can open the collection.
+func (c *Collection) VisibleTo(viewerID uint) bool {
+	return c.Visibility != VisibilityPrivate || (viewerID != 0 && c.UserID == viewerID)
+}
+
+// ListedFor reports whether the collection should appear in listings shown to viewerID.
+func (c *Collection) ListedFor(viewerID uint) bool {
+	return c.Visibility == VisibilityPublic || (viewerID != 0 && c.UserID == viewerID)
+}
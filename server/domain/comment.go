@@ -0,0 +1,115 @@
+package domain
+
+import "time"
+
+// Comment is a message on a recipe, or on one of its instruction steps when
+// InstructionID is set. Replies point at the comment they answer with ParentID
+// and are always on the same step as their parent.
+//
+// Removed comments are kept so that replies to them stay in their thread; their
+// author and body are hidden from the DTO.
+type Comment struct {
+	ID            uint      `gorm:"primarykey"`
+	CreatedAt     time.Time `gorm:"not null"`
+	UpdatedAt     time.Time `gorm:"not null"`
+	RecipeID      uint      `gorm:"not null;index"`
+	InstructionID *uint     `gorm:"index"`
+	ParentID      *uint     `gorm:"index"`
+	UserID        uint      `gorm:"not null"`
+	Body          string    `gorm:"not null"`
+	// EditedAt is when the author last changed the body, if they have.
+	EditedAt *time.Time
+	// RemovedAt is when the comment was deleted, either by its author or by the
+	// owner of the recipe. RemovedByID is the user who deleted it.
+	RemovedAt   *time.Time
+	RemovedByID *uint
+	// Replies is filled in by BuildCommentThreads.
+	Replies []*Comment `gorm:"-"`
+}
+
+// CommentDto is a DTO for a Comment and its replies.
+type CommentDto struct {
+	ID            uint         `json:"id"`
+	CreatedAt     time.Time    `json:"created_at"`
+	RecipeID      uint         `json:"recipe"`
+	InstructionID *uint        `json:"instruction,omitempty"`
+	ParentID      *uint        `json:"parent,omitempty"`
+	UserID        uint         `json:"user,omitempty"`
+	Body          string       `json:"body"`
+	EditedAt      *time.Time   `json:"edited_at,omitempty"`
+	Removed       bool         `json:"removed"`
+	Replies       []CommentDto `json:"replies"`
+}
+
+// IsRemoved reports whether the comment has been deleted.
+func (c *Comment) IsRemoved() bool {
+	return c.RemovedAt != nil
+}
+
+// ToDto converts a Comment to a CommentDto, along with its replies.
+func (c *Comment) ToDto() Dto {
+	replies := make([]CommentDto, len(c.Replies))
+	for i, reply := range c.Replies {
+		replies[i] = reply.ToDto().(CommentDto)
+	}
+
+	dto := CommentDto{
+		ID:            c.ID,
+		CreatedAt:     c.CreatedAt,
+		RecipeID:      c.RecipeID,
+		InstructionID: c.InstructionID,
+		ParentID:      c.ParentID,
+		UserID:        c.UserID,
+		Body:          c.Body,
+		EditedAt:      c.EditedAt,
+		Removed:       c.IsRemoved(),
+		Replies:       replies,
+	}
+	if dto.Removed {
+		dto.UserID, dto.Body, dto.EditedAt = 0, "", nil
+	}
+	return dto
+}
+
+// BuildCommentThreads arranges comments into threads, returning the top level
+// comments with their replies filled in. Comments keep the order they are given
+// in within each level. Replies whose parent is not in comments are treated as
+// top level comments.
+//
+// Removed comments without any replies left under them are dropped, since there
+// is no thread for them to hold together.
+func BuildCommentThreads(comments []Comment) []*Comment {
+	byID := make(map[uint]*Comment, len(comments))
+	for i := range comments {
+		comments[i].Replies = nil
+		byID[comments[i].ID] = &comments[i]
+	}
+
+	var roots []*Comment
+	for i := range comments {
+		comment := &comments[i]
+		if comment.ParentID != nil {
+			if parent, ok := byID[*comment.ParentID]; ok && parent != comment {
+				parent.Replies = append(parent.Replies, comment)
+				continue
+			}
+		}
+		roots = append(roots, comment)
+	}
+
+	return pruneRemovedComments(roots)
+}
+
+// pruneRemovedComments drops removed comments that have no replies once their
+// own removed replies have been dropped.
+func pruneRemovedComments(comments []*Comment) []*Comment {
+	kept := make([]*Comment, 0, len(comments))
+	for _, comment := range comments {
+		comment.Replies = pruneRemovedComments(comment.Replies)
+		if comment.IsRemoved() && len(comment.Replies) == 0 {
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildCommentThreads(t *testing.T) {
+	removed := time.Now()
+	id := func(n uint) *uint { return &n }
+
+	comments := []Comment{
+		{ID: 1, Body: "can I use butter instead?"},
+		{ID: 2, ParentID: id(1), Body: "yes"},
+		{ID: 3, Body: "spam", RemovedAt: &removed},
+		{ID: 4, Body: "removed with replies", RemovedAt: &removed},
+		{ID: 5, ParentID: id(4), Body: "reply to removed"},
+		{ID: 6, ParentID: id(2), Body: "thanks"},
+		{ID: 7, ParentID: id(99), Body: "parent on another step"},
+	}
+
+	roots := BuildCommentThreads(comments)
+
+	var got []uint
+	for _, root := range roots {
+		got = append(got, root.ID)
+	}
+	if want := []uint{1, 4, 7}; !equalIDs(got, want) {
+		t.Fatalf("expected roots %v, got %v", want, got)
+	}
+
+	if len(roots[0].Replies) != 1 || roots[0].Replies[0].ID != 2 {
+		t.Fatalf("expected comment 2 to reply to 1, got %v", roots[0].Replies)
+	}
+	if len(roots[0].Replies[0].Replies) != 1 || roots[0].Replies[0].Replies[0].ID != 6 {
+		t.Errorf("expected comment 6 to reply to 2, got %v", roots[0].Replies[0].Replies)
+	}
+
+	dto := roots[1].ToDto().(CommentDto)
+	if !dto.Removed || dto.Body != "" || dto.UserID != 0 {
+		t.Errorf("expected removed comment to hide its author and body, got %+v", dto)
+	}
+	if len(dto.Replies) != 1 || dto.Replies[0].Body != "reply to removed" {
+		t.Errorf("expected reply to removed comment to be kept, got %+v", dto.Replies)
+	}
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package domain
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// UnitSystem is a system of measurement a Recipe can be converted to.
+type UnitSystem string
+
+const (
+	UnitSystemMetric UnitSystem = "metric"
+	// UnitSystemUS is US customary units: cups, spoons, ounces, pounds and Fahrenheit.
+	UnitSystemUS UnitSystem = "us"
+)
+
+// ParseUnitSystem parses a unit system name. "imperial" is accepted as an alias of "us".
+func ParseUnitSystem(s string) (UnitSystem, bool) {
+	switch strings.ToLower(s) {
+	case "metric":
+		return UnitSystemMetric, true
+	case "us", "imperial":
+		return UnitSystemUS, true
+	default:
+		return "", false
+	}
+}
+
+// Convert returns a copy of the recipe with its ingredients and oven temperatures
+// converted to the given unit system. Metric recipes weigh ingredients with a known
+// density instead of measuring their volume, and US recipes do the opposite.
+// Ingredients without a parsed amount and known unit are left as they are.
+func (r Recipe) Convert(system UnitSystem) Recipe {
+	ingredients := make([]Ingredient, len(r.Ingredients))
+	for i, ingredient := range r.Ingredients {
+		ingredients[i] = ingredient.convert(system)
+	}
+
+	instructions := make([]Instruction, len(r.Instructions))
+	for i, instruction := range r.Instructions {
+		instructions[i] = instruction
+		instructions[i].Contents = convertTemperatures(instruction.Contents, system)
+	}
+
+	r.Ingredients = ingredients
+	r.Instructions = instructions
+	return r
+}
+
+func (i Ingredient) convert(system UnitSystem) Ingredient {
+	unit, ok := units[i.CanonicalUnit]
+	if !ok || i.Amount == nil || unit.Dimension == DimensionCount {
+		return i
+	}
+
+	density, hasDensity := LookupDensity(i.Name)
+
+	var target func(base float64) (Unit, float64)
+	switch {
+	case system == UnitSystemMetric && unit.Dimension == DimensionVolume && hasDensity:
+		target = func(ml float64) (Unit, float64) { return metricMass(ml * density) }
+	case system == UnitSystemMetric && unit.Dimension == DimensionVolume:
+		target = metricVolume
+	case system == UnitSystemMetric:
+		target = metricMass
+	case system == UnitSystemUS && unit.Dimension == DimensionMass && hasDensity:
+		target = func(g float64) (Unit, float64) { return usVolume(g / density) }
+	case system == UnitSystemUS && unit.Dimension == DimensionVolume:
+		target = usVolume
+	case system == UnitSystemUS:
+		target = usMass
+	default:
+		return i
+	}
+
+	// the unit is chosen from the smallest amount so that ranges share a unit
+	to, _ := target(*i.Amount * unit.Base)
+	convertAmount := func(amount float64) float64 {
+		base := amount * unit.Base
+		if to.Dimension != unit.Dimension {
+			if to.Dimension == DimensionMass {
+				base *= density
+			} else {
+				base /= density
+			}
+		}
+		return roundAmount(base/to.Base, to, system)
+	}
+
+	if to.Name == unit.Name {
+		return i
+	}
+
+	quantity := Quantity{Min: convertAmount(*i.Amount)}
+	quantity.Max = quantity.Min
+	if i.AmountMax != nil {
+		quantity.Max = convertAmount(*i.AmountMax)
+	}
+
+	i.Quantity = quantity.String()
+	i.Unit = to.Name
+	i.CanonicalUnit = to.Name
+	i.setAmount(quantity)
+	return i
+}
+
+func metricMass(g float64) (Unit, float64) {
+	if g >= 1000 {
+		return units["kg"], g / 1000
+	}
+	return units["g"], g
+}
+
+func metricVolume(ml float64) (Unit, float64) {
+	if ml >= 1000 {
+		return units["l"], ml / 1000
+	}
+	return units["ml"], ml
+}
+
+func usMass(g float64) (Unit, float64) {
+	lb := units["lb"]
+	if g >= lb.Base {
+		return lb, g / lb.Base
+	}
+	oz := units["oz"]
+	return oz, g / oz.Base
+}
+
+func usVolume(ml float64) (Unit, float64) {
+	cup := units["cup"]
+	if ml >= cup.Base/4 {
+		return cup, ml / cup.Base
+	}
+	tbsp := units["tbsp"]
+	if ml >= tbsp.Base {
+		return tbsp, ml / tbsp.Base
+	}
+	tsp := units["tsp"]
+	return tsp, ml / tsp.Base
+}
+
+// roundAmount rounds a converted amount to a precision a cook would actually measure:
+// whole grams and millilitres, hundredths of kilos and litres, and eighths of US units.
+func roundAmount(amount float64, unit Unit, system UnitSystem) float64 {
+	if system == UnitSystemUS {
+		rounded := math.Round(amount*8) / 8
+		if rounded == 0 {
+			return math.Round(amount*100) / 100
+		}
+		return rounded
+	}
+
+	switch unit.Name {
+	case "kg", "l":
+		return math.Round(amount*100) / 100
+	default:
+		if amount < 10 {
+			return math.Round(amount*10) / 10
+		}
+		return math.Round(amount)
+	}
+}
+
+// temperaturePattern matches oven temperatures such as "350°F", "180 °C" and "350 degrees F",
+// as well as "350F" when there are three digits, so that "2 C" is not mistaken for a temperature.
+var temperaturePattern = regexp.MustCompile(`\b(?:(\d{2,3})\s*(?:°|º|(?i:degrees?\s*))\s*([FC])(?i:ahrenheit|elsius)?|(\d{3})\s?([FC]))\b`)
+
+// convertTemperatures rewrites the temperatures in an instruction in the unit system's temperature scale,
+// rounded as oven dials are: to 5 degrees Celsius or 25 degrees Fahrenheit.
+func convertTemperatures(contents string, system UnitSystem) string {
+	return temperaturePattern.ReplaceAllStringFunc(contents, func(match string) string {
+		groups := temperaturePattern.FindStringSubmatch(match)
+		value, scale := groups[1], groups[2]
+		if value == "" {
+			value, scale = groups[3], groups[4]
+		}
+
+		degrees, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return match
+		}
+
+		switch {
+		case scale == "F" && system == UnitSystemMetric:
+			return strconv.Itoa(roundTo((degrees-32)*5/9, 5)) + "°C"
+		case scale == "C" && system == UnitSystemUS:
+			return strconv.Itoa(roundTo(degrees*9/5+32, 25)) + "°F"
+		default:
+			return match
+		}
+	})
+}
+
+func roundTo(degrees, step float64) int {
+	return int(math.Round(degrees/step) * step)
+}
@@ -0,0 +1,117 @@
+package domain
+
+import "testing"
+
+func TestRecipe_Convert_metric(t *testing.T) {
+	recipe := Recipe{
+		Ingredients: []Ingredient{
+			{Name: "all-purpose flour", Quantity: "2", Unit: "cups"},
+			{Name: "whole milk", Quantity: "1/2", Unit: "cup"},
+			{Name: "vanilla extract", Quantity: "1", Unit: "tsp"},
+			{Name: "chicken thighs", Quantity: "2-3", Unit: "lbs"},
+			{Name: "garlic", Quantity: "2", Unit: "cloves"},
+			{Name: "salt", Quantity: "a pinch"},
+		},
+		Instructions: []Instruction{
+			{Step: 1, Contents: "Preheat the oven to 350°F."},
+			{Step: 2, Contents: "Bake at 425 degrees F for 10 minutes, then lower to 375F."},
+			{Step: 3, Contents: "Add 2 C of stock."},
+		},
+	}
+	for i := range recipe.Ingredients {
+		recipe.Ingredients[i].Parse()
+	}
+
+	converted := recipe.Convert(UnitSystemMetric)
+
+	expected := []struct {
+		quantity string
+		unit     string
+	}{
+		{"251", "g"},
+		{"122", "g"},
+		{"4.9", "ml"},
+		{"907-1361", "g"},
+		{"2", "cloves"},
+		{"a pinch", ""},
+	}
+	for i, ingredient := range converted.Ingredients {
+		if ingredient.Quantity != expected[i].quantity || ingredient.Unit != expected[i].unit {
+			t.Errorf("%s: expected %s %s, got %s %s", ingredient.Name, expected[i].quantity, expected[i].unit, ingredient.Quantity, ingredient.Unit)
+		}
+	}
+
+	expectedInstructions := []string{
+		"Preheat the oven to 175°C.",
+		"Bake at 220°C for 10 minutes, then lower to 190°C.",
+		"Add 2 C of stock.",
+	}
+	for i, instruction := range converted.Instructions {
+		if instruction.Contents != expectedInstructions[i] {
+			t.Errorf("expected %q, got %q", expectedInstructions[i], instruction.Contents)
+		}
+	}
+}
+
+func TestRecipe_Convert_us(t *testing.T) {
+	recipe := Recipe{
+		Ingredients: []Ingredient{
+			{Name: "sugar", Quantity: "200", Unit: "g"},
+			{Name: "chicken", Quantity: "500", Unit: "g"},
+			{Name: "stock", Quantity: "250", Unit: "ml"},
+			{Name: "soy sauce", Quantity: "15", Unit: "ml"},
+			{Name: "flour", Quantity: "1", Unit: "cup"},
+		},
+		Instructions: []Instruction{
+			{Step: 1, Contents: "Heat the oven to 180°C."},
+		},
+	}
+	for i := range recipe.Ingredients {
+		recipe.Ingredients[i].Parse()
+	}
+
+	converted := recipe.Convert(UnitSystemUS)
+
+	expected := []struct {
+		quantity string
+		unit     string
+	}{
+		{"1", "cup"},
+		{"1 1/8", "lb"},
+		{"1", "cup"},
+		{"1", "tbsp"},
+		{"1", "cup"},
+	}
+	for i, ingredient := range converted.Ingredients {
+		if ingredient.Quantity != expected[i].quantity || ingredient.Unit != expected[i].unit {
+			t.Errorf("%s: expected %s %s, got %s %s", ingredient.Name, expected[i].quantity, expected[i].unit, ingredient.Quantity, ingredient.Unit)
+		}
+	}
+
+	if got := converted.Instructions[0].Contents; got != "Heat the oven to 350°F." {
+		t.Errorf("expected converted temperature, got %q", got)
+	}
+}
+
+func TestLookupDensity(t *testing.T) {
+	tests := []struct {
+		name     string
+		density  float64
+		expected bool
+	}{
+		{"Brown Sugar, packed", 0.93, true},
+		{"sugar", 0.85, true},
+		{"buttermilk", 1.03, true},
+		{"unsalted butter", 0.96, true},
+		{"chicken", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			density, ok := LookupDensity(tt.name)
+			if ok != tt.expected || density != tt.density {
+				t.Errorf("expected %v %v, got %v %v", tt.density, tt.expected, density, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// densities are approximate densities in grams per millilitre for common
+// ingredients, used to convert between volumes and weights.
+var densities = map[string]float64{
+	"all-purpose flour":   0.53,
+	"flour":               0.53,
+	"bread flour":         0.55,
+	"cake flour":          0.48,
+	"whole wheat flour":   0.51,
+	"almond flour":        0.41,
+	"cornstarch":          0.54,
+	"cornmeal":            0.64,
+	"sugar":               0.85,
+	"granulated sugar":    0.85,
+	"caster sugar":        0.85,
+	"brown sugar":         0.93,
+	"powdered sugar":      0.51,
+	"icing sugar":         0.51,
+	"confectioners sugar": 0.51,
+	"honey":               1.42,
+	"maple syrup":         1.32,
+	"molasses":            1.40,
+	"butter":              0.96,
+	"peanut butter":       1.08,
+	"oil":                 0.92,
+	"olive oil":           0.91,
+	"water":               1.00,
+	"milk":                1.03,
+	"buttermilk":          1.03,
+	"cream":               1.01,
+	"heavy cream":         1.01,
+	"sour cream":          1.02,
+	"yogurt":              1.03,
+	"rice":                0.78,
+	"rolled oats":         0.38,
+	"oats":                0.38,
+	"cocoa powder":        0.42,
+	"chocolate chips":     0.72,
+	"salt":                1.20,
+	"kosher salt":         0.58,
+	"baking soda":         0.92,
+	"baking powder":       0.81,
+	"grated parmesan":     0.42,
+	"shredded cheese":     0.47,
+	"chopped nuts":        0.50,
+	"raisins":             0.63,
+}
+
+type densityPattern struct {
+	pattern *regexp.Regexp
+	density float64
+}
+
+// densityPatterns matches ingredient names against densities, most specific names first
+// so that "brown sugar" is preferred over "sugar".
+var densityPatterns = func() []densityPattern {
+	names := make([]string, 0, len(densities))
+	for name := range densities {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	patterns := make([]densityPattern, len(names))
+	for i, name := range names {
+		patterns[i] = densityPattern{
+			pattern: regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`),
+			density: densities[name],
+		}
+	}
+	return patterns
+}()
+
+// LookupDensity returns the density in grams per millilitre of the ingredient with the given name.
+func LookupDensity(ingredientName string) (float64, bool) {
+	name := strings.ToLower(ingredientName)
+	for _, p := range densityPatterns {
+		if p.pattern.MatchString(name) {
+			return p.density, true
+		}
+	}
+	return 0, false
+}
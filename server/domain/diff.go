@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Operations in a LineDiff.
+const (
+	DiffEqual   = "equal"
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+)
+
+// RecipeDiff is a structured diff between two snapshots of the same recipe.
+type RecipeDiff struct {
+	From         int           `json:"from"`
+	To           int           `json:"to"`
+	Fields       []FieldChange `json:"fields"`
+	Ingredients  []LineDiff    `json:"ingredients"`
+	Instructions []LineDiff    `json:"instructions"`
+	TagsAdded    []string      `json:"tags_added"`
+	TagsRemoved  []string      `json:"tags_removed"`
+}
+
+// FieldChange is a scalar recipe field that differs between two snapshots.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// LineDiff is one line of an ingredient or instruction list diff.
+type LineDiff struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffSnapshots compares two snapshots. Ingredients and instructions are diffed
+// line by line so reordered or edited entries show as a removal and an addition.
+func DiffSnapshots(from, to RecipeSnapshot) RecipeDiff {
+	diff := RecipeDiff{
+		Fields:      []FieldChange{},
+		TagsAdded:   []string{},
+		TagsRemoved: []string{},
+	}
+
+	fields := []FieldChange{
+		{"name", from.Name, to.Name},
+		{"description", from.Description, to.Description},
+		{"cook_time", from.CookTime, to.CookTime},
+		{"servings", strconv.Itoa(from.Servings), strconv.Itoa(to.Servings)},
+	}
+	for _, f := range fields {
+		if f.From != f.To {
+			diff.Fields = append(diff.Fields, f)
+		}
+	}
+
+	diff.Ingredients = diffLines(ingredientLines(from.Ingredients), ingredientLines(to.Ingredients))
+	diff.Instructions = diffLines(from.Instructions, to.Instructions)
+
+	fromTags := make(map[string]bool, len(from.Tags))
+	for _, tag := range from.Tags {
+		fromTags[tag] = true
+	}
+	toTags := make(map[string]bool, len(to.Tags))
+	for _, tag := range to.Tags {
+		toTags[tag] = true
+		if !fromTags[tag] {
+			diff.TagsAdded = append(diff.TagsAdded, tag)
+		}
+	}
+	for _, tag := range from.Tags {
+		if !toTags[tag] {
+			diff.TagsRemoved = append(diff.TagsRemoved, tag)
+		}
+	}
+
+	return diff
+}
+
+func ingredientLines(ingredients []IngredientSnapshot) []string {
+	lines := make([]string, len(ingredients))
+	for i, ingredient := range ingredients {
+		lines[i] = strings.Join(strings.Fields(ingredient.Quantity+" "+ingredient.Unit+" "+ingredient.Name), " ")
+	}
+	return lines
+}
+
+// diffLines diffs two lists using their longest common subsequence.
+func diffLines(a, b []string) []LineDiff {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := []LineDiff{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, LineDiff{DiffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, LineDiff{DiffRemoved, a[i]})
+			i++
+		default:
+			diff = append(diff, LineDiff{DiffAdded, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, LineDiff{DiffRemoved, a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, LineDiff{DiffAdded, b[j]})
+	}
+	return diff
+}
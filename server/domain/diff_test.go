@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	from := RecipeSnapshot{
+		Name:     "Pancakes",
+		Servings: 4,
+		Ingredients: []IngredientSnapshot{
+			{"2", "cups", "flour"},
+			{"1", "cup", "milk"},
+		},
+		Instructions: []string{"Mix.", "Rest.", "Fry."},
+		Tags:         []string{"breakfast", "sweet"},
+	}
+	to := RecipeSnapshot{
+		Name:     "Buttermilk Pancakes",
+		Servings: 4,
+		Ingredients: []IngredientSnapshot{
+			{"2", "cups", "flour"},
+			{"1", "cup", "buttermilk"},
+		},
+		Instructions: []string{"Mix.", "Fry."},
+		Tags:         []string{"breakfast", "weekend"},
+	}
+
+	diff := DiffSnapshots(from, to)
+
+	expectedFields := []FieldChange{{"name", "Pancakes", "Buttermilk Pancakes"}}
+	if !reflect.DeepEqual(diff.Fields, expectedFields) {
+		t.Errorf("expected fields %+v, got %+v", expectedFields, diff.Fields)
+	}
+
+	expectedIngredients := []LineDiff{
+		{DiffEqual, "2 cups flour"},
+		{DiffRemoved, "1 cup milk"},
+		{DiffAdded, "1 cup buttermilk"},
+	}
+	if !reflect.DeepEqual(diff.Ingredients, expectedIngredients) {
+		t.Errorf("expected ingredients %+v, got %+v", expectedIngredients, diff.Ingredients)
+	}
+
+	expectedInstructions := []LineDiff{
+		{DiffEqual, "Mix."},
+		{DiffRemoved, "Rest."},
+		{DiffEqual, "Fry."},
+	}
+	if !reflect.DeepEqual(diff.Instructions, expectedInstructions) {
+		t.Errorf("expected instructions %+v, got %+v", expectedInstructions, diff.Instructions)
+	}
+
+	if !reflect.DeepEqual(diff.TagsAdded, []string{"weekend"}) || !reflect.DeepEqual(diff.TagsRemoved, []string{"sweet"}) {
+		t.Errorf("expected +weekend -sweet, got +%q -%q", diff.TagsAdded, diff.TagsRemoved)
+	}
+}
+
+func TestDiffSnapshots_identical(t *testing.T) {
+	s := RecipeSnapshot{Name: "Toast", Instructions: []string{"Toast the bread."}}
+	diff := DiffSnapshots(s, s)
+	if len(diff.Fields) != 0 || len(diff.TagsAdded) != 0 || len(diff.TagsRemoved) != 0 {
+		t.Errorf("expected no changes, got %+v", diff)
+	}
+	for _, line := range diff.Instructions {
+		if line.Op != DiffEqual {
+			t.Errorf("expected only equal lines, got %+v", diff.Instructions)
+		}
+	}
+}
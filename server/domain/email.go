@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// MAX_EMAIL_LENGTH is the longest email address accepted, from RFC 5321.
+const MAX_EMAIL_LENGTH = 254
+
+// NormalizeEmail checks that email is a bare address, e.g. "cook@example.com",
+// and returns it trimmed and lower cased so that addresses compare equal
+// however they were typed.
+func NormalizeEmail(email string) (string, bool) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || len(email) > MAX_EMAIL_LENGTH {
+		return "", false
+	}
+
+	// display names and comments are not part of the address
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", false
+	}
+	return email, true
+}
+
+// EmailVerification lets whoever holds its token confirm that Email belongs
+// to the user, once, until it expires.
+type EmailVerification struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UserID    uint      `gorm:"not null;index"`
+	// Email is the address the token was sent to. The token only verifies the
+	// user's email while it is still this address.
+	Email string `gorm:"not null"`
+	// TokenHash is the SHA-256 of the verification token; the token itself is only ever emailed.
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+// Usable reports whether the verification can still be used at time now.
+func (v *EmailVerification) Usable(now time.Time) bool {
+	return v.UsedAt == nil && now.Before(v.ExpiresAt)
+}
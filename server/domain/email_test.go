@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+		ok    bool
+	}{
+		{"cook@example.com", "cook@example.com", true},
+		{"  Head.Cook+recipes@Example.COM ", "head.cook+recipes@example.com", true},
+		{"", "", false},
+		{"cook", "", false},
+		{"cook@localhost", "", false},
+		{"Cook <cook@example.com>", "", false},
+		{"cook@example.com, chef@example.com", "", false},
+		{"cook@example.com\r\nBcc: chef@example.com", "", false},
+		{strings.Repeat("a", MAX_EMAIL_LENGTH) + "@example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := NormalizeEmail(tt.email)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%q: expected %q %v, got %q %v", tt.email, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestEmailVerification_Usable(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := map[string]struct {
+		verification EmailVerification
+		usable       bool
+	}{
+		"unused":  {EmailVerification{ExpiresAt: future}, true},
+		"expired": {EmailVerification{ExpiresAt: past}, false},
+		"used":    {EmailVerification{ExpiresAt: future, UsedAt: &past}, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.verification.Usable(now); got != tt.usable {
+				t.Errorf("expected %v, got %v", tt.usable, got)
+			}
+		})
+	}
+}
+
+func TestUser_EmailVerified(t *testing.T) {
+	email, now := "cook@example.com", time.Now()
+
+	tests := map[string]struct {
+		user     User
+		verified bool
+	}{
+		"no email":   {User{}, false},
+		"unverified": {User{Email: &email}, false},
+		"verified":   {User{Email: &email, EmailVerifiedAt: &now}, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.user.EmailVerified(); got != tt.verified {
+				t.Errorf("expected %v, got %v", tt.verified, got)
+			}
+		})
+	}
+}
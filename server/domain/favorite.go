@@ -0,0 +1,10 @@
+package domain
+
+import "time"
+
+// Favorite is a recipe a user has saved.
+type Favorite struct {
+	UserID    uint `gorm:"primaryKey;autoIncrement:false"`
+	RecipeID  uint `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time
+}
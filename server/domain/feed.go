@@ -0,0 +1,59 @@
+package domain
+
+import "time"
+
+// Kinds of activity shown in a feed.
+const (
+	FeedItemRecipe = "recipe"
+	FeedItemFork   = "fork"
+	FeedItemReview = "review"
+)
+
+// FeedItem is one thing a followed user did: published a recipe, published a
+// fork of someone else's recipe, or reviewed a recipe. Review is only set for
+// reviews, and Recipe is the recipe the activity is about.
+type FeedItem struct {
+	Type      string
+	CreatedAt time.Time
+	UserID    uint
+	Username  string
+	Recipe    *Recipe
+	Review    *Review
+}
+
+// FeedItemDto is a DTO for a FeedItem.
+type FeedItemDto struct {
+	Type      string     `json:"type"`
+	CreatedAt time.Time  `json:"created_at"`
+	User      feedUser   `json:"user"`
+	Recipe    *RecipeDto `json:"recipe,omitempty"`
+	Review    *ReviewDto `json:"review,omitempty"`
+}
+
+type feedUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// ToDto converts a FeedItem to a FeedItemDto for an anonymous viewer.
+func (f *FeedItem) ToDto() Dto {
+	return f.ToDtoFor(0)
+}
+
+// ToDtoFor converts a FeedItem to a FeedItemDto for the user with viewerID.
+func (f *FeedItem) ToDtoFor(viewerID uint) Dto {
+	dto := FeedItemDto{
+		Type:      f.Type,
+		CreatedAt: f.CreatedAt,
+		User:      feedUser{ID: f.UserID, Username: f.Username},
+	}
+	if f.Recipe != nil {
+		recipe := f.Recipe.ToDtoFor(viewerID).(RecipeDto)
+		dto.Recipe = &recipe
+	}
+	if f.Review != nil {
+		review := f.Review.ToDto().(ReviewDto)
+		dto.Review = &review
+	}
+	return dto
+}
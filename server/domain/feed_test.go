@@ -0,0 +1,32 @@
+package domain
+
+import "testing"
+
+func TestFeedItem_ToDto(t *testing.T) {
+	recipe := &Recipe{Name: "Soda bread", UserID: 2}
+	recipe.ID = 7
+
+	item := FeedItem{
+		Type:     FeedItemReview,
+		UserID:   3,
+		Username: "reviewer",
+		Recipe:   recipe,
+		Review:   &Review{ID: 4, RecipeID: 7, UserID: 3, Rating: 5},
+	}
+
+	dto := item.ToDto().(FeedItemDto)
+	if dto.User.ID != 3 || dto.User.Username != "reviewer" {
+		t.Errorf("expected the reviewer as the feed item user, got %+v", dto.User)
+	}
+	if dto.Recipe == nil || dto.Recipe.ID != 7 {
+		t.Errorf("expected the reviewed recipe, got %+v", dto.Recipe)
+	}
+	if dto.Review == nil || dto.Review.Rating != 5 {
+		t.Errorf("expected the review, got %+v", dto.Review)
+	}
+
+	item = FeedItem{Type: FeedItemRecipe, UserID: 2, Recipe: recipe}
+	if dto := item.ToDto().(FeedItemDto); dto.Review != nil {
+		t.Errorf("expected no review on a recipe feed item, got %+v", dto.Review)
+	}
+}
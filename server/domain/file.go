@@ -2,11 +2,13 @@ package domain
 
 import (
 	"gorm.io/gorm"
+	"path"
 	"time"
 )
 
 type File struct {
 	gorm.Model
+	// Name is the file's object name in the bucket, under the ID of the user who uploaded it.
 	Name      string    `gorm:"not null"`
 	Url       string    `gorm:"not null"`
 	UrlExpiry time.Time `gorm:"not null"`
@@ -23,7 +25,7 @@ type FileDto struct {
 func (f *File) ToDto() Dto {
 	return FileDto{
 		ID:   f.ID,
-		Name: f.Name,
+		Name: path.Base(f.Name),
 		Url:  f.Url,
 	}
 }
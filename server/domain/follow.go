@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Follow is one user following another to see their activity in their feed.
+type Follow struct {
+	FollowerID uint `gorm:"primaryKey;autoIncrement:false"`
+	FolloweeID uint `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt  time.Time
+	Follower   User `gorm:"foreignKey:FollowerID"`
+	Followee   User `gorm:"foreignKey:FolloweeID"`
+}
+
+// FollowDto is one user in a list of followers or followed users.
+type FollowDto struct {
+	ID         uint      `json:"id"`
+	Username   string    `json:"username"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowerDto describes the user doing the following.
+func (f *Follow) FollowerDto() FollowDto {
+	return FollowDto{ID: f.FollowerID, Username: f.Follower.Username, FollowedAt: f.CreatedAt}
+}
+
+// FolloweeDto describes the user being followed.
+func (f *Follow) FolloweeDto() FollowDto {
+	return FollowDto{ID: f.FolloweeID, Username: f.Followee.Username, FollowedAt: f.CreatedAt}
+}
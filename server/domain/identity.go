@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// UserIdentity links a User to an account at an OIDC provider. A user can sign
+// in with any of their identities.
+type UserIdentity struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+	UserID    uint      `gorm:"not null;index"`
+	User      User      `gorm:"foreignKey:UserID"`
+	// Issuer and Subject identify the account at the provider.
+	Issuer  string `gorm:"not null;uniqueIndex:idx_identity_issuer_subject"`
+	Subject string `gorm:"not null;uniqueIndex:idx_identity_issuer_subject"`
+	// Email is the verified email address the provider last reported for the account.
+	Email string
+}
+
+// OIDCLogin is a sign in with an OIDC provider that has been started but not
+// finished. It is looked up by the hash of the state sent to the provider, and
+// holds the nonce and PKCE verifier the callback is checked against.
+type OIDCLogin struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	StateHash string    `gorm:"not null;uniqueIndex"`
+	Nonce     string    `gorm:"not null"`
+	Verifier  string    `gorm:"not null"`
+	// RedirectTo is the path to send the user to once they are signed in.
+	RedirectTo string
+	// LinkUserID is the user to link the identity to, when a signed in user
+	// started the login to add a provider to their account.
+	LinkUserID *uint
+	ExpiresAt  time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,51 @@
+package domain
+
+import "strings"
+
+// maxQuantityWords is the most words a quantity can span, e.g. "1 1/2 - 2".
+const maxQuantityWords = 4
+
+// ParseIngredientLine splits a free-form ingredient line such as "1 1/2 cups flour, sifted"
+// into an Ingredient with its quantity, unit and name. Lines without a leading quantity
+// are returned with only a name, e.g. "salt to taste".
+func ParseIngredientLine(line string) Ingredient {
+	words := strings.Fields(expandFractions(line))
+	if len(words) == 0 {
+		return Ingredient{}
+	}
+
+	// the longest run of leading words that parses as a quantity
+	quantityWords := 0
+	for n := min(maxQuantityWords, len(words)); n > 0; n-- {
+		if _, err := ParseQuantity(strings.Join(words[:n], " ")); err == nil {
+			quantityWords = n
+			break
+		}
+	}
+
+	ingredient := Ingredient{}
+	if quantityWords == 0 {
+		ingredient.Name = strings.Join(words, " ")
+		ingredient.Parse()
+		return ingredient
+	}
+	ingredient.Quantity = strings.Join(words[:quantityWords], " ")
+	words = words[quantityWords:]
+
+	// units are at most two words, e.g. "fl oz"
+	for n := min(2, len(words)-1); n > 0; n-- {
+		unit := strings.TrimRight(strings.Join(words[:n], " "), ",")
+		if _, ok := LookupUnit(unit); ok {
+			ingredient.Unit = unit
+			words = words[n:]
+			break
+		}
+	}
+
+	if len(words) > 1 && strings.EqualFold(words[0], "of") {
+		words = words[1:]
+	}
+	ingredient.Name = strings.Join(words, " ")
+	ingredient.Parse()
+	return ingredient
+}
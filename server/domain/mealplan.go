@@ -0,0 +1,81 @@
+package domain
+
+import "time"
+
+// Meal slots a recipe can be planned for.
+const (
+	MealSlotBreakfast = "breakfast"
+	MealSlotLunch     = "lunch"
+	MealSlotDinner    = "dinner"
+	MealSlotSnack     = "snack"
+)
+
+// IsValidMealSlot reports whether slot is one of the meal slot constants.
+func IsValidMealSlot(slot string) bool {
+	switch slot {
+	case MealSlotBreakfast, MealSlotLunch, MealSlotDinner, MealSlotSnack:
+		return true
+	}
+	return false
+}
+
+// MealPlanEntry is a recipe a user plans to cook for a meal on a date. Date only
+// holds a calendar day, at midnight UTC.
+type MealPlanEntry struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+	UserID    uint      `gorm:"not null;index:idx_meal_plan_user_date"`
+	Date      time.Time `gorm:"type:date;not null;index:idx_meal_plan_user_date"`
+	Slot      string    `gorm:"not null"`
+	RecipeID  uint      `gorm:"not null"`
+	Recipe    Recipe    `gorm:"foreignKey:RecipeID"`
+	// Servings overrides the recipe's servings when set.
+	Servings *int
+}
+
+// MealPlanEntryDto is a DTO for a MealPlanEntry. The recipe is scaled to the
+// entry's servings.
+type MealPlanEntryDto struct {
+	ID       uint      `json:"id"`
+	Date     string    `json:"date"`
+	Slot     string    `json:"slot"`
+	Servings *int      `json:"servings"`
+	Recipe   RecipeDto `json:"recipe"`
+}
+
+// ToDto converts a MealPlanEntry to a MealPlanEntryDto.
+func (m *MealPlanEntry) ToDto() Dto {
+	recipe := m.Recipe
+	if m.Servings != nil && *m.Servings != recipe.Servings {
+		recipe = recipe.Scale(*m.Servings)
+	}
+
+	return MealPlanEntryDto{
+		ID:       m.ID,
+		Date:     m.Date.Format(time.DateOnly),
+		Slot:     m.Slot,
+		Servings: m.Servings,
+		Recipe:   recipe.ToDto().(RecipeDto),
+	}
+}
+
+// mealSlotOrder is the order meals are eaten in a day.
+var mealSlotOrder = map[string]int{
+	MealSlotBreakfast: 0,
+	MealSlotLunch:     1,
+	MealSlotDinner:    2,
+	MealSlotSnack:     3,
+}
+
+// Before reports whether the entry comes before other in a plan: by date, then
+// by meal slot, then by when it was added.
+func (m *MealPlanEntry) Before(other *MealPlanEntry) bool {
+	if !m.Date.Equal(other.Date) {
+		return m.Date.Before(other.Date)
+	}
+	if m.Slot != other.Slot {
+		return mealSlotOrder[m.Slot] < mealSlotOrder[other.Slot]
+	}
+	return m.ID < other.ID
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMealPlanEntry_Before(t *testing.T) {
+	monday := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+
+	entries := []MealPlanEntry{
+		{ID: 1, Date: tuesday, Slot: MealSlotBreakfast},
+		{ID: 2, Date: monday, Slot: MealSlotSnack},
+		{ID: 3, Date: monday, Slot: MealSlotDinner},
+		{ID: 4, Date: monday, Slot: MealSlotBreakfast},
+		{ID: 5, Date: monday, Slot: MealSlotDinner},
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Before(&entries[j])
+	})
+
+	want := []uint{4, 3, 5, 2, 1}
+	for i, entry := range entries {
+		if entry.ID != want[i] {
+			t.Fatalf("expected order %v, got entry %d at %d", want, entry.ID, i)
+		}
+	}
+}
+
+func TestMealPlanEntry_ToDto(t *testing.T) {
+	servings := 4
+	entry := MealPlanEntry{
+		Date:     time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+		Slot:     MealSlotDinner,
+		Servings: &servings,
+		Recipe: Recipe{
+			Servings:    2,
+			Ingredients: []Ingredient{{Name: "rice", Quantity: "1", Unit: "cup"}},
+		},
+	}
+
+	dto := entry.ToDto().(MealPlanEntryDto)
+	if dto.Date != "2024-03-04" {
+		t.Errorf("expected date 2024-03-04, got %s", dto.Date)
+	}
+	if dto.Recipe.Servings != 4 {
+		t.Errorf("expected recipe scaled to 4 servings, got %d", dto.Recipe.Servings)
+	}
+	if q := dto.Recipe.Ingredients[0].(IngredientDto).Quantity; q != "2" {
+		t.Errorf("expected quantity 2, got %s", q)
+	}
+
+	entry.Servings = nil
+	if dto := entry.ToDto().(MealPlanEntryDto); dto.Recipe.Servings != 2 {
+		t.Errorf("expected recipe servings without an override, got %d", dto.Recipe.Servings)
+	}
+}
+
+func TestIsValidMealSlot(t *testing.T) {
+	for _, slot := range []string{MealSlotBreakfast, MealSlotLunch, MealSlotDinner, MealSlotSnack} {
+		if !IsValidMealSlot(slot) {
+			t.Errorf("expected %s to be a valid meal slot", slot)
+		}
+	}
+	if IsValidMealSlot("brunch") {
+		t.Error("expected brunch not to be a valid meal slot")
+	}
+}
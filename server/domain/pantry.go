@@ -0,0 +1,181 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// PantryItem is an ingredient a user has at home. ExpiresAt only holds a
+// calendar day, at midnight UTC.
+type PantryItem struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+	UserID    uint      `gorm:"not null;index"`
+	Name      string    `gorm:"not null"`
+	Quantity  string
+	Unit      string
+	// Amount, AmountMax and CanonicalUnit are parsed from Quantity and Unit, as for Ingredients.
+	Amount        *float64
+	AmountMax     *float64
+	CanonicalUnit string
+	ExpiresAt     *time.Time `gorm:"type:date"`
+}
+
+// PantryItemDto is a DTO for a PantryItem.
+type PantryItemDto struct {
+	ID            uint      `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Name          string    `json:"name"`
+	Quantity      string    `json:"quantity"`
+	Unit          string    `json:"unit"`
+	Amount        *float64  `json:"amount,omitempty"`
+	CanonicalUnit string    `json:"canonical_unit,omitempty"`
+	ExpiresAt     *string   `json:"expires_at"`
+	Expired       bool      `json:"expired"`
+}
+
+// ToDto converts a PantryItem to a PantryItemDto.
+func (p *PantryItem) ToDto() Dto {
+	var expiresAt *string
+	if p.ExpiresAt != nil {
+		date := p.ExpiresAt.Format(time.DateOnly)
+		expiresAt = &date
+	}
+	return PantryItemDto{
+		ID:            p.ID,
+		CreatedAt:     p.CreatedAt,
+		Name:          p.Name,
+		Quantity:      p.Quantity,
+		Unit:          p.Unit,
+		Amount:        p.Amount,
+		CanonicalUnit: p.CanonicalUnit,
+		ExpiresAt:     expiresAt,
+		Expired:       p.Expired(time.Now()),
+	}
+}
+
+// Parse sets the structured amount and unit fields from Quantity and Unit.
+// It must be called whenever Quantity or Unit change.
+func (p *PantryItem) Parse() {
+	ingredient := Ingredient{Quantity: p.Quantity, Unit: p.Unit}
+	ingredient.Parse()
+	p.Amount, p.AmountMax, p.CanonicalUnit = ingredient.Amount, ingredient.AmountMax, ingredient.CanonicalUnit
+}
+
+// Expired reports whether the item is past its expiry date at t. Items are good
+// until the end of the day they expire on.
+func (p *PantryItem) Expired(t time.Time) bool {
+	return p.ExpiresAt != nil && !t.Before(p.ExpiresAt.AddDate(0, 0, 1))
+}
+
+// covers reports whether the pantry item is enough of the ingredient. When both
+// have amounts in units that can be compared the pantry must have at least as
+// much as the recipe needs; otherwise having the ingredient at all is enough.
+func (p *PantryItem) covers(ingredient Ingredient) bool {
+	if p.Amount == nil || ingredient.Amount == nil {
+		return true
+	}
+
+	have, need := *p.Amount, *ingredient.Amount
+	pantryUnit, pantryKnown := units[p.CanonicalUnit]
+	recipeUnit, recipeKnown := units[ingredient.CanonicalUnit]
+	switch {
+	case pantryKnown && recipeKnown && pantryUnit.Dimension == recipeUnit.Dimension && pantryUnit.Dimension != DimensionCount:
+		have, need = have*pantryUnit.Base, need*recipeUnit.Base
+	case p.CanonicalUnit != ingredient.CanonicalUnit:
+		return true
+	}
+	return have >= need
+}
+
+// CookableRecipe is a recipe ranked by how much of it can be made from a pantry.
+type CookableRecipe struct {
+	Recipe  Recipe
+	Covered int
+	Missing []Ingredient
+}
+
+// CookableRecipeDto is a DTO for a CookableRecipe.
+type CookableRecipeDto struct {
+	Recipe   RecipeDto `json:"recipe"`
+	Covered  int       `json:"covered"`
+	Total    int       `json:"total"`
+	Coverage float64   `json:"coverage"`
+	Missing  []Dto     `json:"missing"`
+}
+
+// Coverage is the fraction of the recipe's ingredients the pantry covers.
+// Recipes without ingredients are fully covered.
+func (c *CookableRecipe) Coverage() float64 {
+	total := len(c.Recipe.Ingredients)
+	if total == 0 {
+		return 1
+	}
+	return float64(c.Covered) / float64(total)
+}
+
+// ToDto converts a CookableRecipe to a CookableRecipeDto for an anonymous viewer.
+func (c *CookableRecipe) ToDto() Dto {
+	return c.ToDtoFor(0)
+}
+
+// ToDtoFor converts a CookableRecipe to a CookableRecipeDto for the user with viewerID.
+func (c *CookableRecipe) ToDtoFor(viewerID uint) Dto {
+	missing := make([]Dto, len(c.Missing))
+	for i, ingredient := range c.Missing {
+		missing[i] = ingredient.ToDto()
+	}
+	return CookableRecipeDto{
+		Recipe:   c.Recipe.ToDtoFor(viewerID).(RecipeDto),
+		Covered:  c.Covered,
+		Total:    len(c.Recipe.Ingredients),
+		Coverage: c.Coverage(),
+		Missing:  missing,
+	}
+}
+
+// MatchPantry works out which of the recipe's ingredients the pantry covers at
+// t, matching ingredients by their normalized name. Expired items do not count.
+func MatchPantry(recipe Recipe, pantry []PantryItem, t time.Time) CookableRecipe {
+	byName := make(map[string][]PantryItem, len(pantry))
+	for _, item := range pantry {
+		if item.Expired(t) {
+			continue
+		}
+		name := NormalizeIngredientName(item.Name)
+		byName[name] = append(byName[name], item)
+	}
+
+	cookable := CookableRecipe{Recipe: recipe, Missing: []Ingredient{}}
+	for _, ingredient := range recipe.Ingredients {
+		covered := false
+		for _, item := range byName[NormalizeIngredientName(ingredient.Name)] {
+			if item.covers(ingredient) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			cookable.Covered++
+		} else {
+			cookable.Missing = append(cookable.Missing, ingredient)
+		}
+	}
+	return cookable
+}
+
+// RankCookable sorts recipes by how many of their ingredients the pantry covers,
+// most first, then by how few are missing, then newest first.
+func RankCookable(recipes []CookableRecipe) {
+	sort.SliceStable(recipes, func(i, j int) bool {
+		a, b := recipes[i], recipes[j]
+		if a.Covered != b.Covered {
+			return a.Covered > b.Covered
+		}
+		if len(a.Missing) != len(b.Missing) {
+			return len(a.Missing) < len(b.Missing)
+		}
+		return a.Recipe.ID > b.Recipe.ID
+	})
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchPantry(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	yesterday := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+	parsed := func(i Ingredient) Ingredient { i.Parse(); return i }
+	pantryItem := func(p PantryItem) PantryItem { p.Parse(); return p }
+
+	recipe := Recipe{Ingredients: []Ingredient{
+		parsed(Ingredient{Name: "Tomatoes, diced", Quantity: "2", Unit: ""}),
+		parsed(Ingredient{Name: "milk", Quantity: "1", Unit: "cup"}),
+		parsed(Ingredient{Name: "flour", Quantity: "500", Unit: "g"}),
+		parsed(Ingredient{Name: "eggs", Quantity: "2", Unit: ""}),
+		parsed(Ingredient{Name: "salt"}),
+		parsed(Ingredient{Name: "basil", Quantity: "1", Unit: "bunch"}),
+	}}
+	pantry := []PantryItem{
+		pantryItem(PantryItem{Name: "tomato", Quantity: "3"}),
+		pantryItem(PantryItem{Name: "Milk", Quantity: "1", Unit: "l", ExpiresAt: &today}),
+		pantryItem(PantryItem{Name: "flour", Quantity: "250", Unit: "g"}),
+		pantryItem(PantryItem{Name: "eggs", Quantity: "6", ExpiresAt: &yesterday}),
+		pantryItem(PantryItem{Name: "salt"}),
+		pantryItem(PantryItem{Name: "basil", Quantity: "20", Unit: "g"}),
+	}
+
+	match := MatchPantry(recipe, pantry, now)
+	if match.Covered != 4 {
+		t.Errorf("expected 4 covered ingredients, got %d", match.Covered)
+	}
+
+	var missing []string
+	for _, ingredient := range match.Missing {
+		missing = append(missing, ingredient.Name)
+	}
+	// not enough flour, and the eggs have expired
+	if len(missing) != 2 || missing[0] != "flour" || missing[1] != "eggs" {
+		t.Errorf("expected flour and eggs to be missing, got %v", missing)
+	}
+}
+
+func TestRankCookable(t *testing.T) {
+	recipe := func(id uint) Recipe {
+		r := Recipe{}
+		r.ID = id
+		return r
+	}
+
+	cookable := []CookableRecipe{
+		{Recipe: recipe(1), Covered: 2, Missing: make([]Ingredient, 3)},
+		{Recipe: recipe(2), Covered: 3, Missing: make([]Ingredient, 0)},
+		{Recipe: recipe(3), Covered: 2, Missing: make([]Ingredient, 1)},
+		{Recipe: recipe(4), Covered: 3, Missing: make([]Ingredient, 0)},
+	}
+	RankCookable(cookable)
+
+	want := []uint{4, 2, 3, 1}
+	for i, c := range cookable {
+		if c.Recipe.ID != want[i] {
+			t.Fatalf("expected order %v, got recipe %d at %d", want, c.Recipe.ID, i)
+		}
+	}
+}
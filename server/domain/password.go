@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// PasswordReset lets whoever holds its token set a new password for a user,
+// once, until it expires.
+type PasswordReset struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UserID    uint      `gorm:"not null;index"`
+	// TokenHash is the SHA-256 of the reset token; the token itself is only ever emailed.
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+// Usable reports whether the reset can still be used at time now.
+func (p *PasswordReset) Usable(now time.Time) bool {
+	return p.UsedAt == nil && now.Before(p.ExpiresAt)
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPasswordReset_Usable(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := map[string]struct {
+		reset  PasswordReset
+		usable bool
+	}{
+		"unused":  {PasswordReset{ExpiresAt: future}, true},
+		"expired": {PasswordReset{ExpiresAt: past}, false},
+		"used":    {PasswordReset{ExpiresAt: future, UsedAt: &past}, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.reset.Usable(now); got != tt.usable {
+				t.Errorf("expected %v, got %v", tt.usable, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package domain
+
+// Recipe statuses.
+const (
+	// RecipeStatusDraft recipes are only visible to their owner.
+	RecipeStatusDraft = "draft"
+	// RecipeStatusPublished recipes are visible according to their visibility.
+	RecipeStatusPublished = "published"
+)
+
+// IsComplete reports whether the recipe has enough content to be published:
+// at least one ingredient and one instruction.
+func (r *Recipe) IsComplete() bool {
+	return len(r.Ingredients) > 0 && len(r.Instructions) > 0
+}
@@ -0,0 +1,183 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidQuantity is returned when an ingredient quantity cannot be parsed.
+var ErrInvalidQuantity = errors.New("invalid quantity")
+
+// Quantity is a parsed ingredient amount such as "1 1/2", "½", "0.25" or the range "2-3".
+type Quantity struct {
+	Min float64
+	// Max is only greater than Min for ranges.
+	Max float64
+}
+
+// IsRange reports whether the quantity is a range, e.g. "2-3".
+func (q Quantity) IsRange() bool {
+	return q.Max > q.Min
+}
+
+// Scale returns the quantity multiplied by factor.
+func (q Quantity) Scale(factor float64) Quantity {
+	return Quantity{Min: q.Min * factor, Max: q.Max * factor}
+}
+
+// String renders the quantity using friendly fractions where possible, e.g. "1 1/2" or "2-3".
+func (q Quantity) String() string {
+	if q.IsRange() {
+		return formatAmount(q.Min) + "-" + formatAmount(q.Max)
+	}
+	return formatAmount(q.Min)
+}
+
+var unicodeFractions = map[rune]string{
+	'½': "1/2",
+	'⅓': "1/3",
+	'⅔': "2/3",
+	'¼': "1/4",
+	'¾': "3/4",
+	'⅕': "1/5",
+	'⅖': "2/5",
+	'⅗': "3/5",
+	'⅘': "4/5",
+	'⅙': "1/6",
+	'⅚': "5/6",
+	'⅛': "1/8",
+	'⅜': "3/8",
+	'⅝': "5/8",
+	'⅞': "7/8",
+}
+
+var rangeSeparator = regexp.MustCompile(`\s*(?:-|–|—|\bto\b)\s*`)
+
+// ParseQuantity parses a free-form ingredient quantity.
+// Whole numbers, decimals, fractions, mixed numbers, unicode fractions and ranges are supported.
+func ParseQuantity(s string) (Quantity, error) {
+	parts := rangeSeparator.Split(expandFractions(s), -1)
+	switch len(parts) {
+	case 1:
+		amount, err := parseAmount(parts[0])
+		if err != nil {
+			return Quantity{}, err
+		}
+		return Quantity{Min: amount, Max: amount}, nil
+	case 2:
+		low, err := parseAmount(parts[0])
+		if err != nil {
+			return Quantity{}, err
+		}
+		high, err := parseAmount(parts[1])
+		if err != nil {
+			return Quantity{}, err
+		}
+		if high < low {
+			return Quantity{}, ErrInvalidQuantity
+		}
+		return Quantity{Min: low, Max: high}, nil
+	default:
+		return Quantity{}, ErrInvalidQuantity
+	}
+}
+
+// expandFractions replaces unicode fractions with their ASCII equivalent, e.g. "1½" becomes "1 1/2".
+func expandFractions(s string) string {
+	var expanded strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		if fraction, ok := unicodeFractions[r]; ok {
+			expanded.WriteString(" " + fraction)
+			continue
+		}
+		if r == '⁄' {
+			// fraction slash
+			r = '/'
+		}
+		expanded.WriteRune(r)
+	}
+	return strings.TrimSpace(expanded.String())
+}
+
+// parseAmount parses a single non-negative amount such as "2", "0.25", "1/2" or "1 1/2".
+func parseAmount(s string) (float64, error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		return parseNumber(fields[0])
+	case 2:
+		// mixed number, e.g. "1 1/2"
+		if strings.Contains(fields[0], "/") || !strings.Contains(fields[1], "/") {
+			return 0, ErrInvalidQuantity
+		}
+		whole, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return 0, ErrInvalidQuantity
+		}
+		fraction, err := parseNumber(fields[1])
+		if err != nil {
+			return 0, err
+		}
+		return float64(whole) + fraction, nil
+	default:
+		return 0, ErrInvalidQuantity
+	}
+}
+
+func parseNumber(s string) (float64, error) {
+	if numerator, denominator, ok := strings.Cut(s, "/"); ok {
+		n, err := strconv.ParseUint(numerator, 10, 32)
+		if err != nil {
+			return 0, ErrInvalidQuantity
+		}
+		d, err := strconv.ParseUint(denominator, 10, 32)
+		if err != nil || d == 0 {
+			return 0, ErrInvalidQuantity
+		}
+		return float64(n) / float64(d), nil
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, ErrInvalidQuantity
+	}
+	return n, nil
+}
+
+// fractionTolerance is how far an amount may be rounded to reach a friendly fraction.
+const fractionTolerance = 0.02
+
+// formatAmount renders an amount as a whole number, a mixed number using halves,
+// thirds, quarters or eighths, or failing that a decimal with at most two places.
+func formatAmount(amount float64) string {
+	whole := math.Floor(amount)
+	fraction := amount - whole
+
+	if fraction < fractionTolerance && (whole > 0 || amount == 0) {
+		return strconv.FormatFloat(whole, 'f', 0, 64)
+	}
+	if fraction > 1-fractionTolerance {
+		return strconv.FormatFloat(whole+1, 'f', 0, 64)
+	}
+
+	for _, denominator := range []float64{2, 3, 4, 8} {
+		numerator := math.Round(fraction * denominator)
+		if numerator <= 0 || numerator >= denominator {
+			continue
+		}
+		if math.Abs(fraction-numerator/denominator) > fractionTolerance {
+			continue
+		}
+
+		f := strconv.FormatFloat(numerator, 'f', 0, 64) + "/" + strconv.FormatFloat(denominator, 'f', 0, 64)
+		if whole == 0 {
+			return f
+		}
+		return strconv.FormatFloat(whole, 'f', 0, 64) + " " + f
+	}
+
+	return strconv.FormatFloat(math.Round(amount*100)/100, 'f', -1, 64)
+}
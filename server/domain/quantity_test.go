@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Quantity
+	}{
+		{"2", Quantity{2, 2}},
+		{"0.25", Quantity{0.25, 0.25}},
+		{"1/2", Quantity{0.5, 0.5}},
+		{"1 1/2", Quantity{1.5, 1.5}},
+		{"½", Quantity{0.5, 0.5}},
+		{"1½", Quantity{1.5, 1.5}},
+		{"1 ¾", Quantity{1.75, 1.75}},
+		{"2-3", Quantity{2, 3}},
+		{"2 – 3", Quantity{2, 3}},
+		{"1/2 to 1", Quantity{0.5, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			q, err := ParseQuantity(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if q != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, q)
+			}
+		})
+	}
+}
+
+func TestParseQuantity_invalid(t *testing.T) {
+	for _, input := range []string{"", "a pinch", "1/0", "-1", "3-2", "1 2", "1-2-3"} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := ParseQuantity(input); !errors.Is(err, ErrInvalidQuantity) {
+				t.Errorf("expected ErrInvalidQuantity, got %v", err)
+			}
+		})
+	}
+}
+
+func TestQuantity_String(t *testing.T) {
+	tests := []struct {
+		quantity Quantity
+		expected string
+	}{
+		{Quantity{3, 3}, "3"},
+		{Quantity{0.5, 0.5}, "1/2"},
+		{Quantity{1.5, 1.5}, "1 1/2"},
+		{Quantity{1.0 / 3, 1.0 / 3}, "1/3"},
+		{Quantity{0.375, 0.375}, "3/8"},
+		{Quantity{0.999, 0.999}, "1"},
+		{Quantity{0.3, 0.3}, "0.3"},
+		{Quantity{2, 3}, "2-3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := tt.quantity.String(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRecipe_Scale(t *testing.T) {
+	recipe := Recipe{
+		Servings: 4,
+		Ingredients: []Ingredient{
+			{Name: "flour", Quantity: "1 1/2", Unit: "cups"},
+			{Name: "eggs", Quantity: "2-3"},
+			{Name: "salt", Quantity: "a pinch"},
+			{Name: "pepper"},
+		},
+	}
+
+	scaled := recipe.Scale(2)
+
+	if scaled.Servings != 2 {
+		t.Errorf("expected 2 servings, got %d", scaled.Servings)
+	}
+
+	expected := []struct {
+		quantity string
+		unscaled bool
+	}{
+		{"3/4", false},
+		{"1-1 1/2", false},
+		{"a pinch", true},
+		{"", false},
+	}
+	for i, ingredient := range scaled.Ingredients {
+		got := ingredient.ToDto().(IngredientDto)
+		if got.Quantity != expected[i].quantity || got.Unscaled != expected[i].unscaled {
+			t.Errorf("%s: expected %+v, got %+v", got.Name, expected[i], got)
+		}
+	}
+
+	if recipe.Ingredients[0].Quantity != "1 1/2" {
+		t.Errorf("expected original recipe to be unchanged, got %q", recipe.Ingredients[0].Quantity)
+	}
+}
+
+func TestIngredient_Parse(t *testing.T) {
+	tests := []struct {
+		quantity      string
+		unit          string
+		amount        *float64
+		amountMax     *float64
+		canonicalUnit string
+	}{
+		{"1 1/2", "Tablespoons", ptr(1.5), nil, "tbsp"},
+		{"2-3", "cloves", ptr(2.0), ptr(3.0), "clove"},
+		{"200", "g", ptr(200.0), nil, "g"},
+		{"1", "T", ptr(1.0), nil, "tbsp"},
+		{"1", "t", ptr(1.0), nil, "tsp"},
+		{"some", "handfuls", nil, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.quantity+" "+tt.unit, func(t *testing.T) {
+			ingredient := Ingredient{Quantity: tt.quantity, Unit: tt.unit}
+			ingredient.Parse()
+
+			if !equalPtr(ingredient.Amount, tt.amount) {
+				t.Errorf("expected amount %v, got %v", deref(tt.amount), deref(ingredient.Amount))
+			}
+			if !equalPtr(ingredient.AmountMax, tt.amountMax) {
+				t.Errorf("expected amount max %v, got %v", deref(tt.amountMax), deref(ingredient.AmountMax))
+			}
+			if ingredient.CanonicalUnit != tt.canonicalUnit {
+				t.Errorf("expected unit %q, got %q", tt.canonicalUnit, ingredient.CanonicalUnit)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func deref(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+func equalPtr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
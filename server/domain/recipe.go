@@ -8,39 +8,77 @@ import (
 // Recipe represents a recipe in the system.
 type Recipe struct {
 	gorm.Model
-	Name         string `gorm:"not null"`
-	Description  string
-	CookTime     string
-	Servings     int           `gorm:"default:1"`
-	UserID       uint          `json:"user_id"`
+	Name        string `gorm:"not null"`
+	Description string
+	CookTime    string
+	Servings    int    `gorm:"default:1"`
+	UserID      uint   `json:"user_id"`
+	Visibility  string `gorm:"not null;default:public;index"`
+	Status      string `gorm:"not null;default:published;index"`
+	// PublishedAt is when the recipe was last published.
+	PublishedAt *time.Time
+	// PublishAt is when a draft is scheduled to be published, if it is.
+	PublishAt    *time.Time    `gorm:"index"`
 	Ingredients  []Ingredient  `gorm:"foreignKey:RecipeID"`
 	Instructions []Instruction `gorm:"foreignKey:RecipeID"`
 	Tags         []*Tag        `gorm:"many2many:recipe_tags"`
+	// ForkedFromID is the recipe this one was copied from, if any.
+	ForkedFromID *uint   `gorm:"index"`
+	ForkedFrom   *Recipe `gorm:"foreignKey:ForkedFromID"`
+	// FavoriteCount, Favorited, RatingAverage and RatingCount are filled in by
+	// RecipeService.AnnotateRecipes. Favorited is nil when the viewer is anonymous.
+	FavoriteCount int64   `gorm:"-"`
+	Favorited     *bool   `gorm:"-"`
+	RatingAverage float64 `gorm:"-"`
+	RatingCount   int64   `gorm:"-"`
 	//HeroImage    File          `gorm:"foreignKey:RecipeID"`
 }
 
 // RecipeDto is a DTO for a Recipe.
 type RecipeDto struct {
-	ID           uint        `json:"id"`
-	CreatedAt    time.Time   `json:"created_at"`
-	Name         string      `json:"name"`
-	Description  string      `json:"description"`
-	CookTime     string      `json:"cook_time"`
-	Servings     int         `json:"servings"`
-	Ingredients  []Dto       `json:"ingredients"`
-	Instructions []Dto       `json:"instructions"`
-	Tags         []simpleTag `json:"tags"`
-	UserID       uint        `json:"user"`
+	ID            uint        `json:"id"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Name          string      `json:"name"`
+	Description   string      `json:"description"`
+	CookTime      string      `json:"cook_time"`
+	Servings      int         `json:"servings"`
+	Ingredients   []Dto       `json:"ingredients"`
+	Instructions  []Dto       `json:"instructions"`
+	Tags          []simpleTag `json:"tags"`
+	UserID        uint        `json:"user"`
+	Visibility    string      `json:"visibility"`
+	Status        string      `json:"status"`
+	PublishedAt   *time.Time  `json:"published_at"`
+	PublishAt     *time.Time  `json:"publish_at,omitempty"`
+	ForkedFrom    *forkedFrom `json:"forked_from,omitempty"`
+	FavoriteCount int64       `json:"favorite_count"`
+	Favorited     *bool       `json:"favorited,omitempty"`
+	RatingAverage float64     `json:"rating_average"`
+	RatingCount   int64       `json:"rating_count"`
 	//HeroImage    FileDto     `json:"hero_image"`
 }
 
+// forkedFrom is the original recipe a fork was copied from. Name and UserID
+// are empty if the original has since been deleted or is hidden from the viewer.
+type forkedFrom struct {
+	ID     uint   `json:"id"`
+	Name   string `json:"name,omitempty"`
+	UserID uint   `json:"user,omitempty"`
+}
+
 type simpleTag struct {
 	ID  uint   `json:"id"`
 	Tag string `json:"tag"`
 }
 
-// ToDto converts a Recipe to a RecipeDto.
+// ToDto converts a Recipe to a RecipeDto for an anonymous viewer.
 func (r *Recipe) ToDto() Dto {
+	return r.ToDtoFor(0)
+}
+
+// ToDtoFor converts a Recipe to a RecipeDto for the user with viewerID. The
+// original of a fork is only described if it is visible to them.
+func (r *Recipe) ToDtoFor(viewerID uint) Dto {
 	ingredients := make([]Dto, len(r.Ingredients))
 	for i, ingredient := range r.Ingredients {
 		ingredients[i] = ingredient.ToDto()
@@ -59,46 +97,138 @@ func (r *Recipe) ToDto() Dto {
 		}
 	}
 
+	var forked *forkedFrom
+	if r.ForkedFromID != nil {
+		forked = &forkedFrom{ID: *r.ForkedFromID}
+		if r.ForkedFrom != nil && r.ForkedFrom.VisibleTo(viewerID) {
+			forked.Name = r.ForkedFrom.Name
+			forked.UserID = r.ForkedFrom.UserID
+		}
+	}
+
 	return RecipeDto{
-		ID:           r.ID,
-		CreatedAt:    r.CreatedAt,
-		Name:         r.Name,
-		Description:  r.Description,
-		Servings:     r.Servings,
-		CookTime:     r.CookTime,
-		Ingredients:  ingredients,
-		Instructions: instructions,
-		Tags:         tags,
-		UserID:       r.UserID,
+		ID:            r.ID,
+		CreatedAt:     r.CreatedAt,
+		Name:          r.Name,
+		Description:   r.Description,
+		Servings:      r.Servings,
+		CookTime:      r.CookTime,
+		Ingredients:   ingredients,
+		Instructions:  instructions,
+		Tags:          tags,
+		UserID:        r.UserID,
+		Visibility:    r.Visibility,
+		Status:        r.Status,
+		PublishedAt:   r.PublishedAt,
+		PublishAt:     r.PublishAt,
+		ForkedFrom:    forked,
+		FavoriteCount: r.FavoriteCount,
+		Favorited:     r.Favorited,
+		RatingAverage: r.RatingAverage,
+		RatingCount:   r.RatingCount,
 		//HeroImage:    r.HeroImage.ToDto().(FileDto),
 	}
 }
 
+// Scale returns a copy of the recipe with its ingredient quantities adjusted
+// from r.Servings to servings. Quantities that cannot be parsed are left as
+// they are and flagged as unscaled in the IngredientDto.
+func (r Recipe) Scale(servings int) Recipe {
+	original := r.Servings
+	if original <= 0 {
+		original = 1
+	}
+	factor := float64(servings) / float64(original)
+
+	ingredients := make([]Ingredient, len(r.Ingredients))
+	for i, ingredient := range r.Ingredients {
+		ingredients[i] = ingredient
+		if ingredient.Quantity == "" {
+			continue
+		}
+
+		quantity, err := ParseQuantity(ingredient.Quantity)
+		if err != nil {
+			ingredients[i].unscaled = true
+			continue
+		}
+		quantity = quantity.Scale(factor)
+		ingredients[i].Quantity = quantity.String()
+		ingredients[i].setAmount(quantity)
+	}
+
+	r.Servings = servings
+	r.Ingredients = ingredients
+	return r
+}
+
 // Ingredient represents an ingredient in a Recipe.
 // A Recipe can have many Ingredients.
+// Quantity and Unit hold the text as it was entered, while Amount, AmountMax
+// and CanonicalUnit hold the structured values parsed from them by Parse.
 type Ingredient struct {
 	gorm.Model
 	Name     string `json:"name"`
 	Quantity string `json:"quantity"`
 	Unit     string `json:"unit"`
+	// Amount is nil when Quantity could not be parsed.
+	Amount *float64 `json:"amount"`
+	// AmountMax is only set when Quantity is a range, e.g. "2-3".
+	AmountMax *float64 `json:"amount_max"`
+	// CanonicalUnit is the unit registry name for Unit, or empty if Unit is not a known unit.
+	CanonicalUnit string `json:"canonical_unit"`
 	// RecipeID is the ID of the recipe that this Ingredient belongs to.
 	RecipeID uint `json:"recipe_id"`
+	// unscaled is set by Recipe.Scale when Quantity could not be parsed.
+	unscaled bool
 }
 
 type IngredientDto struct {
-	ID       uint   `json:"id"`
-	Name     string `json:"name"`
-	Quantity string `json:"quantity"`
-	Unit     string `json:"unit"`
+	ID            uint     `json:"id"`
+	Name          string   `json:"name"`
+	Quantity      string   `json:"quantity"`
+	Unit          string   `json:"unit"`
+	Amount        *float64 `json:"amount,omitempty"`
+	AmountMax     *float64 `json:"amount_max,omitempty"`
+	CanonicalUnit string   `json:"canonical_unit,omitempty"`
+	// Unscaled is true when the recipe was scaled but this quantity could not be.
+	Unscaled bool `json:"unscaled,omitempty"`
 }
 
 // ToDto converts an Ingredient to a Dto.
 func (i *Ingredient) ToDto() Dto {
 	return IngredientDto{
-		ID:       i.ID,
-		Name:     i.Name,
-		Quantity: i.Quantity,
-		Unit:     i.Unit,
+		ID:            i.ID,
+		Name:          i.Name,
+		Quantity:      i.Quantity,
+		Unit:          i.Unit,
+		Amount:        i.Amount,
+		AmountMax:     i.AmountMax,
+		CanonicalUnit: i.CanonicalUnit,
+		Unscaled:      i.unscaled,
+	}
+}
+
+// Parse sets the structured amount and unit fields from Quantity and Unit.
+// It must be called whenever Quantity or Unit change.
+func (i *Ingredient) Parse() {
+	i.Amount, i.AmountMax, i.CanonicalUnit = nil, nil, ""
+
+	if quantity, err := ParseQuantity(i.Quantity); err == nil {
+		i.setAmount(quantity)
+	}
+	if unit, ok := LookupUnit(i.Unit); ok {
+		i.CanonicalUnit = unit.Name
+	}
+}
+
+// setAmount sets Amount and AmountMax from a parsed quantity.
+func (i *Ingredient) setAmount(quantity Quantity) {
+	amount := quantity.Min
+	i.Amount, i.AmountMax = &amount, nil
+	if quantity.IsRange() {
+		amountMax := quantity.Max
+		i.AmountMax = &amountMax
 	}
 }
 
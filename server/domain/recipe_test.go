@@ -0,0 +1,78 @@
+package domain
+
+import "testing"
+
+func TestRecipe_ToDtoFor_forkedFrom(t *testing.T) {
+	originalID := uint(7)
+
+	tests := []struct {
+		name     string
+		recipe   Recipe
+		viewerID uint
+		expected *forkedFrom
+	}{
+		{
+			name:     "not a fork",
+			recipe:   Recipe{Name: "Soup"},
+			expected: nil,
+		},
+		{
+			name: "fork",
+			recipe: Recipe{
+				Name:         "Spicy Soup",
+				ForkedFromID: &originalID,
+				ForkedFrom:   &Recipe{Name: "Soup", UserID: 3, Visibility: VisibilityPublic, Status: RecipeStatusPublished},
+			},
+			expected: &forkedFrom{ID: 7, Name: "Soup", UserID: 3},
+		},
+		{
+			name: "original made private",
+			recipe: Recipe{
+				Name:         "Spicy Soup",
+				ForkedFromID: &originalID,
+				ForkedFrom:   &Recipe{Name: "Soup", UserID: 3, Visibility: VisibilityPrivate, Status: RecipeStatusPublished},
+			},
+			viewerID: 4,
+			expected: &forkedFrom{ID: 7},
+		},
+		{
+			name: "own private original",
+			recipe: Recipe{
+				Name:         "Spicy Soup",
+				ForkedFromID: &originalID,
+				ForkedFrom:   &Recipe{Name: "Soup", UserID: 3, Visibility: VisibilityPrivate, Status: RecipeStatusPublished},
+			},
+			viewerID: 3,
+			expected: &forkedFrom{ID: 7, Name: "Soup", UserID: 3},
+		},
+		{
+			name:     "original deleted",
+			recipe:   Recipe{Name: "Spicy Soup", ForkedFromID: &originalID},
+			expected: &forkedFrom{ID: 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.recipe.ToDtoFor(tt.viewerID).(RecipeDto).ForkedFrom
+			if (got == nil) != (tt.expected == nil) || (got != nil && *got != *tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRecipe_ToDto_favorites(t *testing.T) {
+	anonymous := Recipe{FavoriteCount: 3}
+	dto := anonymous.ToDto().(RecipeDto)
+	if dto.FavoriteCount != 3 || dto.Favorited != nil {
+		t.Errorf("expected 3 favorites and no favorited flag, got %d %v", dto.FavoriteCount, dto.Favorited)
+	}
+
+	favorited := true
+	signedIn := Recipe{FavoriteCount: 3, Favorited: &favorited}
+	dto = signedIn.ToDto().(RecipeDto)
+	if dto.Favorited == nil || !*dto.Favorited {
+		t.Errorf("expected favorited flag, got %v", dto.Favorited)
+	}
+}
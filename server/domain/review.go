@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+// Ratings are whole stars from MinRating to MaxRating.
+const (
+	MinRating = 1
+	MaxRating = 5
+)
+
+// Review is a user's star rating of a recipe, with an optional written review.
+// Each user can review a recipe once.
+type Review struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+	RecipeID  uint      `gorm:"not null;uniqueIndex:idx_review_recipe_user"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_review_recipe_user"`
+	Rating    int       `gorm:"not null;check:rating BETWEEN 1 AND 5"`
+	Body      string
+}
+
+// ReviewDto is a DTO for a Review.
+type ReviewDto struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	RecipeID  uint      `json:"recipe"`
+	UserID    uint      `json:"user"`
+	Rating    int       `json:"rating"`
+	Body      string    `json:"body"`
+}
+
+// ToDto converts a Review to a ReviewDto.
+func (r *Review) ToDto() Dto {
+	return ReviewDto{
+		ID:        r.ID,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+		RecipeID:  r.RecipeID,
+		UserID:    r.UserID,
+		Rating:    r.Rating,
+		Body:      r.Body,
+	}
+}
+
+// IsValidRating reports whether rating is a whole number of stars in range.
+func IsValidRating(rating int) bool {
+	return rating >= MinRating && rating <= MaxRating
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "testing"
+
+func TestIsValidRating(t *testing.T) {
+	tests := []struct {
+		rating int
+		valid  bool
+	}{
+		{-1, false},
+		{0, false},
+		{1, true},
+		{3, true},
+		{5, true},
+		{6, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValidRating(tt.rating); got != tt.valid {
+			t.Errorf("rating %d: expected valid %v, got %v", tt.rating, tt.valid, got)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package domain
+
+import "time"
+
+// RecipeSearchDocument is the full-text search index entry for a Recipe.
+// Vector is maintained with raw SQL, so it is never read or written by gorm.
+type RecipeSearchDocument struct {
+	RecipeID uint `gorm:"primaryKey;autoIncrement:false"`
+	// Document is the HTML escaped text that search snippets are cut from.
+	Document  string    `gorm:"not null"`
+	Vector    string    `gorm:"type:tsvector;not null;index:idx_recipe_search_vector,type:gin;->:false;<-:false"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+// RecipeSearchResultDto is a DTO for a single search hit.
+type RecipeSearchResultDto struct {
+	Recipe  RecipeDto `json:"recipe"`
+	Rank    float64   `json:"rank"`
+	Snippet string    `json:"snippet"`
+}
+
+// RecipeSearchResult is a Recipe matched by a search query.
+type RecipeSearchResult struct {
+	Recipe Recipe
+	Rank   float64
+	// Snippet is an excerpt of the matched text with the matching terms wrapped in <mark> tags.
+	Snippet string
+}
+
+// ToDto converts a RecipeSearchResult to a RecipeSearchResultDto for an anonymous viewer.
+func (r *RecipeSearchResult) ToDto() Dto {
+	return r.ToDtoFor(0)
+}
+
+// ToDtoFor converts a RecipeSearchResult to a RecipeSearchResultDto for the user with viewerID.
+func (r *RecipeSearchResult) ToDtoFor(viewerID uint) Dto {
+	return RecipeSearchResultDto{
+		Recipe:  r.Recipe.ToDtoFor(viewerID).(RecipeDto),
+		Rank:    r.Rank,
+		Snippet: r.Snippet,
+	}
+}
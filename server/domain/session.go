@@ -13,4 +13,39 @@ type Session struct {
 	UserID    uint
 	Token     string    `gorm:"index;unique;not null"`
 	ExpiresAt time.Time `gorm:"not null"`
+	// LastSeenAt is when the session was last used. Using a session pushes back ExpiresAt.
+	LastSeenAt time.Time
+	// UserAgent and IPAddress are from the request that signed in, so users can
+	// tell their sessions apart.
+	UserAgent string
+	IPAddress string
+}
+
+// SessionDto is a DTO for a Session. The token is never included.
+type SessionDto struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	// Current is set for the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// ToDto converts a Session to a SessionDto.
+func (s *Session) ToDto() Dto {
+	return SessionDto{
+		ID:         s.ID,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IPAddress,
+	}
+}
+
+// Expired reports whether the session can no longer be used at time now.
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
 }
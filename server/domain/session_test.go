@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSession_Expired(t *testing.T) {
+	now := time.Now()
+
+	tests := map[string]struct {
+		expiresAt time.Time
+		expired   bool
+	}{
+		"not expired":   {now.Add(time.Hour), false},
+		"expires now":   {now, true},
+		"expired":       {now.Add(-time.Hour), true},
+		"never created": {time.Time{}, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			session := Session{ExpiresAt: tt.expiresAt}
+			if got := session.Expired(now); got != tt.expired {
+				t.Errorf("expected %v, got %v", tt.expired, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// ShoppingList is a list of things to buy, usually generated from recipes or a
+// meal plan. The owner can share it with other users, who can then edit it too.
+type ShoppingList struct {
+	ID        uint                 `gorm:"primarykey"`
+	CreatedAt time.Time            `gorm:"not null"`
+	UpdatedAt time.Time            `gorm:"not null"`
+	Name      string               `gorm:"not null"`
+	UserID    uint                 `gorm:"not null;index"`
+	Items     []ShoppingListItem   `gorm:"foreignKey:ShoppingListID"`
+	Members   []ShoppingListMember `gorm:"foreignKey:ShoppingListID"`
+}
+
+// ShoppingListItem is one thing to buy. Items generated from recipes combine
+// every ingredient with the same name and a compatible unit, while manual items
+// are added by hand and never combined.
+type ShoppingListItem struct {
+	ID             uint      `gorm:"primarykey"`
+	CreatedAt      time.Time `gorm:"not null"`
+	UpdatedAt      time.Time `gorm:"not null"`
+	ShoppingListID uint      `gorm:"not null;index"`
+	Name           string    `gorm:"not null"`
+	Quantity       string
+	Unit           string
+	// Amount, AmountMax and CanonicalUnit are parsed from Quantity and Unit, as for Ingredients.
+	Amount        *float64
+	AmountMax     *float64
+	CanonicalUnit string
+	Manual        bool `gorm:"not null;default:false"`
+	Checked       bool `gorm:"not null;default:false"`
+	// RecipeIDs are the recipes the item was generated from.
+	RecipeIDs []uint `gorm:"serializer:json"`
+}
+
+// ShoppingListMember is a user a shopping list has been shared with.
+type ShoppingListMember struct {
+	ShoppingListID uint `gorm:"primaryKey;autoIncrement:false"`
+	UserID         uint `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt      time.Time
+	User           User `gorm:"foreignKey:UserID"`
+}
+
+// ShoppingListDto is a DTO for a ShoppingList.
+// Items and Members are left out when lists are listed.
+type ShoppingListDto struct {
+	ID        uint                   `json:"id"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	Name      string                 `json:"name"`
+	UserID    uint                   `json:"user"`
+	Items     *[]ShoppingListItemDto `json:"items,omitempty"`
+	Members   *[]shoppingListMember  `json:"members,omitempty"`
+}
+
+// ShoppingListItemDto is a DTO for a ShoppingListItem.
+type ShoppingListItemDto struct {
+	ID            uint     `json:"id"`
+	Name          string   `json:"name"`
+	Quantity      string   `json:"quantity"`
+	Unit          string   `json:"unit"`
+	Amount        *float64 `json:"amount,omitempty"`
+	AmountMax     *float64 `json:"amount_max,omitempty"`
+	CanonicalUnit string   `json:"canonical_unit,omitempty"`
+	Manual        bool     `json:"manual"`
+	Checked       bool     `json:"checked"`
+	RecipeIDs     []uint   `json:"recipes"`
+}
+
+type shoppingListMember struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// ToDto converts a ShoppingList to a ShoppingListDto.
+func (s *ShoppingList) ToDto() Dto {
+	dto := ShoppingListDto{
+		ID:        s.ID,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+		Name:      s.Name,
+		UserID:    s.UserID,
+	}
+	if s.Items != nil {
+		items := make([]ShoppingListItemDto, len(s.Items))
+		for i, item := range s.Items {
+			items[i] = item.ToDto().(ShoppingListItemDto)
+		}
+		dto.Items = &items
+	}
+	if s.Members != nil {
+		members := make([]shoppingListMember, len(s.Members))
+		for i, member := range s.Members {
+			members[i] = shoppingListMember{ID: member.UserID, Username: member.User.Username}
+		}
+		dto.Members = &members
+	}
+	return dto
+}
+
+// ToDto converts a ShoppingListItem to a ShoppingListItemDto.
+func (i *ShoppingListItem) ToDto() Dto {
+	recipeIDs := i.RecipeIDs
+	if recipeIDs == nil {
+		recipeIDs = []uint{}
+	}
+	return ShoppingListItemDto{
+		ID:            i.ID,
+		Name:          i.Name,
+		Quantity:      i.Quantity,
+		Unit:          i.Unit,
+		Amount:        i.Amount,
+		AmountMax:     i.AmountMax,
+		CanonicalUnit: i.CanonicalUnit,
+		Manual:        i.Manual,
+		Checked:       i.Checked,
+		RecipeIDs:     recipeIDs,
+	}
+}
+
+// Parse sets the structured amount and unit fields from Quantity and Unit.
+// It must be called whenever Quantity or Unit change.
+func (i *ShoppingListItem) Parse() {
+	ingredient := Ingredient{Quantity: i.Quantity, Unit: i.Unit}
+	ingredient.Parse()
+	i.Amount, i.AmountMax, i.CanonicalUnit = ingredient.Amount, ingredient.AmountMax, ingredient.CanonicalUnit
+}
+
+// HasMember reports whether the user owns the list or it has been shared with them.
+func (s *ShoppingList) HasMember(userID uint) bool {
+	if userID == 0 {
+		return false
+	}
+	if s.UserID == userID {
+		return true
+	}
+	for _, member := range s.Members {
+		if member.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeIngredientName reduces an ingredient name to the form used to match
+// it against other ingredients: lower case, without any preparation notes after
+// a comma or in brackets, and singular, e.g. "Tomatoes, diced" becomes "tomato".
+func NormalizeIngredientName(name string) string {
+	name = strings.ToLower(name)
+	if i := strings.IndexAny(name, ",("); i >= 0 {
+		name = name[:i]
+	}
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return ""
+	}
+
+	last := words[len(words)-1]
+	switch {
+	case strings.HasSuffix(last, "ies") && len(last) > 4:
+		last = strings.TrimSuffix(last, "ies") + "y"
+	case strings.HasSuffix(last, "oes") && len(last) > 4:
+		last = strings.TrimSuffix(last, "es")
+	case strings.HasSuffix(last, "s") && !strings.HasSuffix(last, "ss") && len(last) > 3:
+		last = strings.TrimSuffix(last, "s")
+	}
+	words[len(words)-1] = last
+
+	return strings.Join(words, " ")
+}
+
+// shoppingItemKey groups ingredients that can be added together. Volumes and
+// masses are added in any unit of their dimension, while counted units and
+// unknown units only add up with the same unit.
+type shoppingItemKey struct {
+	name string
+	unit string
+}
+
+// shoppingTotal is a running total of ingredients in base units (millilitres,
+// grams or counts), or in the unit itself for amounts without a known unit.
+type shoppingTotal struct {
+	item     *ShoppingListItem
+	min, max float64
+	// units are the canonical units the ingredients were measured in.
+	units []Unit
+}
+
+// AggregateIngredients combines ingredients into shopping list items. Ingredients
+// with the same normalized name and compatible units are added together, keeping
+// the name the first one was written with. Ingredients whose quantity could not
+// be parsed are listed once per name, quantity and unit. Each item keeps the
+// RecipeIDs of the ingredients that went into it.
+func AggregateIngredients(ingredients []Ingredient) []ShoppingListItem {
+	var order []shoppingItemKey
+	totals := make(map[shoppingItemKey]*shoppingTotal)
+
+	for _, ingredient := range ingredients {
+		name := NormalizeIngredientName(ingredient.Name)
+		if name == "" {
+			continue
+		}
+
+		key := shoppingItemKey{name: name}
+		unit, known := units[ingredient.CanonicalUnit]
+		switch {
+		case ingredient.Amount == nil:
+			// nothing to add up, so only identical lines are combined
+			key.unit = "text:" + strings.ToLower(ingredient.Quantity) + "|" + strings.ToLower(ingredient.Unit)
+		case known && unit.Dimension != DimensionCount:
+			key.unit = string(unit.Dimension)
+		case known:
+			key.unit = "count:" + unit.Name
+		default:
+			key.unit = "unit:" + strings.ToLower(strings.TrimSpace(ingredient.Unit))
+		}
+
+		total, ok := totals[key]
+		if !ok {
+			total = &shoppingTotal{item: &ShoppingListItem{Name: strings.TrimSpace(ingredient.Name)}}
+			if ingredient.Amount == nil {
+				total.item.Quantity = ingredient.Quantity
+				total.item.Unit = ingredient.Unit
+			} else if !known {
+				total.item.Unit = ingredient.Unit
+			}
+			totals[key] = total
+			order = append(order, key)
+		}
+		if ingredient.RecipeID != 0 && !containsID(total.item.RecipeIDs, ingredient.RecipeID) {
+			total.item.RecipeIDs = append(total.item.RecipeIDs, ingredient.RecipeID)
+		}
+		if ingredient.Amount == nil {
+			continue
+		}
+
+		base := 1.0
+		if known {
+			base = unit.Base
+			total.units = append(total.units, unit)
+		}
+		total.min += *ingredient.Amount * base
+		if ingredient.AmountMax != nil {
+			total.max += *ingredient.AmountMax * base
+		} else {
+			total.max += *ingredient.Amount * base
+		}
+	}
+
+	items := make([]ShoppingListItem, 0, len(order))
+	for _, key := range order {
+		total := totals[key]
+		item := total.item
+		if strings.HasPrefix(key.unit, "text:") {
+			items = append(items, *item)
+			continue
+		}
+
+		divisor := 1.0
+		if len(total.units) > 0 {
+			unit := shoppingUnit(total.units, total.min)
+			item.Unit = unit.Name
+			divisor = unit.Base
+		}
+
+		quantity := Quantity{Min: total.min / divisor, Max: total.max / divisor}
+		item.Quantity = quantity.String()
+		item.Parse()
+		items = append(items, *item)
+	}
+	return items
+}
+
+// shoppingUnit picks the unit to show a total in: the largest of the units the
+// ingredients were measured in that the total is at least one of.
+func shoppingUnit(used []Unit, total float64) Unit {
+	best := used[0]
+	for _, unit := range used[1:] {
+		if unit.Base < best.Base {
+			best = unit
+		}
+	}
+	for _, unit := range used {
+		if unit.Base > best.Base && total/unit.Base >= 1 {
+			best = unit
+		}
+	}
+	return best
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package domain
+
+import "testing"
+
+func TestNormalizeIngredientName(t *testing.T) {
+	tests := map[string]string{
+		"Tomatoes, diced":       "tomato",
+		"  Red   Onions ":       "red onion",
+		"berries":               "berry",
+		"flour (sifted)":        "flour",
+		"swiss chard":           "swiss chard",
+		"egg":                   "egg",
+		"Garlic":                "garlic",
+		"unsalted butter, cold": "unsalted butter",
+	}
+
+	for name, want := range tests {
+		if got := NormalizeIngredientName(name); got != want {
+			t.Errorf("%q: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestAggregateIngredients(t *testing.T) {
+	ingredient := func(recipeID uint, quantity, unit, name string) Ingredient {
+		i := Ingredient{Quantity: quantity, Unit: unit, Name: name, RecipeID: recipeID}
+		i.Parse()
+		return i
+	}
+
+	items := AggregateIngredients([]Ingredient{
+		ingredient(1, "1", "cup", "Milk"),
+		ingredient(2, "4", "tbsp", "milk"),
+		ingredient(1, "500", "g", "flour"),
+		ingredient(2, "1", "kg", "Flour, sifted"),
+		ingredient(1, "2", "", "eggs"),
+		ingredient(2, "1", "", "egg"),
+		ingredient(1, "2", "clove", "garlic"),
+		ingredient(2, "1", "can", "garlic"),
+		ingredient(1, "", "", "salt"),
+		ingredient(2, "", "", "Salt"),
+		ingredient(1, "2-3", "", "carrots"),
+		ingredient(2, "1", "", "carrot"),
+	})
+
+	want := []struct {
+		name, quantity, unit string
+		recipes              int
+	}{
+		{"Milk", "1 1/4", "cup", 2},
+		{"flour", "1 1/2", "kg", 2},
+		{"eggs", "3", "", 2},
+		{"garlic", "2", "clove", 1},
+		{"garlic", "1", "can", 1},
+		{"salt", "", "", 2},
+		{"carrots", "3-4", "", 2},
+	}
+
+	if len(items) != len(want) {
+		t.Fatalf("expected %d items, got %d: %+v", len(want), len(items), items)
+	}
+	for i, w := range want {
+		item := items[i]
+		if item.Name != w.name || item.Quantity != w.quantity || item.Unit != w.unit {
+			t.Errorf("item %d: expected %q %q %q, got %q %q %q", i, w.quantity, w.unit, w.name, item.Quantity, item.Unit, item.Name)
+		}
+		if len(item.RecipeIDs) != w.recipes {
+			t.Errorf("item %d: expected %d recipes, got %v", i, w.recipes, item.RecipeIDs)
+		}
+	}
+
+	if items[1].Amount == nil || *items[1].Amount != 1.5 || items[1].CanonicalUnit != "kg" {
+		t.Errorf("expected flour to be parsed as 1.5 kg, got %v %q", items[1].Amount, items[1].CanonicalUnit)
+	}
+}
@@ -0,0 +1,88 @@
+package domain
+
+// RecipeSnapshot is a self-contained copy of a recipe's content, without any
+// database IDs, so it can be written out and restored into another account.
+type RecipeSnapshot struct {
+	Name         string               `json:"name"`
+	Description  string               `json:"description"`
+	CookTime     string               `json:"cook_time"`
+	Servings     int                  `json:"servings"`
+	Ingredients  []IngredientSnapshot `json:"ingredients"`
+	Instructions []string             `json:"instructions"`
+	Tags         []string             `json:"tags"`
+}
+
+// IngredientSnapshot is an ingredient as it appears in a RecipeSnapshot.
+type IngredientSnapshot struct {
+	Quantity string `json:"quantity"`
+	Unit     string `json:"unit"`
+	Name     string `json:"name"`
+}
+
+// Snapshot copies the recipe's content into a RecipeSnapshot. Instructions are
+// expected to already be ordered by step.
+func (r *Recipe) Snapshot() RecipeSnapshot {
+	ingredients := make([]IngredientSnapshot, len(r.Ingredients))
+	for i, ingredient := range r.Ingredients {
+		ingredients[i] = IngredientSnapshot{
+			Quantity: ingredient.Quantity,
+			Unit:     ingredient.Unit,
+			Name:     ingredient.Name,
+		}
+	}
+
+	instructions := make([]string, len(r.Instructions))
+	for i, instruction := range r.Instructions {
+		instructions[i] = instruction.Contents
+	}
+
+	tags := make([]string, len(r.Tags))
+	for i, tag := range r.Tags {
+		tags[i] = tag.Tag
+	}
+
+	return RecipeSnapshot{
+		Name:         r.Name,
+		Description:  r.Description,
+		CookTime:     r.CookTime,
+		Servings:     r.Servings,
+		Ingredients:  ingredients,
+		Instructions: instructions,
+		Tags:         tags,
+	}
+}
+
+// Recipe builds an unsaved Recipe from the snapshot.
+func (s RecipeSnapshot) Recipe() Recipe {
+	ingredients := make([]Ingredient, len(s.Ingredients))
+	for i, ingredient := range s.Ingredients {
+		ingredients[i] = Ingredient{
+			Quantity: ingredient.Quantity,
+			Unit:     ingredient.Unit,
+			Name:     ingredient.Name,
+		}
+	}
+
+	instructions := make([]Instruction, len(s.Instructions))
+	for i, contents := range s.Instructions {
+		instructions[i] = Instruction{
+			Step:     i + 1,
+			Contents: contents,
+		}
+	}
+
+	tags := make([]*Tag, len(s.Tags))
+	for i, tag := range s.Tags {
+		tags[i] = &Tag{Tag: tag}
+	}
+
+	return Recipe{
+		Name:         s.Name,
+		Description:  s.Description,
+		CookTime:     s.CookTime,
+		Servings:     s.Servings,
+		Ingredients:  ingredients,
+		Instructions: instructions,
+		Tags:         tags,
+	}
+}
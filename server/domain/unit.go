@@ -0,0 +1,101 @@
+package domain
+
+import "strings"
+
+// Dimension is what a Unit measures. Only units of the same dimension can be converted between.
+type Dimension string
+
+const (
+	DimensionVolume Dimension = "volume"
+	DimensionMass   Dimension = "mass"
+	DimensionCount  Dimension = "count"
+)
+
+// Unit is an entry in the unit registry.
+type Unit struct {
+	// Name is the canonical name of the unit, e.g. "tbsp".
+	Name      string
+	Dimension Dimension
+	// Base is the size of the unit in millilitres for volumes, grams for masses and 1 for counts.
+	Base float64
+}
+
+// units is the unit registry, keyed by canonical name.
+var units = map[string]Unit{
+	"ml":     {"ml", DimensionVolume, 1},
+	"l":      {"l", DimensionVolume, 1000},
+	"tsp":    {"tsp", DimensionVolume, 4.92892},
+	"tbsp":   {"tbsp", DimensionVolume, 14.7868},
+	"fl oz":  {"fl oz", DimensionVolume, 29.5735},
+	"cup":    {"cup", DimensionVolume, 236.588},
+	"pint":   {"pint", DimensionVolume, 473.176},
+	"quart":  {"quart", DimensionVolume, 946.353},
+	"gallon": {"gallon", DimensionVolume, 3785.41},
+
+	"mg": {"mg", DimensionMass, 0.001},
+	"g":  {"g", DimensionMass, 1},
+	"kg": {"kg", DimensionMass, 1000},
+	"oz": {"oz", DimensionMass, 28.3495},
+	"lb": {"lb", DimensionMass, 453.592},
+
+	"piece":   {"piece", DimensionCount, 1},
+	"clove":   {"clove", DimensionCount, 1},
+	"slice":   {"slice", DimensionCount, 1},
+	"can":     {"can", DimensionCount, 1},
+	"package": {"package", DimensionCount, 1},
+	"bunch":   {"bunch", DimensionCount, 1},
+	"sprig":   {"sprig", DimensionCount, 1},
+	"stick":   {"stick", DimensionCount, 1},
+	"pinch":   {"pinch", DimensionCount, 1},
+	"dash":    {"dash", DimensionCount, 1},
+}
+
+// caseSensitiveUnitAliases are checked before lower-casing, since "T" and "t" differ.
+var caseSensitiveUnitAliases = map[string]string{
+	"T":  "tbsp",
+	"Tb": "tbsp",
+	"t":  "tsp",
+}
+
+// unitAliases maps lower case spellings to canonical unit names.
+var unitAliases = map[string]string{
+	"ml": "ml", "milliliter": "ml", "milliliters": "ml", "millilitre": "ml", "millilitres": "ml",
+	"l": "l", "liter": "l", "liters": "l", "litre": "l", "litres": "l",
+	"tsp": "tsp", "tsps": "tsp", "teaspoon": "tsp", "teaspoons": "tsp",
+	"tbsp": "tbsp", "tbsps": "tbsp", "tbs": "tbsp", "tbl": "tbsp", "tablespoon": "tbsp", "tablespoons": "tbsp",
+	"fl oz": "fl oz", "fl. oz": "fl oz", "floz": "fl oz", "fluid ounce": "fl oz", "fluid ounces": "fl oz",
+	"c": "cup", "cup": "cup", "cups": "cup",
+	"pt": "pint", "pint": "pint", "pints": "pint",
+	"qt": "quart", "quart": "quart", "quarts": "quart",
+	"gal": "gallon", "gallon": "gallon", "gallons": "gallon",
+
+	"mg": "mg", "milligram": "mg", "milligrams": "mg", "milligramme": "mg", "milligrammes": "mg",
+	"g": "g", "gr": "g", "gram": "g", "grams": "g", "gramme": "g", "grammes": "g",
+	"kg": "kg", "kgs": "kg", "kilo": "kg", "kilos": "kg", "kilogram": "kg", "kilograms": "kg",
+	"oz": "oz", "ounce": "oz", "ounces": "oz",
+	"lb": "lb", "lbs": "lb", "pound": "lb", "pounds": "lb",
+
+	"piece": "piece", "pieces": "piece", "pc": "piece", "pcs": "piece",
+	"clove": "clove", "cloves": "clove",
+	"slice": "slice", "slices": "slice",
+	"can": "can", "cans": "can", "tin": "can", "tins": "can",
+	"package": "package", "packages": "package", "pkg": "package", "packet": "package", "packets": "package",
+	"bunch": "bunch", "bunches": "bunch",
+	"sprig": "sprig", "sprigs": "sprig",
+	"stick": "stick", "sticks": "stick",
+	"pinch": "pinch", "pinches": "pinch",
+	"dash": "dash", "dashes": "dash",
+}
+
+// LookupUnit finds a unit in the registry by any of its common spellings, e.g. "Tablespoons" or "tbsp.".
+func LookupUnit(s string) (Unit, bool) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ".")
+	if name, ok := caseSensitiveUnitAliases[s]; ok {
+		return units[name], true
+	}
+	name, ok := unitAliases[strings.Join(strings.Fields(strings.ToLower(s)), " ")]
+	if !ok {
+		return Unit{}, false
+	}
+	return units[name], true
+}
@@ -8,12 +8,17 @@ import (
 // User represents a user in the system.
 type User struct {
 	gorm.Model
-	Username string    `gorm:"unique;not null;uniqueIndex:idx_username"`
-	Password string    `gorm:"not null"`
-	Salt     string    `gorm:"not null"`
-	Sessions []Session `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
-	Recipes  []Recipe  `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
-	Files    []File    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Username string `gorm:"unique;not null;uniqueIndex:idx_username"`
+	Password string `gorm:"not null"`
+	Salt     string `gorm:"not null"`
+	// Email is nil until the user gives an address. It is not verified until
+	// EmailVerifiedAt is set, and changing it clears EmailVerifiedAt. Only
+	// verified addresses are unique, so an unverified one cannot be squatted.
+	Email           *string `gorm:"index;uniqueIndex:idx_users_verified_email,where:email_verified_at IS NOT NULL"`
+	EmailVerifiedAt *time.Time
+	Sessions        []Session `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Recipes         []Recipe  `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Files           []File    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
 }
 
 // UserDto is a DTO for a User.
@@ -49,6 +54,11 @@ func (u *User) ToDto() Dto {
 	}
 }
 
+// EmailVerified reports whether the user has confirmed they own their email address.
+func (u *User) EmailVerified() bool {
+	return u.Email != nil && u.EmailVerifiedAt != nil
+}
+
 func (u User) GetFiles() []FileDto {
 	files := make([]FileDto, len(u.Files))
 	for i, file := range u.Files {
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"time"
+)
+
+// Changes recorded against a RecipeVersion.
+const (
+	VersionChangeCreateRecipe      = "create_recipe"
+	VersionChangeForkRecipe        = "fork_recipe"
+	VersionChangeUpdateRecipe      = "update_recipe"
+	VersionChangeAddIngredient     = "add_ingredient"
+	VersionChangeUpdateIngredient  = "update_ingredient"
+	VersionChangeDeleteIngredient  = "delete_ingredient"
+	VersionChangeAddInstruction    = "add_instruction"
+	VersionChangeUpdateInstruction = "update_instruction"
+	VersionChangeSwapInstructions  = "swap_instructions"
+	VersionChangeDeleteInstruction = "delete_instruction"
+	VersionChangeAddTag            = "add_tag"
+	VersionChangeRemoveTag         = "remove_tag"
+	VersionChangeRestore           = "restore_version"
+	// VersionChangeInitial is recorded for recipes that existed before version history did.
+	VersionChangeInitial = "initial"
+)
+
+// RecipeVersion is an immutable snapshot of a recipe taken after each change to it.
+// Versions are numbered from 1 per recipe.
+type RecipeVersion struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	RecipeID  uint      `gorm:"not null;uniqueIndex:idx_recipe_version"`
+	Version   int       `gorm:"not null;uniqueIndex:idx_recipe_version"`
+	// UserID is the user who made the change.
+	UserID   uint           `gorm:"not null"`
+	Change   string         `gorm:"not null"`
+	Snapshot RecipeSnapshot `gorm:"type:jsonb;serializer:json;not null"`
+}
+
+// RecipeVersionDto is a DTO for a RecipeVersion.
+type RecipeVersionDto struct {
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	UserID    uint            `json:"user"`
+	Change    string          `json:"change"`
+	Recipe    *RecipeSnapshot `json:"recipe,omitempty"`
+}
+
+// ToDto converts a RecipeVersion to a RecipeVersionDto, including the snapshot.
+func (v *RecipeVersion) ToDto() Dto {
+	dto := v.SummaryDto()
+	dto.Recipe = &v.Snapshot
+	return dto
+}
+
+// SummaryDto converts a RecipeVersion to a RecipeVersionDto without the snapshot, for listing.
+func (v *RecipeVersion) SummaryDto() RecipeVersionDto {
+	return RecipeVersionDto{
+		Version:   v.Version,
+		CreatedAt: v.CreatedAt,
+		UserID:    v.UserID,
+		Change:    v.Change,
+	}
+}
@@ -0,0 +1,72 @@
+package domain
+
+import "time"
+
+// Recipe visibilities.
+const (
+	// VisibilityPrivate recipes can only be seen by their owner, or through a share link.
+	VisibilityPrivate = "private"
+	// VisibilityUnlisted recipes can be seen by anyone with the link, but are left out of listings and search.
+	VisibilityUnlisted = "unlisted"
+	// VisibilityPublic recipes can be seen and found by anyone.
+	VisibilityPublic = "public"
+)
+
+// IsValidVisibility reports whether v is one of the recipe visibilities.
+func IsValidVisibility(v string) bool {
+	return v == VisibilityPrivate || v == VisibilityUnlisted || v == VisibilityPublic
+}
+
+// VisibleTo reports whether the user with viewerID can open the recipe directly.
+// A viewerID of 0 is an anonymous viewer. Drafts are only visible to their owner.
+func (r *Recipe) VisibleTo(viewerID uint) bool {
+	if viewerID != 0 && r.UserID == viewerID {
+		return true
+	}
+	return r.Status == RecipeStatusPublished && r.Visibility != VisibilityPrivate
+}
+
+// ListedFor reports whether the recipe should appear in listings and search results shown to viewerID.
+func (r *Recipe) ListedFor(viewerID uint) bool {
+	if viewerID != 0 && r.UserID == viewerID {
+		return true
+	}
+	return r.Status == RecipeStatusPublished && r.Visibility == VisibilityPublic
+}
+
+// RecipeShare grants anyone holding its token read access to a recipe,
+// regardless of the recipe's visibility, until it expires or is revoked.
+type RecipeShare struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	RecipeID  uint      `gorm:"not null;index"`
+	// TokenHash is the SHA-256 of the share token; the token itself is only shown once.
+	TokenHash string `gorm:"not null;uniqueIndex"`
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+}
+
+// RecipeShareDto is a DTO for a RecipeShare.
+// Token is only set in the response that creates the share.
+type RecipeShareDto struct {
+	ID        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Revoked   bool       `json:"revoked"`
+	Token     string     `json:"token,omitempty"`
+}
+
+// ToDto converts a RecipeShare to a RecipeShareDto.
+func (s *RecipeShare) ToDto() Dto {
+	return RecipeShareDto{
+		ID:        s.ID,
+		CreatedAt: s.CreatedAt,
+		ExpiresAt: s.ExpiresAt,
+		Revoked:   s.RevokedAt != nil,
+	}
+}
+
+// Active reports whether the share can still be used at time t.
+func (s *RecipeShare) Active(t time.Time) bool {
+	return s.RevokedAt == nil && (s.ExpiresAt == nil || t.Before(*s.ExpiresAt))
+}
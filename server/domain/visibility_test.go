@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecipe_visibility(t *testing.T) {
+	const owner, other = uint(1), uint(2)
+
+	tests := []struct {
+		visibility string
+		status     string
+		viewer     uint
+		visible    bool
+		listed     bool
+	}{
+		{VisibilityPublic, RecipeStatusPublished, 0, true, true},
+		{VisibilityPublic, RecipeStatusPublished, other, true, true},
+		{VisibilityUnlisted, RecipeStatusPublished, 0, true, false},
+		{VisibilityUnlisted, RecipeStatusPublished, other, true, false},
+		{VisibilityUnlisted, RecipeStatusPublished, owner, true, true},
+		{VisibilityPrivate, RecipeStatusPublished, 0, false, false},
+		{VisibilityPrivate, RecipeStatusPublished, other, false, false},
+		{VisibilityPrivate, RecipeStatusPublished, owner, true, true},
+		{VisibilityPublic, RecipeStatusDraft, 0, false, false},
+		{VisibilityPublic, RecipeStatusDraft, other, false, false},
+		{VisibilityUnlisted, RecipeStatusDraft, other, false, false},
+		{VisibilityPublic, RecipeStatusDraft, owner, true, true},
+	}
+
+	for _, tt := range tests {
+		recipe := Recipe{UserID: owner, Visibility: tt.visibility, Status: tt.status}
+		if got := recipe.VisibleTo(tt.viewer); got != tt.visible {
+			t.Errorf("%s %s recipe, viewer %d: expected visible %v, got %v", tt.status, tt.visibility, tt.viewer, tt.visible, got)
+		}
+		if got := recipe.ListedFor(tt.viewer); got != tt.listed {
+			t.Errorf("%s %s recipe, viewer %d: expected listed %v, got %v", tt.status, tt.visibility, tt.viewer, tt.listed, got)
+		}
+	}
+}
+
+func TestRecipeShare_Active(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := map[string]struct {
+		share  RecipeShare
+		active bool
+	}{
+		"no expiry":   {RecipeShare{}, true},
+		"not expired": {RecipeShare{ExpiresAt: &future}, true},
+		"expired":     {RecipeShare{ExpiresAt: &past}, false},
+		"revoked":     {RecipeShare{RevokedAt: &past}, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.share.Active(now); got != tt.active {
+				t.Errorf("expected %v, got %v", tt.active, got)
+			}
+		})
+	}
+}
+
+func TestRecipe_IsComplete(t *testing.T) {
+	ingredients := []Ingredient{{Name: "bread"}}
+	instructions := []Instruction{{Step: 1, Contents: "Toast the bread."}}
+
+	tests := map[string]struct {
+		recipe   Recipe
+		complete bool
+	}{
+		"empty":           {Recipe{}, false},
+		"no instructions": {Recipe{Ingredients: ingredients}, false},
+		"no ingredients":  {Recipe{Instructions: instructions}, false},
+		"both":            {Recipe{Ingredients: ingredients, Instructions: instructions}, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.recipe.IsComplete(); got != tt.complete {
+				t.Errorf("expected %v, got %v", tt.complete, got)
+			}
+		})
+	}
+}
@@ -4,25 +4,45 @@ import (
 	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/platform/authenticator"
+	"github.com/jacksonopp/go-recipe/platform/mailer"
 	"github.com/jacksonopp/go-recipe/services"
+	"github.com/valyala/fasthttp"
 	"gorm.io/gorm"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// DEFAULT_LOGIN_REDIRECT is where users are sent after signing in with OIDC
+// when the login did not ask for anywhere else.
+const DEFAULT_LOGIN_REDIRECT = "/home"
+
+// OIDC_STATE_COOKIE holds the state of the OIDC login started in the browser.
+const OIDC_STATE_COOKIE = "oidc_state"
+
 type AuthHandler struct {
 	r              fiber.Router
 	authService    services.AuthService
 	sessionService services.SessionService
+	oidcService    services.OIDCService
+	tokenService   services.APITokenService
 	db             *gorm.DB
 }
 
-func NewAuthHandler(r fiber.Router, db *gorm.DB) *AuthHandler {
-	authService := services.NewAuthService(db)
+// NewAuthHandler creates the auth handler. auth may be nil, in which case
+// signing in with OIDC is turned off. Password reset emails are sent with mail
+// and link to appURL.
+func NewAuthHandler(r fiber.Router, db *gorm.DB, auth *authenticator.Authenticator, mail mailer.Mailer, appURL string) *AuthHandler {
+	authService := services.NewAuthService(db, mail, appURL)
 	sessionService := services.NewSessionService(db)
+	oidcService := services.NewOIDCService(db, auth)
+	tokenService := services.NewAPITokenService(db)
 
 	subpath := r.Group("/auth")
 
-	return &AuthHandler{r: subpath, authService: authService, sessionService: sessionService, db: db}
+	return &AuthHandler{r: subpath, authService: authService, sessionService: sessionService, oidcService: oidcService, tokenService: tokenService, db: db}
 }
 
 func (h *AuthHandler) RegisterRoutes() {
@@ -31,12 +51,37 @@ func (h *AuthHandler) RegisterRoutes() {
 	h.r.Get("/session", h.session)
 	h.r.Get("/logout", h.logout)
 	h.r.Get("/current", AuthMiddleware(h.db), h.current)
+
+	// OIDC
+	h.r.Get("/oidc/login", OptionalAuthMiddleware(h.db), h.oidcLogin)
+	h.r.Get("/oidc/callback", h.oidcCallback)
+
+	// Passwords
+	h.r.Post("/password", AuthMiddleware(h.db), h.changePassword)
+	h.r.Post("/password/forgot", h.forgotPassword)
+	h.r.Post("/password/reset", h.resetPassword)
+
+	// Email
+	h.r.Put("/email", AuthMiddleware(h.db), h.changeEmail)
+	h.r.Post("/email/resend", AuthMiddleware(h.db), h.resendVerification)
+	h.r.Post("/email/verify", h.verifyEmail)
+
+	// Sessions
+	h.r.Get("/sessions", AuthMiddleware(h.db), h.getSessions)
+	h.r.Delete("/sessions", AuthMiddleware(h.db), h.deleteOtherSessions)
+	h.r.Delete("/sessions/:id", AuthMiddleware(h.db), h.deleteSession)
+
+	// API tokens
+	h.r.Get("/tokens", AuthMiddleware(h.db), h.getTokens)
+	h.r.Post("/tokens", AuthMiddleware(h.db), h.createToken)
+	h.r.Delete("/tokens/:id", AuthMiddleware(h.db), h.revokeToken)
 }
 
 // POST /auth/register
 func (h *AuthHandler) register(c *fiber.Ctx) error {
 	user := struct {
 		Username        string `json:"username"`
+		Email           string `json:"email"`
 		Password        string `json:"password"`
 		PasswordConfirm string `json:"passwordConfirm"`
 	}{}
@@ -67,11 +112,19 @@ func (h *AuthHandler) register(c *fiber.Ctx) error {
 		Username: user.Username,
 		Password: user.Password,
 	}
+	// the email address is optional, but is needed to publish recipes
+	if user.Email != "" {
+		u.Email = &user.Email
+	}
 
 	if err := h.authService.CreateUser(u); err != nil {
-		if errors.Is(err, services.ErrUserAlreadyExists) {
+		switch {
+		case errors.Is(err, services.ErrUserAlreadyExists):
 			err := Conflict(map[string]string{"username": "username already exists"})
 			return SendError(c, err)
+		case errors.Is(err, services.ErrInvalidEmail):
+			err := UnprocessableEntity(map[string]string{"email": "email is invalid"})
+			return SendError(c, err)
 		}
 
 		log.Printf("error creating user: %v", err)
@@ -110,7 +163,7 @@ func (h *AuthHandler) login(c *fiber.Ctx) error {
 		return SendError(c, err)
 	}
 
-	token, err := h.sessionService.CreateSession(u.ID)
+	token, err := h.sessionService.CreateSession(u.ID, c.Get(fiber.HeaderUserAgent), c.IP())
 	if err != nil {
 		log.Println("error creating session: ", err)
 		return SendError(c, InternalServerError())
@@ -167,5 +220,433 @@ func (h *AuthHandler) current(c *fiber.Ctx) error {
 	if err != nil {
 		return SendError(c, Unauthorized())
 	}
-	return c.JSON(map[string]any{"username": user.Username, "id": user.ID})
+	return c.JSON(map[string]any{
+		"username":       user.Username,
+		"id":             user.ID,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified(),
+	})
+}
+
+// GET /auth/oidc/login?redirect={path}
+// Signed in users link the provider account to their own instead of signing in.
+func (h *AuthHandler) oidcLogin(c *fiber.Ctx) error {
+	// linking adds a way to sign in, which an API token is not enough for
+	linkUserID := getViewerID(c)
+	if linkUserID != 0 {
+		if err := requireSession(c); err != nil {
+			return SendError(c, err.(APIError))
+		}
+	}
+
+	loginURL, state, err := h.oidcService.BeginLogin(linkUserID, safeRedirect(c.Query("redirect")))
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCNotConfigured) {
+			return SendError(c, NotFound(map[string]string{"error": "single sign-on is not configured"}))
+		}
+		log.Println("error starting oidc login: ", err)
+		return SendError(c, InternalServerError())
+	}
+
+	// ties the login to this browser; Lax still sends it on the provider's redirect back
+	c.Cookie(&fiber.Cookie{
+		Name:     OIDC_STATE_COOKIE,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(services.OIDC_LOGIN_TIMEOUT.Seconds()),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return c.Redirect(loginURL, fiber.StatusFound)
+}
+
+// GET /auth/oidc/callback?state={state}&code={code}
+func (h *AuthHandler) oidcCallback(c *fiber.Ctx) error {
+	if providerErr := c.Query("error"); providerErr != "" {
+		log.Println("oidc provider returned error: ", providerErr, c.Query("error_description"))
+		return SendError(c, Unauthorized())
+	}
+
+	// the state is only good for one callback
+	browserState := c.Cookies(OIDC_STATE_COOKIE)
+	c.Cookie(&fiber.Cookie{
+		Name:     OIDC_STATE_COOKIE,
+		Path:     "/",
+		Expires:  fasthttp.CookieExpireDelete,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	user, redirectTo, err := h.oidcService.CompleteLogin(c.Query("state"), browserState, c.Query("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOIDCNotConfigured):
+			return SendError(c, NotFound(map[string]string{"error": "single sign-on is not configured"}))
+		case errors.Is(err, services.ErrOIDCInvalidState):
+			return SendError(c, BadRequest("login expired or was already used, please try again"))
+		case errors.Is(err, services.ErrOIDCIdentityConflict):
+			return SendError(c, Conflict(map[string]string{"identity": "this account is already linked to another user"}))
+		case errors.Is(err, services.ErrOIDCExchange), errors.Is(err, services.ErrOIDCInvalidToken):
+			return SendError(c, Unauthorized())
+		}
+		log.Println("error completing oidc login: ", err)
+		return SendError(c, InternalServerError())
+	}
+
+	token, err := h.sessionService.CreateSession(user.ID, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		log.Println("error creating session: ", err)
+		return SendError(c, InternalServerError())
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:  "session",
+		Value: token,
+	})
+
+	if redirectTo == "" {
+		redirectTo = DEFAULT_LOGIN_REDIRECT
+	}
+	return c.Redirect(redirectTo, fiber.StatusFound)
+}
+
+// POST /auth/password
+// Signs out every other session once the password is changed.
+func (h *AuthHandler) changePassword(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	// an API token is not enough to take over the account
+	if err := requireSession(c); err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	body := struct {
+		CurrentPassword string `json:"currentPassword"`
+		Password        string `json:"password"`
+		PasswordConfirm string `json:"passwordConfirm"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, UnprocessableEntity(map[string]string{"error": "invalid request body"}))
+	}
+
+	if body.Password == "" {
+		return SendError(c, UnprocessableEntity(map[string]string{"password": "password is required"}))
+	}
+	if body.Password != body.PasswordConfirm {
+		return SendError(c, UnprocessableEntity(map[string]string{"password": "passwords do not match"}))
+	}
+
+	err = h.authService.ChangePassword(user.ID, getSessionID(c), body.CurrentPassword, body.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrPasswordMismatch) {
+			return SendError(c, UnprocessableEntity(map[string]string{"currentPassword": "current password is incorrect"}))
+		}
+		log.Println("error changing password: ", err)
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// POST /auth/password/forgot
+// Always accepted, so that it cannot be used to find out which users exist.
+func (h *AuthHandler) forgotPassword(c *fiber.Ctx) error {
+	body := struct {
+		Username string `json:"username"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, UnprocessableEntity(map[string]string{"error": "invalid request body"}))
+	}
+
+	if body.Username == "" {
+		return SendError(c, UnprocessableEntity(map[string]string{"username": "username is required"}))
+	}
+
+	if err := h.authService.RequestPasswordReset(body.Username); err != nil {
+		log.Println("error requesting password reset: ", err)
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// POST /auth/password/reset
+func (h *AuthHandler) resetPassword(c *fiber.Ctx) error {
+	body := struct {
+		Token           string `json:"token"`
+		Password        string `json:"password"`
+		PasswordConfirm string `json:"passwordConfirm"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, UnprocessableEntity(map[string]string{"error": "invalid request body"}))
+	}
+
+	if body.Password == "" {
+		return SendError(c, UnprocessableEntity(map[string]string{"password": "password is required"}))
+	}
+	if body.Password != body.PasswordConfirm {
+		return SendError(c, UnprocessableEntity(map[string]string{"password": "passwords do not match"}))
+	}
+
+	err := h.authService.ResetPassword(body.Token, body.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			return SendError(c, BadRequest("reset link is invalid or has expired, please ask for a new one"))
+		}
+		log.Println("error resetting password: ", err)
+		return SendError(c, InternalServerError())
+	}
+
+	c.ClearCookie("session")
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// PUT /auth/email
+// The new address is unverified until the link sent to it is opened.
+func (h *AuthHandler) changeEmail(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	// an API token is not enough to take over the account
+	if err := requireSession(c); err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	body := struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, UnprocessableEntity(map[string]string{"error": "invalid request body"}))
+	}
+
+	if body.Email == "" {
+		return SendError(c, UnprocessableEntity(map[string]string{"email": "email is required"}))
+	}
+
+	err = h.authService.ChangeEmail(user.ID, body.Password, body.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidEmail):
+			return SendError(c, UnprocessableEntity(map[string]string{"email": "email is invalid"}))
+		case errors.Is(err, services.ErrPasswordMismatch):
+			return SendError(c, UnprocessableEntity(map[string]string{"password": "password is incorrect"}))
+		}
+		log.Println("error changing email: ", err)
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// POST /auth/email/resend
+func (h *AuthHandler) resendVerification(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	err = h.authService.SendVerification(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNoEmail):
+			return SendError(c, UnprocessableEntity(map[string]string{"email": "add an email address first"}))
+		case errors.Is(err, services.ErrEmailAlreadyVerified):
+			return SendError(c, Conflict(map[string]string{"email": "email is already verified"}))
+		}
+		log.Println("error sending email verification: ", err)
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// POST /auth/email/verify
+func (h *AuthHandler) verifyEmail(c *fiber.Ctx) error {
+	body := struct {
+		Token string `json:"token"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, UnprocessableEntity(map[string]string{"error": "invalid request body"}))
+	}
+
+	err := h.authService.VerifyEmail(body.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidVerificationToken):
+			return SendError(c, BadRequest("verification link is invalid or has expired, please ask for a new one"))
+		case errors.Is(err, services.ErrEmailAlreadyExists):
+			return SendError(c, Conflict(map[string]string{"email": "email is already verified on another account"}))
+		}
+		log.Println("error verifying email: ", err)
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GET /auth/sessions
+func (h *AuthHandler) getSessions(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+	if err := requireSession(c); err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	sessions, err := h.sessionService.GetSessions(user.ID)
+	if err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	current := getSessionID(c)
+	dtos := make([]domain.SessionDto, len(sessions))
+	for i, session := range sessions {
+		dtos[i] = session.ToDto().(domain.SessionDto)
+		dtos[i].Current = session.ID == current
+	}
+	return c.JSON(dtos)
+}
+
+// DELETE /auth/sessions
+// Signs out every session except the one making the request.
+func (h *AuthHandler) deleteOtherSessions(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+	if err := requireSession(c); err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	count, err := h.sessionService.DeleteOtherSessions(user.ID, getSessionID(c))
+	if err != nil {
+		return SendError(c, InternalServerError())
+	}
+	return c.JSON(map[string]any{"revoked": count})
+}
+
+// DELETE /auth/sessions/:id
+func (h *AuthHandler) deleteSession(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+	if err := requireSession(c); err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	sessionId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	err = h.sessionService.DeleteSession(user.ID, uint(sessionId))
+	if err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return SendError(c, NotFound(map[string]string{"error": "session not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	if uint(sessionId) == getSessionID(c) {
+		c.ClearCookie("session")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GET /auth/tokens
+func (h *AuthHandler) getTokens(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+	if err := requireSession(c); err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	tokens, err := h.tokenService.GetTokens(user.ID)
+	if err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	dtos := make([]domain.APITokenDto, len(tokens))
+	for i, token := range tokens {
+		dtos[i] = token.ToDto().(domain.APITokenDto)
+	}
+	return c.JSON(dtos)
+}
+
+// POST /auth/tokens
+func (h *AuthHandler) createToken(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+	if err := requireSession(c); err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	body := struct {
+		Name      string     `json:"name"`
+		Scope     string     `json:"scope"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		return SendError(c, UnprocessableEntity(map[string]string{"expires_at": "must be in the future"}))
+	}
+
+	apiToken, token, err := h.tokenService.CreateToken(user.ID, body.Name, body.Scope, body.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAPITokenNameRequired):
+			return SendError(c, UnprocessableEntity(map[string]string{"name": "name is required"}))
+		case errors.Is(err, services.ErrInvalidTokenScope):
+			return SendError(c, UnprocessableEntity(map[string]string{"scope": "scope must be read or write"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	dto := apiToken.ToDto().(domain.APITokenDto)
+	dto.Token = token
+	return c.Status(fiber.StatusCreated).JSON(dto)
+}
+
+// DELETE /auth/tokens/:id
+func (h *AuthHandler) revokeToken(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+	if err := requireSession(c); err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	tokenId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	err = h.tokenService.RevokeToken(user.ID, uint(tokenId))
+	if err != nil {
+		if errors.Is(err, services.ErrAPITokenNotFound) {
+			return SendError(c, NotFound(map[string]string{"error": "token not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// safeRedirect returns path if it is a path on this site, so that logins cannot
+// be used to send users to other sites, and "" otherwise.
+func safeRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.ContainsAny(path, "\\\r\n") {
+		return ""
+	}
+	return path
 }
@@ -21,6 +21,30 @@ func (s *mockUserService) LoginUser(_name, _password string) (*domain.User, erro
 	return nil, nil
 }
 
+func (s *mockUserService) ChangePassword(_userID, _sessionID uint, _currentPassword, _newPassword string) error {
+	return nil
+}
+
+func (s *mockUserService) RequestPasswordReset(_name string) error {
+	return nil
+}
+
+func (s *mockUserService) ResetPassword(_token, _newPassword string) error {
+	return nil
+}
+
+func (s *mockUserService) ChangeEmail(_userID uint, _password, _email string) error {
+	return nil
+}
+
+func (s *mockUserService) SendVerification(_userID uint) error {
+	return nil
+}
+
+func (s *mockUserService) VerifyEmail(_token string) error {
+	return nil
+}
+
 func TestUserHandler_register(t *testing.T) {
 	app := fiber.New()
 	h := AuthHandler{authService: &mockUserService{}, r: app}
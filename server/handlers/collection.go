@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacksonopp/go-recipe/services"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+type CollectionHandler struct {
+	r                 fiber.Router
+	db                *gorm.DB
+	collectionService services.CollectionService
+}
+
+func NewCollectionHandler(r fiber.Router, db *gorm.DB) *CollectionHandler {
+	subpath := r.Group("/collection")
+	collectionService := services.NewCollectionService(db)
+	return &CollectionHandler{r: subpath, db: db, collectionService: collectionService}
+}
+
+func (h *CollectionHandler) RegisterRoutes() {
+	h.r.Post("/", AuthMiddleware(h.db), h.createCollection)
+	h.r.Get("/:id", OptionalAuthMiddleware(h.db), h.getCollection)
+	h.r.Patch("/:id", AuthMiddleware(h.db), h.updateCollection)
+	h.r.Delete("/:id", AuthMiddleware(h.db), h.deleteCollection)
+
+	// RECIPES
+	h.r.Post("/:id/recipe/:recipeId", AuthMiddleware(h.db), h.addRecipe)
+	h.r.Delete("/:id/recipe/hidden", AuthMiddleware(h.db), h.removeHiddenRecipes)
+	h.r.Delete("/:id/recipe/:recipeId", AuthMiddleware(h.db), h.removeRecipe)
+	h.r.Put("/:id/order", AuthMiddleware(h.db), h.reorderRecipes)
+}
+
+type collectionBody struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+}
+
+// POST /collection
+func (h *CollectionHandler) createCollection(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	var body collectionBody
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	collection, err := h.collectionService.CreateCollection(user.ID, body.Name, body.Description, body.Visibility)
+	if err != nil {
+		return sendCollectionError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(collection.ToDtoFor(user.ID))
+}
+
+// GET /collection/:id
+func (h *CollectionHandler) getCollection(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	collection, err := h.collectionService.GetCollection(getViewerID(c), uint(id))
+	if err != nil {
+		return sendCollectionError(c, err)
+	}
+	return c.JSON(collection.ToDtoFor(getViewerID(c)))
+}
+
+// PATCH /collection/:id
+func (h *CollectionHandler) updateCollection(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	var body collectionBody
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	collection, err := h.collectionService.UpdateCollection(user.ID, uint(id), body.Name, body.Description, body.Visibility)
+	if err != nil {
+		return sendCollectionError(c, err)
+	}
+	return c.JSON(collection.ToDtoFor(user.ID))
+}
+
+// DELETE /collection/:id
+func (h *CollectionHandler) deleteCollection(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	if err = h.collectionService.DeleteCollection(user.ID, uint(id)); err != nil {
+		return sendCollectionError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// POST /collection/:id/recipe/:recipeId
+func (h *CollectionHandler) addRecipe(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+	recipeId, err := strconv.Atoi(c.Params("recipeId"))
+	if err != nil {
+		return SendError(c, BadRequest("recipeId must be an integer"))
+	}
+
+	collection, err := h.collectionService.AddRecipeToCollection(user.ID, uint(id), uint(recipeId))
+	if err != nil {
+		return sendCollectionError(c, err)
+	}
+	return c.JSON(collection.ToDtoFor(user.ID))
+}
+
+// DELETE /collection/:id/recipe/:recipeId
+func (h *CollectionHandler) removeRecipe(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+	recipeId, err := strconv.Atoi(c.Params("recipeId"))
+	if err != nil {
+		return SendError(c, BadRequest("recipeId must be an integer"))
+	}
+
+	collection, err := h.collectionService.RemoveRecipeFromCollection(user.ID, uint(id), uint(recipeId))
+	if err != nil {
+		return sendCollectionError(c, err)
+	}
+	return c.JSON(collection.ToDtoFor(user.ID))
+}
+
+// DELETE /collection/:id/recipe/hidden
+func (h *CollectionHandler) removeHiddenRecipes(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	collection, err := h.collectionService.RemoveHiddenRecipes(user.ID, uint(id))
+	if err != nil {
+		return sendCollectionError(c, err)
+	}
+	return c.JSON(collection.ToDtoFor(user.ID))
+}
+
+// PUT /collection/:id/order
+func (h *CollectionHandler) reorderRecipes(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		RecipeIDs []uint `json:"recipe_ids"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	collection, err := h.collectionService.ReorderCollection(user.ID, uint(id), body.RecipeIDs)
+	if err != nil {
+		return sendCollectionError(c, err)
+	}
+	return c.JSON(collection.ToDtoFor(user.ID))
+}
+
+func sendCollectionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrCollectionNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "collection not found"}))
+	case errors.Is(err, services.ErrRecipeNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+	case errors.Is(err, services.ErrCollectionConflict):
+		return SendError(c, Conflict(map[string]string{"recipe": "recipe is already in the collection"}))
+	case errors.Is(err, services.ErrCollectionNameRequired):
+		return SendError(c, UnprocessableEntity(map[string]string{"name": "name is required"}))
+	case errors.Is(err, services.ErrInvalidVisibility):
+		return SendError(c, UnprocessableEntity(map[string]string{"visibility": "must be one of private, unlisted, public"}))
+	case errors.Is(err, services.ErrInvalidCollectionOrder):
+		return SendError(c, UnprocessableEntity(map[string]string{"recipe_ids": "must list every recipe in the collection once"}))
+	case errors.Is(err, services.ErrUnauthorized):
+		return SendError(c, Unauthorized())
+	}
+	return SendError(c, InternalServerError())
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/services"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+type CommentHandler struct {
+	r              fiber.Router
+	db             *gorm.DB
+	commentService services.CommentService
+}
+
+// NewCommentHandler creates a handler for comments. Threads are read and started
+// under /recipe/:id/comments, while single comments are edited under /comment/:id.
+func NewCommentHandler(r fiber.Router, db *gorm.DB) *CommentHandler {
+	commentService := services.NewCommentService(db)
+	return &CommentHandler{r: r, db: db, commentService: commentService}
+}
+
+func (h *CommentHandler) RegisterRoutes() {
+	h.r.Get("/recipe/:id/comments", OptionalAuthMiddleware(h.db), h.getComments)
+	h.r.Post("/recipe/:id/comments", AuthMiddleware(h.db), h.createComment)
+
+	h.r.Patch("/comment/:id", AuthMiddleware(h.db), h.updateComment)
+	h.r.Delete("/comment/:id", AuthMiddleware(h.db), h.deleteComment)
+}
+
+// GET /recipe/:id/comments?instruction={id}
+func (h *CommentHandler) getComments(c *fiber.Ctx) error {
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	var instructionId *uint
+	if q := c.Query("instruction"); q != "" {
+		id, err := strconv.Atoi(q)
+		if err != nil {
+			return SendError(c, BadRequest("instruction must be an integer"))
+		}
+		uid := uint(id)
+		instructionId = &uid
+	}
+
+	comments, err := h.commentService.GetComments(getViewerID(c), uint(recipeId), instructionId)
+	if err != nil {
+		return sendCommentError(c, err)
+	}
+
+	commentDtos := make([]domain.CommentDto, len(comments))
+	for i, comment := range comments {
+		commentDtos[i] = comment.ToDto().(domain.CommentDto)
+	}
+	return c.JSON(commentDtos)
+}
+
+// POST /recipe/:id/comments
+func (h *CommentHandler) createComment(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Body          string `json:"body"`
+		InstructionID *uint  `json:"instruction_id"`
+		ParentID      *uint  `json:"parent_id"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	comment, err := h.commentService.CreateComment(user.ID, uint(recipeId), body.InstructionID, body.ParentID, body.Body)
+	if err != nil {
+		return sendCommentError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(comment.ToDto())
+}
+
+// PATCH /comment/:id
+func (h *CommentHandler) updateComment(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Body string `json:"body"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	comment, err := h.commentService.UpdateComment(user.ID, uint(id), body.Body)
+	if err != nil {
+		return sendCommentError(c, err)
+	}
+	return c.JSON(comment.ToDto())
+}
+
+// DELETE /comment/:id
+func (h *CommentHandler) deleteComment(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	if err = h.commentService.DeleteComment(user.ID, uint(id)); err != nil {
+		return sendCommentError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func sendCommentError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrRecipeNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+	case errors.Is(err, services.ErrInstructionNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "instruction not found"}))
+	case errors.Is(err, services.ErrCommentNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "comment not found"}))
+	case errors.Is(err, services.ErrCommentBodyRequired):
+		return SendError(c, UnprocessableEntity(map[string]string{"body": "required"}))
+	case errors.Is(err, services.ErrUnauthorized):
+		return SendError(c, Unauthorized())
+	}
+	return SendError(c, InternalServerError())
+}
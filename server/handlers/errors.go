@@ -28,6 +28,11 @@ func Unauthorized() APIError {
 	return NewAPIError(401, "Unauthorized")
 }
 
+// Forbidden returns a 403 Forbidden error with the given message.
+func Forbidden(msg string) APIError {
+	return NewAPIError(403, msg)
+}
+
 // NotFound returns a 404 Not Found error with the given message.
 func NotFound(msg map[string]string) APIError {
 	return NewAPIError(404, msg)
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacksonopp/go-recipe/db"
+	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/services"
+	"gorm.io/gorm"
+)
+
+type FeedHandler struct {
+	r             fiber.Router
+	db            *gorm.DB
+	followService services.FollowService
+	recipeService services.RecipeService
+}
+
+func NewFeedHandler(r fiber.Router, db *gorm.DB) *FeedHandler {
+	subpath := r.Group("/feed")
+	followService := services.NewFollowService(db)
+	recipeService := services.NewRecipeService(db)
+	return &FeedHandler{r: subpath, db: db, followService: followService, recipeService: recipeService}
+}
+
+func (h *FeedHandler) RegisterRoutes() {
+	h.r.Get("/", AuthMiddleware(h.db), h.getFeed)
+}
+
+// GET /feed?page={n}&limit={n}
+func (h *FeedHandler) getFeed(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	page, limit := getPaginationParams(c)
+	items, err := h.followService.GetFeed(user.ID, page, limit)
+	if err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	recipes := make([]*domain.Recipe, len(items))
+	for i := range items {
+		recipes[i] = items[i].Recipe
+	}
+	if err := h.recipeService.AnnotateRecipes(user.ID, recipes...); err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	itemDtos := make([]domain.FeedItemDto, len(items))
+	for i, item := range items {
+		itemDtos[i] = item.ToDtoFor(user.ID).(domain.FeedItemDto)
+	}
+
+	page, limit = db.PageBounds(page, limit)
+	return c.JSON(map[string]any{
+		"items": itemDtos,
+		"page":  page,
+		"limit": limit,
+	})
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/services"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+type MealPlanHandler struct {
+	r               fiber.Router
+	db              *gorm.DB
+	mealPlanService services.MealPlanService
+	recipeService   services.RecipeService
+}
+
+func NewMealPlanHandler(r fiber.Router, db *gorm.DB) *MealPlanHandler {
+	subpath := r.Group("/mealplan")
+	mealPlanService := services.NewMealPlanService(db)
+	recipeService := services.NewRecipeService(db)
+	return &MealPlanHandler{r: subpath, db: db, mealPlanService: mealPlanService, recipeService: recipeService}
+}
+
+func (h *MealPlanHandler) RegisterRoutes() {
+	h.r.Get("/", AuthMiddleware(h.db), h.getMealPlan)
+	h.r.Post("/", AuthMiddleware(h.db), h.createEntry)
+	h.r.Post("/copy", AuthMiddleware(h.db), h.copyWeek)
+	h.r.Get("/:id", AuthMiddleware(h.db), h.getEntry)
+	h.r.Patch("/:id", AuthMiddleware(h.db), h.updateEntry)
+	h.r.Delete("/:id", AuthMiddleware(h.db), h.deleteEntry)
+}
+
+// GET /mealplan?from={date}&to={date}
+func (h *MealPlanHandler) getMealPlan(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	from, err := time.Parse(time.DateOnly, c.Query("from"))
+	if err != nil {
+		return SendError(c, BadRequest("from must be a date (YYYY-MM-DD)"))
+	}
+	to, err := time.Parse(time.DateOnly, c.Query("to"))
+	if err != nil {
+		return SendError(c, BadRequest("to must be a date (YYYY-MM-DD)"))
+	}
+
+	entries, err := h.mealPlanService.GetEntries(user.ID, from, to)
+	if err != nil {
+		return sendMealPlanError(c, err)
+	}
+	return h.sendEntries(c, user.ID, entries)
+}
+
+type mealPlanEntryBody struct {
+	Date     string `json:"date"`
+	Slot     string `json:"slot"`
+	RecipeID uint   `json:"recipe_id"`
+	Servings *int   `json:"servings"`
+}
+
+// POST /mealplan
+func (h *MealPlanHandler) createEntry(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	var body mealPlanEntryBody
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+	date, err := time.Parse(time.DateOnly, body.Date)
+	if err != nil {
+		return SendError(c, BadRequest("date must be a date (YYYY-MM-DD)"))
+	}
+
+	entry, err := h.mealPlanService.CreateEntry(user.ID, date, body.Slot, body.RecipeID, body.Servings)
+	if err != nil {
+		return sendMealPlanError(c, err)
+	}
+	if err := h.recipeService.AnnotateRecipes(user.ID, &entry.Recipe); err != nil {
+		return SendError(c, InternalServerError())
+	}
+	return c.Status(fiber.StatusCreated).JSON(entry.ToDto())
+}
+
+// POST /mealplan/copy
+// Copies the week starting on "from" to the week starting on "to", which
+// defaults to the week after.
+func (h *MealPlanHandler) copyWeek(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	body := struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	from, err := time.Parse(time.DateOnly, body.From)
+	if err != nil {
+		return SendError(c, BadRequest("from must be a date (YYYY-MM-DD)"))
+	}
+	to := from.AddDate(0, 0, 7)
+	if body.To != "" {
+		if to, err = time.Parse(time.DateOnly, body.To); err != nil {
+			return SendError(c, BadRequest("to must be a date (YYYY-MM-DD)"))
+		}
+	}
+
+	entries, err := h.mealPlanService.CopyWeek(user.ID, from, to)
+	if err != nil {
+		return sendMealPlanError(c, err)
+	}
+	c.Status(fiber.StatusCreated)
+	return h.sendEntries(c, user.ID, entries)
+}
+
+// GET /mealplan/:id
+func (h *MealPlanHandler) getEntry(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	entry, err := h.mealPlanService.GetEntry(user.ID, uint(id))
+	if err != nil {
+		return sendMealPlanError(c, err)
+	}
+	if err := h.recipeService.AnnotateRecipes(user.ID, &entry.Recipe); err != nil {
+		return SendError(c, InternalServerError())
+	}
+	return c.JSON(entry.ToDto())
+}
+
+// PATCH /mealplan/:id
+// A servings of 0 goes back to the recipe's own servings.
+func (h *MealPlanHandler) updateEntry(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Date     *string `json:"date"`
+		Slot     *string `json:"slot"`
+		Servings *int    `json:"servings"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	update := services.MealPlanEntryUpdate{Slot: body.Slot, Servings: body.Servings}
+	if body.Date != nil {
+		date, err := time.Parse(time.DateOnly, *body.Date)
+		if err != nil {
+			return SendError(c, BadRequest("date must be a date (YYYY-MM-DD)"))
+		}
+		update.Date = &date
+	}
+
+	entry, err := h.mealPlanService.UpdateEntry(user.ID, uint(id), update)
+	if err != nil {
+		return sendMealPlanError(c, err)
+	}
+	if err := h.recipeService.AnnotateRecipes(user.ID, &entry.Recipe); err != nil {
+		return SendError(c, InternalServerError())
+	}
+	return c.JSON(entry.ToDto())
+}
+
+// DELETE /mealplan/:id
+func (h *MealPlanHandler) deleteEntry(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	if err = h.mealPlanService.DeleteEntry(user.ID, uint(id)); err != nil {
+		return sendMealPlanError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *MealPlanHandler) sendEntries(c *fiber.Ctx, userID uint, entries []domain.MealPlanEntry) error {
+	recipes := make([]*domain.Recipe, len(entries))
+	for i := range entries {
+		recipes[i] = &entries[i].Recipe
+	}
+	if err := h.recipeService.AnnotateRecipes(userID, recipes...); err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	entryDtos := make([]domain.MealPlanEntryDto, len(entries))
+	for i, entry := range entries {
+		entryDtos[i] = entry.ToDto().(domain.MealPlanEntryDto)
+	}
+	return c.JSON(entryDtos)
+}
+
+func sendMealPlanError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrRecipeNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+	case errors.Is(err, services.ErrMealPlanEntryNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "meal plan entry not found"}))
+	case errors.Is(err, services.ErrInvalidMealSlot):
+		return SendError(c, UnprocessableEntity(map[string]string{"slot": "must be one of breakfast, lunch, dinner, snack"}))
+	case errors.Is(err, services.ErrInvalidServings):
+		return SendError(c, UnprocessableEntity(map[string]string{"servings": "must be a positive integer"}))
+	case errors.Is(err, services.ErrInvalidDateRange):
+		return SendError(c, BadRequest("invalid date range"))
+	}
+	return SendError(c, InternalServerError())
+}
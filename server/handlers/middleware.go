@@ -3,11 +3,54 @@ package handlers
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/services"
 	"gorm.io/gorm"
+	"io"
+	"log"
+	"slices"
+	"strings"
 )
 
+// BodyLimitMiddleware reads request bodies of up to limit bytes, and rejects
+// larger ones. The app streams request bodies, so without it a handler would
+// read a body of any size. Routes in streamed read their body themselves.
+func BodyLimitMiddleware(limit int, streamed ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !c.Request().IsBodyStream() || slices.Contains(streamed, c.Path()) {
+			return c.Next()
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Context().RequestBodyStream(), int64(limit)+1))
+		if err != nil {
+			return SendError(c, BadRequest("invalid request body"))
+		}
+		if len(body) > limit {
+			// the rest of the body was not read, so the connection cannot be reused
+			c.Context().SetConnectionClose()
+			return SendError(c, NewAPIError(fiber.StatusRequestEntityTooLarge, "request body is too large"))
+		}
+		c.Request().SetBody(body)
+		return c.Next()
+	}
+}
+
+// AuthMiddleware passes the user to the next handler, and rejects the request
+// unless it has a valid session cookie or API token.
 func AuthMiddleware(db *gorm.DB) fiber.Handler {
+	apiTokenService := services.NewAPITokenService(db)
+	sessionService := services.NewSessionService(db)
+
 	return func(c *fiber.Ctx) error {
+		// API tokens are sent in the Authorization header
+		if token, ok := bearerToken(c); ok {
+			user, err := getUserByAPIToken(c, apiTokenService, token)
+			if err != nil {
+				return SendError(c, err.(APIError))
+			}
+			c.Locals("user", user)
+			return c.Next()
+		}
+
 		// Get the token from the header
 		sessionCookie := struct {
 			Session string `cookie:"session"`
@@ -23,24 +66,70 @@ func AuthMiddleware(db *gorm.DB) fiber.Handler {
 			return SendError(c, Unauthorized())
 		}
 
-		user, err := getUserBySessionToken(db, token)
+		user, session, err := sessionService.Authenticate(token)
 		if err != nil {
 			return SendError(c, Unauthorized())
 		}
 
 		// Pass the user to the next handler
 		c.Locals("user", user)
+		c.Locals("session", session)
+		return c.Next()
+	}
+}
+
+// OptionalAuthMiddleware passes the user to the next handler when the request
+// has a valid session, and lets anonymous requests through otherwise.
+// Requests with an API token that cannot be used are still rejected, so that
+// scripts find out rather than quietly getting anonymous results.
+func OptionalAuthMiddleware(db *gorm.DB) fiber.Handler {
+	apiTokenService := services.NewAPITokenService(db)
+	sessionService := services.NewSessionService(db)
+
+	return func(c *fiber.Ctx) error {
+		if token, ok := bearerToken(c); ok {
+			user, err := getUserByAPIToken(c, apiTokenService, token)
+			if err != nil {
+				return SendError(c, err.(APIError))
+			}
+			c.Locals("user", user)
+			return c.Next()
+		}
+
+		token := c.Cookies("session")
+		if token == "" {
+			return c.Next()
+		}
+
+		user, session, err := sessionService.Authenticate(token)
+		if err == nil {
+			c.Locals("user", user)
+			c.Locals("session", session)
+		}
 		return c.Next()
 	}
 }
 
-func getUserBySessionToken(db *gorm.DB, token string) (*domain.User, error) {
-	var user domain.User
-	err := db.Table("users").
-		Joins("inner join sessions on users.id = sessions.user_id").
-		Where("sessions.token = ?", token).
-		Where("sessions.deleted_at is null").
-		First(&user).
-		Error
-	return &user, err
+// getUserByAPIToken returns the user an API token belongs to, as long as the
+// token's scope allows the request.
+func getUserByAPIToken(c *fiber.Ctx, apiTokenService services.APITokenService, token string) (*domain.User, error) {
+	user, apiToken, err := apiTokenService.Authenticate(token)
+	if err != nil {
+		log.Println("error authenticating api token: ", err)
+		return nil, Unauthorized()
+	}
+	if !apiToken.Allows(c.Method()) {
+		return nil, Forbidden("api token does not have the write scope")
+	}
+	return user, nil
+}
+
+// bearerToken returns the token in the request's "Authorization: Bearer" header, if there is one.
+func bearerToken(c *fiber.Ctx) (string, bool) {
+	scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
 }
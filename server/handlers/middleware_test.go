@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testAPIToken = "grt_0123456789abcdefghijklmnopqrstuvwxyzABCD"
+
+func mockDb(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn, DriverName: "postgres"}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
+
+// expectAPIToken expects testAPIToken to be looked up, and found with scope
+// if scope is not empty.
+func expectAPIToken(mock sqlmock.Sqlmock, scope string) {
+	sum := sha256.Sum256([]byte(testAPIToken))
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "scope", "token_hash", "last_used_at"})
+	if scope != "" {
+		rows.AddRow(1, 1, "script", scope, hex.EncodeToString(sum[:]), time.Now())
+	}
+	mock.ExpectQuery(`SELECT \* FROM "api_tokens"`).WillReturnRows(rows)
+	if scope != "" {
+		mock.ExpectQuery(`SELECT \* FROM "users"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(1, "cook"))
+	}
+}
+
+// viewerApp returns an app that responds to GET and POST / with the viewer's ID.
+func viewerApp(middleware fiber.Handler) *fiber.App {
+	app := fiber.New()
+	viewer := func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(int(getViewerID(c))))
+	}
+	app.Get("/", middleware, viewer)
+	app.Post("/", middleware, viewer)
+	return app
+}
+
+func TestAuthMiddleware_apiToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		auth           string
+		scope          string
+		expectedStatus int
+	}{
+		{"read token reading", fiber.MethodGet, "Bearer " + testAPIToken, domain.TokenScopeRead, fiber.StatusOK},
+		{"read token writing", fiber.MethodPost, "Bearer " + testAPIToken, domain.TokenScopeRead, fiber.StatusForbidden},
+		{"write token writing", fiber.MethodPost, "Bearer " + testAPIToken, domain.TokenScopeWrite, fiber.StatusOK},
+		{"unknown token", fiber.MethodGet, "Bearer " + testAPIToken, "", fiber.StatusUnauthorized},
+		{"no token", fiber.MethodGet, "", "", fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := mockDb(t)
+			if tt.auth != "" {
+				expectAPIToken(mock, tt.scope)
+			}
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.auth != "" {
+				req.Header.Set(fiber.HeaderAuthorization, tt.auth)
+			}
+			res, err := viewerApp(AuthMiddleware(db)).Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, res.StatusCode)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOptionalAuthMiddleware_apiToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		auth           string
+		scope          string
+		expectedStatus int
+	}{
+		{"anonymous", fiber.MethodGet, "", "", fiber.StatusOK},
+		{"read token reading", fiber.MethodGet, "Bearer " + testAPIToken, domain.TokenScopeRead, fiber.StatusOK},
+		{"read token writing", fiber.MethodPost, "Bearer " + testAPIToken, domain.TokenScopeRead, fiber.StatusForbidden},
+		// scripts find out their token is bad rather than getting anonymous results
+		{"unknown token", fiber.MethodGet, "Bearer " + testAPIToken, "", fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := mockDb(t)
+			if tt.auth != "" {
+				expectAPIToken(mock, tt.scope)
+			}
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.auth != "" {
+				req.Header.Set(fiber.HeaderAuthorization, tt.auth)
+			}
+			res, err := viewerApp(OptionalAuthMiddleware(db)).Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, res.StatusCode)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// mockOIDCService records the logins that were started.
+type mockOIDCService struct {
+	linkUserIDs []uint
+}
+
+func (s *mockOIDCService) BeginLogin(linkUserID uint, _ string) (string, string, error) {
+	s.linkUserIDs = append(s.linkUserIDs, linkUserID)
+	return "https://provider.example.com/authorize", "state", nil
+}
+
+func (s *mockOIDCService) CompleteLogin(_, _, _ string) (*domain.User, string, error) {
+	return nil, "", nil
+}
+
+func TestAuthHandler_oidcLogin_apiToken(t *testing.T) {
+	db, mock := mockDb(t)
+	oidc := &mockOIDCService{}
+	h := &AuthHandler{db: db, oidcService: oidc}
+
+	app := fiber.New()
+	app.Get("/auth/oidc/login", OptionalAuthMiddleware(db), h.oidcLogin)
+
+	// a read token passes the scope check for a GET, but must not link an account
+	expectAPIToken(mock, domain.TokenScopeRead)
+	req := httptest.NewRequest(fiber.MethodGet, "/auth/oidc/login", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+testAPIToken)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected status %d, got %d", fiber.StatusForbidden, res.StatusCode)
+	}
+	if len(oidc.linkUserIDs) != 0 {
+		t.Errorf("expected no login to be started, got links to %v", oidc.linkUserIDs)
+	}
+
+	// signing in anonymously still works
+	res, err = app.Test(httptest.NewRequest(fiber.MethodGet, "/auth/oidc/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != fiber.StatusFound {
+		t.Errorf("expected status %d, got %d", fiber.StatusFound, res.StatusCode)
+	}
+	if len(oidc.linkUserIDs) != 1 || oidc.linkUserIDs[0] != 0 {
+		t.Errorf("expected one sign in without a link, got %v", oidc.linkUserIDs)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
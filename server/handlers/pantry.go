@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/services"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+type PantryHandler struct {
+	r             fiber.Router
+	db            *gorm.DB
+	pantryService services.PantryService
+}
+
+func NewPantryHandler(r fiber.Router, db *gorm.DB) *PantryHandler {
+	subpath := r.Group("/pantry")
+	pantryService := services.NewPantryService(db)
+	return &PantryHandler{r: subpath, db: db, pantryService: pantryService}
+}
+
+func (h *PantryHandler) RegisterRoutes() {
+	h.r.Get("/", AuthMiddleware(h.db), h.getPantry)
+	h.r.Post("/", AuthMiddleware(h.db), h.addItem)
+	h.r.Patch("/:id", AuthMiddleware(h.db), h.updateItem)
+	h.r.Delete("/:id", AuthMiddleware(h.db), h.deleteItem)
+}
+
+// GET /pantry
+func (h *PantryHandler) getPantry(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	items, err := h.pantryService.GetItems(user.ID)
+	if err != nil {
+		return sendPantryError(c, err)
+	}
+
+	itemDtos := make([]domain.PantryItemDto, len(items))
+	for i, item := range items {
+		itemDtos[i] = item.ToDto().(domain.PantryItemDto)
+	}
+	return c.JSON(itemDtos)
+}
+
+// POST /pantry
+func (h *PantryHandler) addItem(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	body := struct {
+		Name      string `json:"name"`
+		Quantity  string `json:"quantity"`
+		Unit      string `json:"unit"`
+		ExpiresAt string `json:"expires_at"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	var expiresAt *time.Time
+	if body.ExpiresAt != "" {
+		date, err := time.Parse(time.DateOnly, body.ExpiresAt)
+		if err != nil {
+			return SendError(c, BadRequest("expires_at must be a date (YYYY-MM-DD)"))
+		}
+		expiresAt = &date
+	}
+
+	item, err := h.pantryService.AddItem(user.ID, body.Name, body.Quantity, body.Unit, expiresAt)
+	if err != nil {
+		return sendPantryError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(item.ToDto())
+}
+
+// PATCH /pantry/:id
+// An empty expires_at removes the expiry date.
+func (h *PantryHandler) updateItem(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Name      *string `json:"name"`
+		Quantity  *string `json:"quantity"`
+		Unit      *string `json:"unit"`
+		ExpiresAt *string `json:"expires_at"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	update := services.PantryItemUpdate{Name: body.Name, Quantity: body.Quantity, Unit: body.Unit}
+	if body.ExpiresAt != nil {
+		if *body.ExpiresAt == "" {
+			update.ClearExpiresAt = true
+		} else {
+			date, err := time.Parse(time.DateOnly, *body.ExpiresAt)
+			if err != nil {
+				return SendError(c, BadRequest("expires_at must be a date (YYYY-MM-DD)"))
+			}
+			update.ExpiresAt = &date
+		}
+	}
+
+	item, err := h.pantryService.UpdateItem(user.ID, uint(id), update)
+	if err != nil {
+		return sendPantryError(c, err)
+	}
+	return c.JSON(item.ToDto())
+}
+
+// DELETE /pantry/:id
+func (h *PantryHandler) deleteItem(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	if err = h.pantryService.DeleteItem(user.ID, uint(id)); err != nil {
+		return sendPantryError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func sendPantryError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrPantryItemNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "pantry item not found"}))
+	case errors.Is(err, services.ErrPantryItemNameRequired):
+		return SendError(c, UnprocessableEntity(map[string]string{"name": "required"}))
+	}
+	return SendError(c, InternalServerError())
+}
@@ -3,32 +3,86 @@ package handlers
 import (
 	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/jacksonopp/go-recipe/db"
 	"github.com/jacksonopp/go-recipe/domain"
 	"github.com/jacksonopp/go-recipe/services"
 	"gorm.io/gorm"
+	"io"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type RecipeHandler struct {
 	r             fiber.Router
 	db            *gorm.DB
 	recipeService services.RecipeService
+	searchService services.SearchService
+	importService services.ImportService
+	exportService services.ExportService
+	pantryService services.PantryService
 }
 
 func NewRecipeHandler(r fiber.Router, db *gorm.DB) *RecipeHandler {
 	subpath := r.Group("/recipe")
 	recipeService := services.NewRecipeService(db)
-
-	return &RecipeHandler{r: subpath, db: db, recipeService: recipeService}
+	searchService := services.NewSearchService(db)
+	importService := services.NewImportService(db)
+	exportService := services.NewExportService(db)
+	pantryService := services.NewPantryService(db)
+
+	return &RecipeHandler{
+		r:             subpath,
+		db:            db,
+		recipeService: recipeService,
+		searchService: searchService,
+		importService: importService,
+		exportService: exportService,
+		pantryService: pantryService,
+	}
 }
 
 func (h *RecipeHandler) RegisterRoutes() {
 	// RECIPES
 	h.r.Post("/", AuthMiddleware(h.db), h.createRecipe)
-	h.r.Get("/:id", h.getRecipeById)
+	h.r.Get("/", OptionalAuthMiddleware(h.db), h.getRecipes)
+	h.r.Get("/search", OptionalAuthMiddleware(h.db), h.searchRecipes)
+	h.r.Get("/cookable", AuthMiddleware(h.db), h.getCookableRecipes)
+	h.r.Post("/import/preview", AuthMiddleware(h.db), h.previewImport)
+	h.r.Post("/import", AuthMiddleware(h.db), h.importRecipe)
+	h.r.Get("/:id", OptionalAuthMiddleware(h.db), h.getRecipeById)
 	h.r.Patch("/:id", AuthMiddleware(h.db), h.updateRecipe)
 	h.r.Delete("/:id", AuthMiddleware(h.db), h.deleteRecipe)
+	h.r.Get("/:id/export", OptionalAuthMiddleware(h.db), h.exportRecipe)
+	h.r.Post("/:id/fork", AuthMiddleware(h.db), h.forkRecipe)
+	h.r.Get("/:id/forks", AuthMiddleware(h.db), h.getRecipeForks)
+
+	// FAVORITES
+	h.r.Put("/:id/favorite", AuthMiddleware(h.db), h.favoriteRecipe)
+	h.r.Delete("/:id/favorite", AuthMiddleware(h.db), h.unfavoriteRecipe)
+
+	// REVIEWS
+	h.r.Get("/:id/reviews", OptionalAuthMiddleware(h.db), h.getReviews)
+	h.r.Post("/:id/review", AuthMiddleware(h.db), h.createReview)
+	h.r.Patch("/:id/review", AuthMiddleware(h.db), h.updateReview)
+	h.r.Delete("/:id/review", AuthMiddleware(h.db), h.deleteReview)
+
+	// PUBLISHING
+	h.r.Post("/:id/publish", AuthMiddleware(h.db), h.publishRecipe)
+	h.r.Post("/:id/unpublish", AuthMiddleware(h.db), h.unpublishRecipe)
+
+	// VISIBILITY
+	h.r.Put("/:id/visibility", AuthMiddleware(h.db), h.setVisibility)
+	h.r.Post("/:id/share", AuthMiddleware(h.db), h.createShare)
+	h.r.Get("/:id/shares", AuthMiddleware(h.db), h.getShares)
+	h.r.Delete("/:id/share/:shareId", AuthMiddleware(h.db), h.revokeShare)
+
+	// VERSIONS
+	h.r.Get("/:id/versions", OptionalAuthMiddleware(h.db), h.getRecipeVersions)
+	h.r.Get("/:id/versions/diff", OptionalAuthMiddleware(h.db), h.diffRecipeVersions)
+	h.r.Get("/:id/versions/:version", OptionalAuthMiddleware(h.db), h.getRecipeVersion)
+	h.r.Post("/:id/versions/:version/restore", AuthMiddleware(h.db), h.restoreRecipeVersion)
 
 	// INGREDIENTS
 	h.r.Post("/:id/ingredient", AuthMiddleware(h.db), h.createIngredient)
@@ -98,7 +152,257 @@ func (h *RecipeHandler) createRecipe(c *fiber.Ctx) error {
 	return c.JSON(r.ToDto())
 }
 
-// GET /recipe/:id
+// GET /recipe?tags={id,id}&user={id}&min_servings={n}&max_servings={n}&created_after={date}&created_before={date}&sort={name|created_at}&order={asc|desc}&page={n}&limit={n}
+func (h *RecipeHandler) getRecipes(c *fiber.Ctx) error {
+	page, limit := getPaginationParams(c)
+	filter := services.RecipeFilter{
+		ViewerID: getViewerID(c),
+		Sort:     c.Query("sort", services.RecipeSortCreatedAt),
+		Page:     page,
+		Limit:    limit,
+	}
+
+	if !services.IsValidRecipeSort(filter.Sort) {
+		return SendError(c, BadRequest("sort must be one of name, created_at"))
+	}
+
+	switch c.Query("order") {
+	case "":
+		// newest first unless sorting alphabetically
+		filter.Desc = filter.Sort == services.RecipeSortCreatedAt
+	case "asc":
+		filter.Desc = false
+	case "desc":
+		filter.Desc = true
+	default:
+		return SendError(c, BadRequest("order must be one of asc, desc"))
+	}
+
+	var err error
+	if tags := c.Query("tags"); tags != "" {
+		if filter.TagIDs, err = parseIDList(tags); err != nil {
+			return SendError(c, BadRequest("tags must be a comma separated list of integers"))
+		}
+	}
+
+	if user := c.Query("user"); user != "" {
+		userID, err := strconv.Atoi(user)
+		if err != nil {
+			return SendError(c, BadRequest("user must be an integer"))
+		}
+		filter.UserID = uint(userID)
+	}
+
+	if filter.MinServings, err = queryInt(c, "min_servings"); err != nil {
+		return SendError(c, BadRequest("min_servings must be an integer"))
+	}
+	if filter.MaxServings, err = queryInt(c, "max_servings"); err != nil {
+		return SendError(c, BadRequest("max_servings must be an integer"))
+	}
+
+	if filter.CreatedAfter, err = queryTime(c, "created_after"); err != nil {
+		return SendError(c, BadRequest("created_after must be a date (YYYY-MM-DD) or RFC 3339 timestamp"))
+	}
+	if filter.CreatedBefore, err = queryTime(c, "created_before"); err != nil {
+		return SendError(c, BadRequest("created_before must be a date (YYYY-MM-DD) or RFC 3339 timestamp"))
+	}
+
+	recipes, total, err := h.recipeService.GetRecipes(filter)
+	if err != nil {
+		log.Println("error getting recipes", err)
+		return SendError(c, InternalServerError())
+	}
+
+	if err := h.recipeService.AnnotateRecipes(getViewerID(c), recipePointers(recipes)...); err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	recipeDtos := make([]domain.RecipeDto, len(recipes))
+	for i, recipe := range recipes {
+		recipeDtos[i] = recipe.ToDtoFor(getViewerID(c)).(domain.RecipeDto)
+	}
+
+	page, limit = db.PageBounds(page, limit)
+	return c.JSON(map[string]any{
+		"recipes": recipeDtos,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// GET /recipe/cookable?max_missing={n}&page={n}&limit={n}
+func (h *RecipeHandler) getCookableRecipes(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	page, limit := getPaginationParams(c)
+	maxMissing := -1
+	if c.Query("max_missing") != "" {
+		if maxMissing, err = queryInt(c, "max_missing"); err != nil || maxMissing < 0 {
+			return SendError(c, BadRequest("max_missing must be a non-negative integer"))
+		}
+	}
+
+	cookable, total, err := h.pantryService.GetCookableRecipes(user.ID, maxMissing, page, limit)
+	if err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	recipes := make([]*domain.Recipe, len(cookable))
+	for i := range cookable {
+		recipes[i] = &cookable[i].Recipe
+	}
+	if err := h.recipeService.AnnotateRecipes(user.ID, recipes...); err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	cookableDtos := make([]domain.CookableRecipeDto, len(cookable))
+	for i, recipe := range cookable {
+		cookableDtos[i] = recipe.ToDtoFor(user.ID).(domain.CookableRecipeDto)
+	}
+
+	page, limit = db.PageBounds(page, limit)
+	return c.JSON(map[string]any{
+		"recipes": cookableDtos,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// GET /recipe/search?q={query}&page={n}&limit={n}
+func (h *RecipeHandler) searchRecipes(c *fiber.Ctx) error {
+	page, limit := getPaginationParams(c)
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return SendError(c, BadRequest("q is required"))
+	}
+
+	results, total, err := h.searchService.Search(query, getViewerID(c), page, limit)
+	if err != nil {
+		log.Println("error searching recipes", err)
+		return SendError(c, InternalServerError())
+	}
+
+	resultRecipes := make([]*domain.Recipe, len(results))
+	for i := range results {
+		resultRecipes[i] = &results[i].Recipe
+	}
+	if err := h.recipeService.AnnotateRecipes(getViewerID(c), resultRecipes...); err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	resultDtos := make([]domain.RecipeSearchResultDto, len(results))
+	for i, result := range results {
+		resultDtos[i] = result.ToDtoFor(getViewerID(c)).(domain.RecipeSearchResultDto)
+	}
+
+	page, limit = db.PageBounds(page, limit)
+	return c.JSON(map[string]any{
+		"results": resultDtos,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// POST /recipe/import/preview
+func (h *RecipeHandler) previewImport(c *fiber.Ctx) error {
+	recipe, apiErr := h.parseImport(c)
+	if apiErr != nil {
+		return SendError(c, *apiErr)
+	}
+
+	return c.JSON(recipe.ToDto())
+}
+
+// POST /recipe/import
+func (h *RecipeHandler) importRecipe(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipe, apiErr := h.parseImport(c)
+	if apiErr != nil {
+		return SendError(c, *apiErr)
+	}
+
+	created, err := h.importService.Import(user.ID, recipe)
+	if err != nil {
+		log.Println("error importing recipe", err)
+		return SendError(c, InternalServerError())
+	}
+
+	return c.JSON(created.ToDto())
+}
+
+// parseImport extracts a recipe from an uploaded "file", or from the "url" or "html" of a JSON body.
+func (h *RecipeHandler) parseImport(c *fiber.Ctx) (*domain.Recipe, *APIError) {
+	var (
+		recipe *domain.Recipe
+		err    error
+	)
+
+	if file, fileErr := c.FormFile("file"); fileErr == nil {
+		f, openErr := file.Open()
+		if openErr != nil {
+			apiErr := BadRequest("invalid file")
+			return nil, &apiErr
+		}
+		defer f.Close()
+
+		page, readErr := io.ReadAll(io.LimitReader(f, services.MAX_IMPORT_SIZE))
+		if readErr != nil {
+			apiErr := BadRequest("invalid file")
+			return nil, &apiErr
+		}
+		recipe, err = h.importService.PreviewHTML(page)
+	} else {
+		body := struct {
+			Url  string `json:"url"`
+			Html string `json:"html"`
+		}{}
+
+		if parseErr := c.BodyParser(&body); parseErr != nil {
+			apiErr := UnprocessableEntity(map[string]string{"error": "invalid request body"})
+			return nil, &apiErr
+		}
+
+		switch {
+		case body.Url != "":
+			recipe, err = h.importService.PreviewURL(body.Url)
+		case body.Html != "":
+			recipe, err = h.importService.PreviewHTML([]byte(body.Html))
+		default:
+			apiErr := UnprocessableEntity(map[string]string{"error": "file, url or html is required"})
+			return nil, &apiErr
+		}
+	}
+
+	if err != nil {
+		var apiErr APIError
+		switch {
+		case errors.Is(err, services.ErrInvalidImportUrl):
+			apiErr = UnprocessableEntity(map[string]string{"url": "url must be an absolute http or https url"})
+		case errors.Is(err, services.ErrImportFetch):
+			apiErr = UnprocessableEntity(map[string]string{"url": "could not fetch url"})
+		case errors.Is(err, services.ErrNoRecipeInPage):
+			apiErr = UnprocessableEntity(map[string]string{"error": "no schema.org recipe found in page"})
+		default:
+			log.Println("error parsing import", err)
+			apiErr = InternalServerError()
+		}
+		return nil, &apiErr
+	}
+
+	return recipe, nil
+}
+
+// GET /recipe/:id?servings={n}&units={metric|us}
 func (h *RecipeHandler) getRecipeById(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
@@ -110,7 +414,7 @@ func (h *RecipeHandler) getRecipeById(c *fiber.Ctx) error {
 		return SendError(c, BadRequest("id must be an integer"))
 	}
 
-	recipe, err := h.recipeService.GetRecipeById(uint(recipeId))
+	recipe, err := h.recipeService.GetVisibleRecipe(getViewerID(c), uint(recipeId), c.Query("share"))
 	if err != nil {
 		if errors.Is(err, services.ErrRecipeNotFound) {
 			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
@@ -118,12 +422,577 @@ func (h *RecipeHandler) getRecipeById(c *fiber.Ctx) error {
 		return SendError(c, InternalServerError())
 	}
 
-	return c.JSON(recipe.ToDto())
+	if err := h.recipeService.AnnotateRecipes(getViewerID(c), recipe); err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	if servings := c.Query("servings"); servings != "" {
+		n, err := strconv.Atoi(servings)
+		if err != nil || n <= 0 {
+			return SendError(c, BadRequest("servings must be a positive integer"))
+		}
+		scaled := recipe.Scale(n)
+		recipe = &scaled
+	}
+
+	if units := c.Query("units"); units != "" {
+		system, ok := domain.ParseUnitSystem(units)
+		if !ok {
+			return SendError(c, BadRequest("units must be one of metric, us"))
+		}
+		converted := recipe.Convert(system)
+		recipe = &converted
+	}
+
+	return c.JSON(recipe.ToDtoFor(getViewerID(c)))
 
 	//recipe, err := h.recipeService.GetRecipeById(id)
 	//if err
 }
 
+// GET /recipe/:id/export?format=jsonld|markdown|cooklang
+func (h *RecipeHandler) exportRecipe(c *fiber.Ctx) error {
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	export, err := h.exportService.ExportRecipe(getViewerID(c), uint(recipeId), c.Query("share"), c.Query("format", services.ExportFormatJSONLD))
+	if err != nil {
+		if errors.Is(err, services.ErrRecipeNotFound) {
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		}
+		if errors.Is(err, services.ErrUnknownExportFormat) {
+			return SendError(c, BadRequest("format must be one of jsonld, markdown, cooklang"))
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	c.Set(fiber.HeaderContentType, export.ContentType)
+	c.Set(fiber.HeaderContentDisposition, `inline; filename="`+export.Filename+`"`)
+	return c.Send(export.Body)
+}
+
+// POST /recipe/:id/fork
+func (h *RecipeHandler) forkRecipe(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	fork, err := h.recipeService.ForkRecipe(user.ID, uint(recipeId))
+	if err != nil {
+		if errors.Is(err, services.ErrRecipeNotFound) {
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.Status(fiber.StatusCreated).JSON(fork.ToDtoFor(user.ID))
+}
+
+// GET /recipe/:id/forks?page={n}&limit={n}
+func (h *RecipeHandler) getRecipeForks(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	page, limit := getPaginationParams(c)
+	forks, total, err := h.recipeService.GetRecipeForks(user.ID, uint(recipeId), page, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRecipeNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		case errors.Is(err, services.ErrUnauthorized):
+			return SendError(c, Unauthorized())
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	if err := h.recipeService.AnnotateRecipes(getViewerID(c), recipePointers(forks)...); err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	forkDtos := make([]domain.RecipeDto, len(forks))
+	for i, fork := range forks {
+		forkDtos[i] = fork.ToDtoFor(getViewerID(c)).(domain.RecipeDto)
+	}
+
+	page, limit = db.PageBounds(page, limit)
+	return c.JSON(map[string]any{
+		"recipes": forkDtos,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// PUT /recipe/:id/favorite
+func (h *RecipeHandler) favoriteRecipe(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	err = h.recipeService.FavoriteRecipe(user.ID, uint(recipeId))
+	if err != nil {
+		if errors.Is(err, services.ErrRecipeNotFound) {
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// DELETE /recipe/:id/favorite
+func (h *RecipeHandler) unfavoriteRecipe(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	if err = h.recipeService.UnfavoriteRecipe(user.ID, uint(recipeId)); err != nil {
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GET /recipe/:id/reviews?page={n}&limit={n}
+func (h *RecipeHandler) getReviews(c *fiber.Ctx) error {
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	page, limit := getPaginationParams(c)
+	reviews, total, err := h.recipeService.GetReviews(getViewerID(c), uint(recipeId), page, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrRecipeNotFound) {
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	reviewDtos := make([]domain.ReviewDto, len(reviews))
+	for i, review := range reviews {
+		reviewDtos[i] = review.ToDto().(domain.ReviewDto)
+	}
+
+	page, limit = db.PageBounds(page, limit)
+	return c.JSON(map[string]any{
+		"reviews": reviewDtos,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// POST /recipe/:id/review
+func (h *RecipeHandler) createReview(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Rating int    `json:"rating"`
+		Body   string `json:"body"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	review, err := h.recipeService.CreateReview(user.ID, uint(recipeId), body.Rating, body.Body)
+	if err != nil {
+		return sendReviewError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(review.ToDto())
+}
+
+// PATCH /recipe/:id/review
+func (h *RecipeHandler) updateReview(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Rating int     `json:"rating"`
+		Body   *string `json:"body"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	review, err := h.recipeService.UpdateReview(user.ID, uint(recipeId), body.Rating, body.Body)
+	if err != nil {
+		return sendReviewError(c, err)
+	}
+	return c.JSON(review.ToDto())
+}
+
+// DELETE /recipe/:id/review
+func (h *RecipeHandler) deleteReview(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	if err = h.recipeService.DeleteReview(user.ID, uint(recipeId)); err != nil {
+		return sendReviewError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func sendReviewError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrRecipeNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+	case errors.Is(err, services.ErrReviewNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "review not found"}))
+	case errors.Is(err, services.ErrReviewConflict):
+		return SendError(c, Conflict(map[string]string{"review": "you have already reviewed this recipe"}))
+	case errors.Is(err, services.ErrInvalidRating):
+		return SendError(c, UnprocessableEntity(map[string]string{"rating": "must be a whole number from 1 to 5"}))
+	case errors.Is(err, services.ErrOwnRecipeReview):
+		return SendError(c, Forbidden("you cannot review your own recipe"))
+	}
+	return SendError(c, InternalServerError())
+}
+
+// POST /recipe/:id/publish
+func (h *RecipeHandler) publishRecipe(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	// an optional future time schedules the recipe instead of publishing it now
+	body := struct {
+		At *time.Time `json:"at"`
+	}{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return SendError(c, BadRequest("invalid request body"))
+		}
+	}
+
+	recipe, err := h.recipeService.PublishRecipe(user.ID, uint(recipeId), body.At)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRecipeIncomplete):
+			return SendError(c, UnprocessableEntity(map[string]string{"recipe": "must have at least one ingredient and one instruction"}))
+		case errors.Is(err, services.ErrEmailNotVerified):
+			return SendError(c, Forbidden("verify your email address to publish recipes"))
+		case errors.Is(err, services.ErrRecipeNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		case errors.Is(err, services.ErrUnauthorized):
+			return SendError(c, Unauthorized())
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.JSON(recipe.ToDtoFor(user.ID))
+}
+
+// POST /recipe/:id/unpublish
+func (h *RecipeHandler) unpublishRecipe(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	recipe, err := h.recipeService.UnpublishRecipe(user.ID, uint(recipeId))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRecipeNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		case errors.Is(err, services.ErrUnauthorized):
+			return SendError(c, Unauthorized())
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.JSON(recipe.ToDtoFor(user.ID))
+}
+
+// PUT /recipe/:id/visibility
+func (h *RecipeHandler) setVisibility(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Visibility string `json:"visibility"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	recipe, err := h.recipeService.SetVisibility(user.ID, uint(recipeId), body.Visibility)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidVisibility):
+			return SendError(c, UnprocessableEntity(map[string]string{"visibility": "must be one of private, unlisted, public"}))
+		case errors.Is(err, services.ErrRecipeNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		case errors.Is(err, services.ErrUnauthorized):
+			return SendError(c, Unauthorized())
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.JSON(recipe.ToDtoFor(user.ID))
+}
+
+// POST /recipe/:id/share
+func (h *RecipeHandler) createShare(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return SendError(c, BadRequest("invalid request body"))
+		}
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		return SendError(c, UnprocessableEntity(map[string]string{"expires_at": "must be in the future"}))
+	}
+
+	share, token, err := h.recipeService.CreateShare(user.ID, uint(recipeId), body.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRecipeNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		case errors.Is(err, services.ErrUnauthorized):
+			return SendError(c, Unauthorized())
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	dto := share.ToDto().(domain.RecipeShareDto)
+	dto.Token = token
+	return c.Status(fiber.StatusCreated).JSON(dto)
+}
+
+// GET /recipe/:id/shares
+func (h *RecipeHandler) getShares(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	shares, err := h.recipeService.GetShares(user.ID, uint(recipeId))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRecipeNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		case errors.Is(err, services.ErrUnauthorized):
+			return SendError(c, Unauthorized())
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	dtos := make([]domain.RecipeShareDto, len(shares))
+	for i, share := range shares {
+		dtos[i] = share.ToDto().(domain.RecipeShareDto)
+	}
+	return c.JSON(dtos)
+}
+
+// DELETE /recipe/:id/share/:shareId
+func (h *RecipeHandler) revokeShare(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+	shareId, err := strconv.Atoi(c.Params("shareId"))
+	if err != nil {
+		return SendError(c, BadRequest("shareId must be an integer"))
+	}
+
+	err = h.recipeService.RevokeShare(user.ID, uint(recipeId), uint(shareId))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRecipeNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		case errors.Is(err, services.ErrShareNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "share not found"}))
+		case errors.Is(err, services.ErrUnauthorized):
+			return SendError(c, Unauthorized())
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GET /recipe/:id/versions
+func (h *RecipeHandler) getRecipeVersions(c *fiber.Ctx) error {
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	versions, err := h.recipeService.GetRecipeVersions(getViewerID(c), uint(recipeId))
+	if err != nil {
+		if errors.Is(err, services.ErrRecipeNotFound) {
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	dtos := make([]domain.RecipeVersionDto, len(versions))
+	for i, v := range versions {
+		dtos[i] = v.SummaryDto()
+	}
+	return c.JSON(dtos)
+}
+
+// GET /recipe/:id/versions/:version
+func (h *RecipeHandler) getRecipeVersion(c *fiber.Ctx) error {
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return SendError(c, BadRequest("version must be an integer"))
+	}
+
+	v, err := h.recipeService.GetRecipeVersion(getViewerID(c), uint(recipeId), version)
+	if err != nil {
+		if errors.Is(err, services.ErrVersionNotFound) {
+			return SendError(c, NotFound(map[string]string{"error": "version not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.JSON(v.ToDto())
+}
+
+// GET /recipe/:id/versions/diff?from={n}&to={n}
+func (h *RecipeHandler) diffRecipeVersions(c *fiber.Ctx) error {
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		return SendError(c, BadRequest("from must be an integer"))
+	}
+	to, err := strconv.Atoi(c.Query("to"))
+	if err != nil {
+		return SendError(c, BadRequest("to must be an integer"))
+	}
+
+	diff, err := h.recipeService.DiffRecipeVersions(getViewerID(c), uint(recipeId), from, to)
+	if err != nil {
+		if errors.Is(err, services.ErrVersionNotFound) {
+			return SendError(c, NotFound(map[string]string{"error": "version not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.JSON(diff)
+}
+
+// POST /recipe/:id/versions/:version/restore
+func (h *RecipeHandler) restoreRecipeVersion(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	recipeId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return SendError(c, BadRequest("version must be an integer"))
+	}
+
+	recipe, err := h.recipeService.RestoreRecipeVersion(user.ID, uint(recipeId), version)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRecipeNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+		case errors.Is(err, services.ErrVersionNotFound):
+			return SendError(c, NotFound(map[string]string{"error": "version not found"}))
+		case errors.Is(err, services.ErrUnauthorized):
+			return SendError(c, Unauthorized())
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.JSON(recipe.ToDtoFor(user.ID))
+}
+
 // PATCH /recipe/:id
 func (h *RecipeHandler) updateRecipe(c *fiber.Ctx) error {
 	user, err := getUserFromLocals(c)
@@ -162,7 +1031,7 @@ func (h *RecipeHandler) updateRecipe(c *fiber.Ctx) error {
 		return SendError(c, InternalServerError())
 	}
 
-	return c.JSON(recipe.ToDto())
+	return c.JSON(recipe.ToDtoFor(user.ID))
 }
 
 // DELETE /recipe/:id
@@ -227,7 +1096,7 @@ func (h *RecipeHandler) createIngredient(c *fiber.Ctx) error {
 		return SendError(c, InternalServerError())
 	}
 
-	return c.JSON(recipe.ToDto())
+	return c.JSON(recipe.ToDtoFor(user.ID))
 }
 
 // PATCH /recipe/:id/ingredient/:ingredientId
@@ -271,7 +1140,7 @@ func (h *RecipeHandler) updateIngredient(c *fiber.Ctx) error {
 		return SendError(c, InternalServerError())
 	}
 
-	return c.JSON(recipe.ToDto())
+	return c.JSON(recipe.ToDtoFor(user.ID))
 }
 
 // DELETE /recipe/:id/ingredient/:ingredientId
@@ -347,7 +1216,7 @@ func (h *RecipeHandler) createInstruction(c *fiber.Ctx) error {
 		return SendError(c, InternalServerError())
 	}
 
-	return c.JSON(recipe.ToDto())
+	return c.JSON(recipe.ToDtoFor(user.ID))
 }
 
 // PATCH /recipe/:id/instruction/:instructionId
@@ -386,7 +1255,7 @@ func (h *RecipeHandler) updateInstruction(c *fiber.Ctx) error {
 		return SendError(c, InternalServerError())
 	}
 
-	return c.JSON(recipe.ToDto())
+	return c.JSON(recipe.ToDtoFor(user.ID))
 }
 
 // PATCH /recipe/:id/instruction/:instructionOneId/:instructionTwoId
@@ -416,7 +1285,7 @@ func (h *RecipeHandler) swapInstructions(c *fiber.Ctx) error {
 		return SendError(c, InternalServerError())
 	}
 
-	return c.JSON(recipe.ToDto())
+	return c.JSON(recipe.ToDtoFor(user.ID))
 }
 
 // DELETE /recipe/:id/instruction/:instructionId
@@ -466,7 +1335,7 @@ func (h *RecipeHandler) addTagToRecipe(c *fiber.Ctx) error {
 		return SendError(c, InternalServerError())
 	}
 
-	return c.JSON(recipe.ToDto())
+	return c.JSON(recipe.ToDtoFor(user.ID))
 }
 
 // DELETE /recipe/:recipeId/tag/:tagId
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/services"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+type ShoppingListHandler struct {
+	r                   fiber.Router
+	db                  *gorm.DB
+	shoppingListService services.ShoppingListService
+}
+
+func NewShoppingListHandler(r fiber.Router, db *gorm.DB) *ShoppingListHandler {
+	subpath := r.Group("/shoppinglist")
+	shoppingListService := services.NewShoppingListService(db)
+	return &ShoppingListHandler{r: subpath, db: db, shoppingListService: shoppingListService}
+}
+
+func (h *ShoppingListHandler) RegisterRoutes() {
+	h.r.Get("/", AuthMiddleware(h.db), h.getShoppingLists)
+	h.r.Post("/", AuthMiddleware(h.db), h.createShoppingList)
+	h.r.Get("/:id", AuthMiddleware(h.db), h.getShoppingList)
+	h.r.Patch("/:id", AuthMiddleware(h.db), h.renameShoppingList)
+	h.r.Delete("/:id", AuthMiddleware(h.db), h.deleteShoppingList)
+
+	// ITEMS
+	h.r.Post("/:id/items", AuthMiddleware(h.db), h.addItem)
+	h.r.Patch("/:id/items/:itemId", AuthMiddleware(h.db), h.updateItem)
+	h.r.Delete("/:id/items/:itemId", AuthMiddleware(h.db), h.deleteItem)
+
+	// MEMBERS
+	h.r.Post("/:id/members", AuthMiddleware(h.db), h.addMember)
+	h.r.Delete("/:id/members/:userId", AuthMiddleware(h.db), h.removeMember)
+}
+
+// GET /shoppinglist
+func (h *ShoppingListHandler) getShoppingLists(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	lists, err := h.shoppingListService.GetShoppingLists(user.ID)
+	if err != nil {
+		return sendShoppingListError(c, err)
+	}
+
+	listDtos := make([]domain.ShoppingListDto, len(lists))
+	for i, list := range lists {
+		listDtos[i] = list.ToDto().(domain.ShoppingListDto)
+	}
+	return c.JSON(listDtos)
+}
+
+// POST /shoppinglist
+// The list is made from the given recipes and, if from and to are set, the
+// recipes in the user's meal plan between those dates.
+func (h *ShoppingListHandler) createShoppingList(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	body := struct {
+		Name    string `json:"name"`
+		Recipes []struct {
+			RecipeID uint `json:"recipe_id"`
+			Servings int  `json:"servings"`
+		} `json:"recipes"`
+		From string `json:"from"`
+		To   string `json:"to"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	recipes := make([]services.ShoppingListRecipe, len(body.Recipes))
+	for i, recipe := range body.Recipes {
+		recipes[i] = services.ShoppingListRecipe{RecipeID: recipe.RecipeID, Servings: recipe.Servings}
+	}
+
+	var from, to *time.Time
+	if body.From != "" || body.To != "" {
+		f, err := time.Parse(time.DateOnly, body.From)
+		if err != nil {
+			return SendError(c, BadRequest("from must be a date (YYYY-MM-DD)"))
+		}
+		t, err := time.Parse(time.DateOnly, body.To)
+		if err != nil {
+			return SendError(c, BadRequest("to must be a date (YYYY-MM-DD)"))
+		}
+		from, to = &f, &t
+	}
+
+	list, err := h.shoppingListService.CreateShoppingList(user.ID, body.Name, recipes, from, to)
+	if err != nil {
+		return sendShoppingListError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(list.ToDto())
+}
+
+// GET /shoppinglist/:id
+func (h *ShoppingListHandler) getShoppingList(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	list, err := h.shoppingListService.GetShoppingList(user.ID, uint(id))
+	if err != nil {
+		return sendShoppingListError(c, err)
+	}
+	return c.JSON(list.ToDto())
+}
+
+// PATCH /shoppinglist/:id
+func (h *ShoppingListHandler) renameShoppingList(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Name string `json:"name"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	list, err := h.shoppingListService.RenameShoppingList(user.ID, uint(id), body.Name)
+	if err != nil {
+		return sendShoppingListError(c, err)
+	}
+	return c.JSON(list.ToDto())
+}
+
+// DELETE /shoppinglist/:id
+func (h *ShoppingListHandler) deleteShoppingList(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	if err = h.shoppingListService.DeleteShoppingList(user.ID, uint(id)); err != nil {
+		return sendShoppingListError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// POST /shoppinglist/:id/items
+func (h *ShoppingListHandler) addItem(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Name     string `json:"name"`
+		Quantity string `json:"quantity"`
+		Unit     string `json:"unit"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	item, err := h.shoppingListService.AddItem(user.ID, uint(id), body.Name, body.Quantity, body.Unit)
+	if err != nil {
+		return sendShoppingListError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(item.ToDto())
+}
+
+// PATCH /shoppinglist/:id/items/:itemId
+func (h *ShoppingListHandler) updateItem(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+	itemId, err := strconv.Atoi(c.Params("itemId"))
+	if err != nil {
+		return SendError(c, BadRequest("itemId must be an integer"))
+	}
+
+	body := struct {
+		Name     *string `json:"name"`
+		Quantity *string `json:"quantity"`
+		Unit     *string `json:"unit"`
+		Checked  *bool   `json:"checked"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	item, err := h.shoppingListService.UpdateItem(user.ID, uint(id), uint(itemId), services.ShoppingListItemUpdate{
+		Name:     body.Name,
+		Quantity: body.Quantity,
+		Unit:     body.Unit,
+		Checked:  body.Checked,
+	})
+	if err != nil {
+		return sendShoppingListError(c, err)
+	}
+	return c.JSON(item.ToDto())
+}
+
+// DELETE /shoppinglist/:id/items/:itemId
+func (h *ShoppingListHandler) deleteItem(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+	itemId, err := strconv.Atoi(c.Params("itemId"))
+	if err != nil {
+		return SendError(c, BadRequest("itemId must be an integer"))
+	}
+
+	if err = h.shoppingListService.DeleteItem(user.ID, uint(id), uint(itemId)); err != nil {
+		return sendShoppingListError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// POST /shoppinglist/:id/members
+func (h *ShoppingListHandler) addMember(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+
+	body := struct {
+		Username string `json:"username"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return SendError(c, BadRequest("invalid request body"))
+	}
+
+	list, err := h.shoppingListService.AddMember(user.ID, uint(id), body.Username)
+	if err != nil {
+		return sendShoppingListError(c, err)
+	}
+	return c.JSON(list.ToDto())
+}
+
+// DELETE /shoppinglist/:id/members/:userId
+func (h *ShoppingListHandler) removeMember(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return SendError(c, BadRequest("id must be an integer"))
+	}
+	memberId, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return SendError(c, BadRequest("userId must be an integer"))
+	}
+
+	if err = h.shoppingListService.RemoveMember(user.ID, uint(id), uint(memberId)); err != nil {
+		return sendShoppingListError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func sendShoppingListError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrShoppingListNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "shopping list not found"}))
+	case errors.Is(err, services.ErrShoppingListItemNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "shopping list item not found"}))
+	case errors.Is(err, services.ErrRecipeNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "recipe not found"}))
+	case errors.Is(err, services.ErrUserNotFound):
+		return SendError(c, NotFound(map[string]string{"error": "user not found"}))
+	case errors.Is(err, services.ErrShoppingListNameRequired):
+		return SendError(c, UnprocessableEntity(map[string]string{"name": "required"}))
+	case errors.Is(err, services.ErrShoppingListItemNameRequired):
+		return SendError(c, UnprocessableEntity(map[string]string{"name": "required"}))
+	case errors.Is(err, services.ErrInvalidServings):
+		return SendError(c, UnprocessableEntity(map[string]string{"servings": "must be a positive integer"}))
+	case errors.Is(err, services.ErrInvalidShoppingListMember):
+		return SendError(c, BadRequest("you cannot share a list with yourself"))
+	case errors.Is(err, services.ErrInvalidDateRange):
+		return SendError(c, BadRequest("invalid date range"))
+	case errors.Is(err, services.ErrUnauthorized):
+		return SendError(c, Unauthorized())
+	}
+	return SendError(c, InternalServerError())
+}
@@ -1,29 +1,64 @@
 package handlers
 
 import (
+	"bufio"
 	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/jacksonopp/go-recipe/db"
 	"github.com/jacksonopp/go-recipe/domain"
 	"github.com/jacksonopp/go-recipe/services"
+	"github.com/minio/minio-go/v7"
 	"gorm.io/gorm"
+	"log"
+	"os"
 )
 
+// ARCHIVE_IMPORT_PATH is the path of importArchive, which reads its own body.
+const ARCHIVE_IMPORT_PATH = "/api/user/import"
+
 type UserHandler struct {
-	userService services.UserService
-	r           fiber.Router
-	db          *gorm.DB
+	userService       services.UserService
+	recipeService     services.RecipeService
+	archiveService    services.ArchiveService
+	collectionService services.CollectionService
+	followService     services.FollowService
+	r                 fiber.Router
+	db                *gorm.DB
 }
 
-func NewUserHandler(r fiber.Router, db *gorm.DB) *UserHandler {
+func NewUserHandler(r fiber.Router, minio *minio.Client, db *gorm.DB) *UserHandler {
 	subpath := r.Group("/user")
 	userService := services.NewUserService(db)
-	return &UserHandler{userService: userService, r: subpath, db: db}
+	recipeService := services.NewRecipeService(db)
+	archiveService := services.NewArchiveService(db, minio)
+	collectionService := services.NewCollectionService(db)
+	followService := services.NewFollowService(db)
+	return &UserHandler{
+		userService:       userService,
+		recipeService:     recipeService,
+		archiveService:    archiveService,
+		collectionService: collectionService,
+		followService:     followService,
+		r:                 subpath,
+		db:                db,
+	}
 }
 
 func (h *UserHandler) RegisterRoutes() {
-	h.r.Get("/:name", h.getUserByName)
-	h.r.Get("/:name/recipes", h.getUserRecipes)
+	// the body limit does not apply to ARCHIVE_IMPORT_PATH, see importArchive
+	h.r.Post("/import", AuthMiddleware(h.db), h.importArchive)
+	h.r.Get("/:name", OptionalAuthMiddleware(h.db), h.getUserByName)
+	h.r.Get("/:name/recipes", OptionalAuthMiddleware(h.db), h.getUserRecipes)
 	h.r.Get("/:name/files", h.getUserFiles)
+	h.r.Get("/:name/favorites", OptionalAuthMiddleware(h.db), h.getUserFavorites)
+	h.r.Get("/:name/collections", OptionalAuthMiddleware(h.db), h.getUserCollections)
+	h.r.Get("/:name/export", AuthMiddleware(h.db), h.exportUser)
+
+	// FOLLOWS
+	h.r.Put("/:name/follow", AuthMiddleware(h.db), h.followUser)
+	h.r.Delete("/:name/follow", AuthMiddleware(h.db), h.unfollowUser)
+	h.r.Get("/:name/followers", h.getFollowers)
+	h.r.Get("/:name/following", h.getFollowing)
 }
 
 func (h *UserHandler) getUserByName(c *fiber.Ctx) error {
@@ -35,6 +70,17 @@ func (h *UserHandler) getUserByName(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
+
+	// only list the recipes this viewer is allowed to find
+	viewerID := getViewerID(c)
+	recipes := make([]domain.Recipe, 0, len(user.Recipes))
+	for _, recipe := range user.Recipes {
+		if recipe.ListedFor(viewerID) {
+			recipes = append(recipes, recipe)
+		}
+	}
+	user.Recipes = recipes
+
 	return c.JSON(user.ToDto())
 }
 
@@ -46,16 +92,19 @@ func (h *UserHandler) getUserRecipes(c *fiber.Ctx) error {
 		return SendError(c, BadRequest("username is required"))
 	}
 
-	recipes, err := h.userService.GetUsersRecipes(username, page, limit)
+	recipes, err := h.userService.GetUsersRecipes(username, getViewerID(c), page, limit)
 	if err != nil {
 		if errors.Is(err, services.ErrUserNotFound) {
 			return SendError(c, NotFound(map[string]string{"msg": "user not found"}))
 		}
 		return SendError(c, InternalServerError())
 	}
+	if err := h.recipeService.AnnotateRecipes(getViewerID(c), recipePointers(recipes)...); err != nil {
+		return SendError(c, InternalServerError())
+	}
 	recipesDtos := make([]domain.RecipeDto, len(recipes))
 	for i, r := range recipes {
-		rdto, ok := r.ToDto().(domain.RecipeDto)
+		rdto, ok := r.ToDtoFor(getViewerID(c)).(domain.RecipeDto)
 		if !ok {
 			return SendError(c, InternalServerError())
 		}
@@ -82,3 +131,197 @@ func (h *UserHandler) getUserFiles(c *fiber.Ctx) error {
 
 	return c.JSON(files)
 }
+
+// GET /user/:name/favorites?page={n}&limit={n}
+func (h *UserHandler) getUserFavorites(c *fiber.Ctx) error {
+	page, limit := getPaginationParams(c)
+	username := c.Params("name")
+	if username == "" {
+		return SendError(c, BadRequest("username is required"))
+	}
+
+	recipes, total, err := h.recipeService.GetUserFavorites(username, getViewerID(c), page, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			return SendError(c, NotFound(map[string]string{"msg": "user not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+	if err := h.recipeService.AnnotateRecipes(getViewerID(c), recipePointers(recipes)...); err != nil {
+		return SendError(c, InternalServerError())
+	}
+
+	recipeDtos := make([]domain.RecipeDto, len(recipes))
+	for i, recipe := range recipes {
+		recipeDtos[i] = recipe.ToDtoFor(getViewerID(c)).(domain.RecipeDto)
+	}
+
+	page, limit = db.PageBounds(page, limit)
+	return c.JSON(map[string]any{
+		"recipes": recipeDtos,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// GET /user/:name/collections?page={n}&limit={n}
+func (h *UserHandler) getUserCollections(c *fiber.Ctx) error {
+	page, limit := getPaginationParams(c)
+	username := c.Params("name")
+	if username == "" {
+		return SendError(c, BadRequest("username is required"))
+	}
+
+	collections, err := h.collectionService.GetUserCollections(username, getViewerID(c), page, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			return SendError(c, NotFound(map[string]string{"msg": "user not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	collectionDtos := make([]domain.CollectionDto, len(collections))
+	for i, collection := range collections {
+		collectionDtos[i] = collection.ToDto().(domain.CollectionDto)
+	}
+	return c.JSON(collectionDtos)
+}
+
+// PUT /user/:name/follow
+func (h *UserHandler) followUser(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	err = h.followService.FollowUser(user.ID, c.Params("name"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			return SendError(c, NotFound(map[string]string{"msg": "user not found"}))
+		case errors.Is(err, services.ErrFollowSelf):
+			return SendError(c, BadRequest("you cannot follow yourself"))
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// DELETE /user/:name/follow
+func (h *UserHandler) unfollowUser(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	err = h.followService.UnfollowUser(user.ID, c.Params("name"))
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			return SendError(c, NotFound(map[string]string{"msg": "user not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GET /user/:name/followers?page={n}&limit={n}
+func (h *UserHandler) getFollowers(c *fiber.Ctx) error {
+	page, limit := getPaginationParams(c)
+	follows, err := h.followService.GetFollowers(c.Params("name"), page, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			return SendError(c, NotFound(map[string]string{"msg": "user not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	followers := make([]domain.FollowDto, len(follows))
+	for i, follow := range follows {
+		followers[i] = follow.FollowerDto()
+	}
+	return c.JSON(followers)
+}
+
+// GET /user/:name/following?page={n}&limit={n}
+func (h *UserHandler) getFollowing(c *fiber.Ctx) error {
+	page, limit := getPaginationParams(c)
+	follows, err := h.followService.GetFollowing(c.Params("name"), page, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			return SendError(c, NotFound(map[string]string{"msg": "user not found"}))
+		}
+		return SendError(c, InternalServerError())
+	}
+
+	following := make([]domain.FollowDto, len(follows))
+	for i, follow := range follows {
+		following[i] = follow.FolloweeDto()
+	}
+	return c.JSON(following)
+}
+
+// GET /user/:name/export
+func (h *UserHandler) exportUser(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+	if user.Username != c.Params("name") {
+		return SendError(c, Unauthorized())
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+user.Username+`-cookbook.zip"`)
+
+	// the archive is streamed after the handler returns, so errors can only be logged
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.archiveService.ExportUser(user.ID, w); err != nil {
+			log.Println("error exporting user archive", err)
+		}
+		if err := w.Flush(); err != nil {
+			log.Println("error flushing user archive", err)
+		}
+	})
+	return nil
+}
+
+// POST /user/import
+func (h *UserHandler) importArchive(c *fiber.Ctx) error {
+	user, err := getUserFromLocals(c)
+	if err != nil {
+		return SendError(c, err.(APIError))
+	}
+
+	archive, size, err := streamFormFile(c, "archive", services.MAX_ARCHIVE_SIZE)
+	if err != nil {
+		switch {
+		case errors.Is(err, errFormFileMissing):
+			return SendError(c, BadRequest("archive is required"))
+		case errors.Is(err, errFormFileTooLarge):
+			return SendError(c, NewAPIError(fiber.StatusRequestEntityTooLarge, "archive is too large"))
+		}
+		log.Println("error reading archive", err)
+		return SendError(c, InternalServerError())
+	}
+	defer func() {
+		archive.Close()
+		os.Remove(archive.Name())
+	}()
+
+	summary, err := h.archiveService.ImportArchive(user.ID, archive, size)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidArchive):
+			return SendError(c, UnprocessableEntity(map[string]string{"archive": "not a recipe archive"}))
+		case errors.Is(err, services.ErrUnsupportedArchiveVersion):
+			return SendError(c, UnprocessableEntity(map[string]string{"archive": "archive was made by a newer version"}))
+		case errors.Is(err, services.ErrArchiveTooLarge):
+			return SendError(c, NewAPIError(fiber.StatusRequestEntityTooLarge, "archive is too large"))
+		}
+		log.Println("error importing archive", err)
+		return SendError(c, InternalServerError())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(summary)
+}
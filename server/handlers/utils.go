@@ -1,12 +1,30 @@
 package handlers
 
 import (
+	"bytes"
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jacksonopp/go-recipe/domain"
+	"io"
 	"log"
+	"mime/multipart"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+var (
+	// errFormFileMissing is returned by streamFormFile when the form has no such file.
+	errFormFileMissing = errors.New("form file missing")
+	// errFormFileTooLarge is returned by streamFormFile when the file is over its limit.
+	errFormFileTooLarge = errors.New("form file too large")
+)
+
+// MULTIPART_OVERHEAD is how much bigger than its files a multipart body may be,
+// for the part headers and any small fields.
+const MULTIPART_OVERHEAD = 64 << 10
+
 func getPaginationParams(c *fiber.Ctx) (int, int) {
 	var (
 		page  int
@@ -38,3 +56,146 @@ func getUserFromLocals(c *fiber.Ctx) (domain.User, error) {
 	}
 	return user, nil
 }
+
+// getViewerID returns the ID of the signed in user, or 0 for anonymous requests.
+// It is meant for routes behind OptionalAuthMiddleware.
+func getViewerID(c *fiber.Ctx) uint {
+	if u, ok := c.Locals("user").(*domain.User); ok {
+		return u.ID
+	}
+	return 0
+}
+
+// getSessionID returns the ID of the session the request was signed in with,
+// or 0 if it was made with an API token or anonymously.
+func getSessionID(c *fiber.Ctx) uint {
+	if s, ok := c.Locals("session").(*domain.Session); ok {
+		return s.ID
+	}
+	return 0
+}
+
+// requireSession returns a Forbidden error unless the request was signed in with
+// a session cookie. Routes that manage credentials use it so that a leaked API
+// token cannot be used to keep or widen access.
+func requireSession(c *fiber.Ctx) error {
+	if getSessionID(c) == 0 {
+		return Forbidden("this can only be done from a signed in session, not with an API token")
+	}
+	return nil
+}
+
+// recipePointers returns pointers to each recipe in recipes, e.g. for RecipeService.AnnotateRecipes.
+func recipePointers(recipes []domain.Recipe) []*domain.Recipe {
+	pointers := make([]*domain.Recipe, len(recipes))
+	for i := range recipes {
+		pointers[i] = &recipes[i]
+	}
+	return pointers
+}
+
+// parseIDList parses a comma separated list of IDs, e.g. "1,2,3".
+func parseIDList(s string) ([]uint, error) {
+	parts := strings.Split(s, ",")
+	ids := make([]uint, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// queryInt returns the integer value of the query param key, or 0 if it is not set.
+func queryInt(c *fiber.Ctx, key string) (int, error) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// queryTime returns the time value of the query param key, or the zero time if it is not set.
+// Both plain dates (2006-01-02) and RFC 3339 timestamps are accepted.
+func queryTime(c *fiber.Ctx, key string) (time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// streamFormFile copies the file uploaded in the multipart form field to a
+// temporary file as the request body is read, without buffering the body.
+// The file must be at most limit bytes. The caller must close and remove it.
+func streamFormFile(c *fiber.Ctx, field string, limit int64) (*os.File, int64, error) {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return nil, 0, errFormFileMissing
+	}
+
+	var body io.Reader
+	if c.Request().IsBodyStream() {
+		body = c.Context().RequestBodyStream()
+	} else {
+		body = bytes.NewReader(c.Body())
+	}
+	body = io.LimitReader(body, limit+MULTIPART_OVERHEAD)
+	mr := multipart.NewReader(body, boundary)
+
+	f, n, err := copyFormFile(mr, field, limit)
+	if err != nil {
+		// the rest of the body was not read, so the connection cannot be reused
+		c.Context().SetConnectionClose()
+		return nil, 0, err
+	}
+	// read the closing boundary, so the connection can be reused
+	if _, err = io.Copy(io.Discard, body); err != nil {
+		c.Context().SetConnectionClose()
+	}
+	return f, n, nil
+}
+
+// copyFormFile copies the file in the form field to a temporary file.
+func copyFormFile(mr *multipart.Reader, field string, limit int64) (*os.File, int64, error) {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, 0, errFormFileMissing
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// a body cut off by the limit ends unexpectedly
+			return nil, 0, errFormFileTooLarge
+		}
+		if err != nil {
+			return nil, 0, errFormFileMissing
+		}
+		if part.FormName() != field || part.FileName() == "" {
+			continue
+		}
+
+		f, err := os.CreateTemp("", "upload-*")
+		if err != nil {
+			return nil, 0, err
+		}
+		n, err := io.Copy(f, io.LimitReader(part, limit+1))
+		if errors.Is(err, io.ErrUnexpectedEOF) || (err == nil && n > limit) {
+			// a part cut off by the body limit ends unexpectedly
+			err = errFormFileTooLarge
+		}
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, 0, err
+		}
+		return f, n, nil
+	}
+}
@@ -6,29 +6,76 @@ import (
 	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
 	"os"
+	"strings"
 )
 
+// ErrNotConfigured is returned by New when no issuer or client ID is configured.
+var ErrNotConfigured = errors.New("oidc provider not configured")
+
 type Authenticator struct {
 	*oidc.Provider
 	oauth2.Config
 }
 
-// New instantiates the *Authenticator.
-func New() (*Authenticator, error) {
-	provider, err := oidc.NewProvider(
-		context.Background(),
-		"https://"+os.Getenv("AUTH0_DOMAIN")+"/",
-	)
+// Config configures the OIDC provider to sign in with.
+type Config struct {
+	// Issuer is the issuer URL of the provider, e.g. "https://example.auth0.com/".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the URL of the /auth/oidc/callback route.
+	RedirectURL string
+	// Scopes are requested along with "openid". They default to "profile" and "email".
+	Scopes []string
+}
+
+// ConfigFromEnv reads the provider config from OIDC_ISSUER, OIDC_CLIENT_ID,
+// OIDC_CLIENT_SECRET, OIDC_CALLBACK_URL and the space separated OIDC_SCOPES.
+// The AUTH0_* variables are used for any that are not set.
+func ConfigFromEnv() Config {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" && os.Getenv("AUTH0_DOMAIN") != "" {
+		issuer = "https://" + os.Getenv("AUTH0_DOMAIN") + "/"
+	}
+
+	return Config{
+		Issuer:       issuer,
+		ClientID:     envOr("OIDC_CLIENT_ID", "AUTH0_CLIENT_ID"),
+		ClientSecret: envOr("OIDC_CLIENT_SECRET", "AUTH0_CLIENT_SECRET"),
+		RedirectURL:  envOr("OIDC_CALLBACK_URL", "AUTH0_CALLBACK_URL"),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return os.Getenv(fallback)
+}
+
+// New instantiates the *Authenticator, discovering the provider's endpoints from its issuer.
+func New(ctx context.Context, config Config) (*Authenticator, error) {
+	if config.Issuer == "" || config.ClientID == "" {
+		return nil, ErrNotConfigured
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
 	if err != nil {
 		return nil, err
 	}
 
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+
 	conf := oauth2.Config{
-		ClientID:     os.Getenv("AUTH0_CLIENT_ID"),
-		ClientSecret: os.Getenv("AUTH0_CLIENT_SECRET"),
-		RedirectURL:  os.Getenv("AUTH0_CALLBACK_URL"),
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RedirectURL:  config.RedirectURL,
 		Endpoint:     provider.Endpoint(),
-		Scopes:       []string{oidc.ScopeOpenID, "profile"},
+		Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
 	}
 
 	return &Authenticator{
@@ -37,6 +84,29 @@ func New() (*Authenticator, error) {
 	}, nil
 }
 
+// Issuer returns the issuer URL of the provider.
+func (a *Authenticator) Issuer() string {
+	var claims struct {
+		Issuer string `json:"issuer"`
+	}
+	if err := a.Provider.Claims(&claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
+
+// LoginURL returns the URL to send users to to sign in. The ID token issued
+// will carry nonce, and the code can only be exchanged with verifier (PKCE).
+func (a *Authenticator) LoginURL(state, nonce, verifier string) string {
+	return a.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange swaps an authorization code for a token, proving the login was
+// started with verifier.
+func (a *Authenticator) Exchange(ctx context.Context, code, verifier string) (*oauth2.Token, error) {
+	return a.Config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+}
+
 // VerifyIDToken verifies that an *oauth2.Token is a valid *oidc.IDToken.
 func (a *Authenticator) VerifyIDToken(ctx context.Context, token *oauth2.Token) (*oidc.IDToken, error) {
 	rawIDToken, ok := token.Extra("id_token").(string)
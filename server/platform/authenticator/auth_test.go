@@ -0,0 +1,82 @@
+package authenticator_test
+
+import (
+	"context"
+	"github.com/jacksonopp/go-recipe/platform/authenticator"
+	"github.com/jacksonopp/go-recipe/platform/authenticator/authenticatortest"
+	"golang.org/x/oauth2"
+	"net/url"
+	"testing"
+)
+
+func TestAuthenticator_login(t *testing.T) {
+	provider := authenticatortest.NewProvider(t)
+	ctx := context.Background()
+
+	auth, err := authenticator.New(ctx, provider.Config("http://localhost/api/auth/oidc/callback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Issuer() != provider.URL {
+		t.Errorf("expected issuer %s, got %s", provider.URL, auth.Issuer())
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	loginURL := auth.LoginURL("state", "nonce", verifier)
+
+	parsed, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Errorf("expected a PKCE challenge in %s", loginURL)
+	}
+	if query.Get("nonce") != "nonce" {
+		t.Errorf("expected the nonce in %s", loginURL)
+	}
+
+	code, state, err := provider.Authorize(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "state" {
+		t.Errorf("expected state to be passed back, got %q", state)
+	}
+
+	token, err := auth.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := auth.VerifyIDToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idToken.Subject != provider.Subject || idToken.Nonce != "nonce" {
+		t.Errorf("expected subject %s and nonce, got %s and %s", provider.Subject, idToken.Subject, idToken.Nonce)
+	}
+}
+
+func TestAuthenticator_Exchange_wrongVerifier(t *testing.T) {
+	provider := authenticatortest.NewProvider(t)
+	ctx := context.Background()
+
+	auth, err := authenticator.New(ctx, provider.Config("http://localhost/api/auth/oidc/callback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, err := provider.Authorize(auth.LoginURL("state", "nonce", oauth2.GenerateVerifier()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.Exchange(ctx, code, oauth2.GenerateVerifier()); err == nil {
+		t.Error("expected the exchange to fail without the login's verifier")
+	}
+}
+
+func TestNew_notConfigured(t *testing.T) {
+	if _, err := authenticator.New(context.Background(), authenticator.Config{}); err != authenticator.ErrNotConfigured {
+		t.Errorf("expected ErrNotConfigured, got %v", err)
+	}
+}
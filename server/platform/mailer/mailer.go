@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config configures how emails are sent.
+type Config struct {
+	// From is the address emails are sent from.
+	From string
+	// SMTPHost and SMTPPort are the SMTP server to send emails through.
+	SMTPHost string
+	SMTPPort string
+	// SMTPUsername and SMTPPassword are used to sign in to the SMTP server, if set.
+	SMTPUsername string
+	SMTPPassword string
+	// Dir is a directory to write emails to instead of sending them, for local development.
+	Dir string
+}
+
+// ConfigFromEnv reads the mailer config from MAIL_FROM, SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD and MAIL_DIR.
+func ConfigFromEnv() Config {
+	return Config{
+		From:         os.Getenv("MAIL_FROM"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     os.Getenv("SMTP_PORT"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		Dir:          os.Getenv("MAIL_DIR"),
+	}
+}
+
+// New returns the Mailer for config. Emails are sent through config.SMTPHost if
+// it is set, written to config.Dir if that is set, and logged otherwise.
+func New(config Config) (Mailer, error) {
+	if config.SMTPHost != "" {
+		m, err := NewSMTPMailer(config)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	if config.Dir != "" {
+		if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+			return nil, err
+		}
+		return &FileMailer{Dir: config.Dir, From: config.From}, nil
+	}
+	return &LogMailer{From: config.From}, nil
+}
+
+// LogMailer writes emails to the log instead of sending them.
+type LogMailer struct {
+	From string
+}
+
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("email from %q to %q: %s\n%s", m.From, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes each email to its own .eml file in Dir instead of sending it.
+type FileMailer struct {
+	Dir  string
+	From string
+
+	count atomic.Uint64
+}
+
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102T150405"), m.count.Add(1))
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o600)
+}
+
+// format formats msg as an RFC 5322 message.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue removes line breaks from v, so that it cannot add headers of its own.
+func headerValue(v string) string {
+	return strings.Join(strings.FieldsFunc(v, func(r rune) bool { return r == '\r' || r == '\n' }), " ")
+}
@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+	m, err := New(Config{From: "recipes@example.com", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := Message{
+		To:      "cook@example.com",
+		Subject: "Hello\r\nBcc: someone@example.com",
+		Body:    "line one\nline two",
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.Send(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 emails, got %d", len(files))
+	}
+
+	contents, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := string(contents)
+	for _, want := range []string{
+		"From: recipes@example.com\r\n",
+		"To: cook@example.com\r\n",
+		"Subject: Hello Bcc: someone@example.com\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(email, want) {
+			t.Errorf("expected email to contain %q, got:\n%s", want, email)
+		}
+	}
+	if strings.Contains(email, "\r\nBcc:") {
+		t.Errorf("expected subject not to add headers, got:\n%s", email)
+	}
+}
+
+func TestNew_log(t *testing.T) {
+	m, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.(*LogMailer); !ok {
+		t.Errorf("expected a LogMailer, got %T", m)
+	}
+}
+
+func TestNew_smtp(t *testing.T) {
+	if _, err := New(Config{SMTPHost: "smtp.example.com"}); err != ErrNoSender {
+		t.Errorf("expected ErrNoSender, got %v", err)
+	}
+
+	m, err := New(Config{From: "recipes@example.com", SMTPHost: "smtp.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	smtpMailer, ok := m.(*SMTPMailer)
+	if !ok {
+		t.Fatalf("expected an SMTPMailer, got %T", m)
+	}
+	if smtpMailer.addr != "smtp.example.com:587" {
+		t.Errorf("expected the default submission port, got %s", smtpMailer.addr)
+	}
+}
@@ -0,0 +1,48 @@
+// Package mailertest provides a mailer.Mailer that keeps emails in memory, for tests.
+package mailertest
+
+import (
+	"context"
+	"github.com/jacksonopp/go-recipe/platform/mailer"
+	"sync"
+)
+
+// Mailer keeps every email sent with it instead of sending it.
+type Mailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+	// Err is returned from Send when it is set, and the email is not kept.
+	Err error
+}
+
+// NewMailer returns an empty Mailer.
+func NewMailer() *Mailer {
+	return &Mailer{}
+}
+
+func (m *Mailer) Send(_ context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the emails sent so far, oldest first.
+func (m *Mailer) Messages() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mailer.Message(nil), m.messages...)
+}
+
+// Last returns the most recent email sent, and false if none have been.
+func (m *Mailer) Last() (mailer.Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		return mailer.Message{}, false
+	}
+	return m.messages[len(m.messages)-1], true
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+)
+
+// ErrNoSender is returned by NewSMTPMailer when no From address is configured.
+var ErrNoSender = errors.New("no from address configured")
+
+// SMTPMailer sends emails through an SMTP server.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer returns a Mailer that sends emails through config.SMTPHost,
+// on port 587 unless config.SMTPPort is set.
+func NewSMTPMailer(config Config) (*SMTPMailer, error) {
+	if config.From == "" {
+		return nil, ErrNoSender
+	}
+
+	port := config.SMTPPort
+	if port == "" {
+		port = "587"
+	}
+
+	m := &SMTPMailer{addr: net.JoinHostPort(config.SMTPHost, port), from: config.From}
+	if config.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)
+	}
+	return m, nil
+}
+
+// Send sends msg. smtp.SendMail does not take a context, so ctx is only
+// checked before the email is handed to the server.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg))
+}
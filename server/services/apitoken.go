@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+// API_TOKEN_PREFIX starts every API token, so they are easy to spot in scripts and logs.
+const API_TOKEN_PREFIX = "grt_"
+
+// API_TOKEN_LENGTH is the length of the random part of API tokens.
+const API_TOKEN_LENGTH = 40
+
+// API_TOKEN_DISPLAY_LENGTH is how much of a token is kept to tell tokens apart.
+const API_TOKEN_DISPLAY_LENGTH = len(API_TOKEN_PREFIX) + 4
+
+// API_TOKEN_LAST_USED_INTERVAL is how often a token's last used time is updated,
+// so busy scripts do not write on every request.
+const API_TOKEN_LAST_USED_INTERVAL = time.Minute
+
+type APITokenService interface {
+	CreateToken(userID uint, name, scope string, expiresAt *time.Time) (*domain.APIToken, string, error)
+	GetTokens(userID uint) ([]domain.APIToken, error)
+	RevokeToken(userID, tokenID uint) error
+	Authenticate(token string) (*domain.User, *domain.APIToken, error)
+}
+
+type apiTokenService struct {
+	db  *gorm.DB
+	ctx context.Context
+}
+
+func NewAPITokenService(db *gorm.DB) APITokenService {
+	ctx := context.Background()
+	return &apiTokenService{db: db, ctx: ctx}
+}
+
+// CreateToken creates an API token for a user and returns it with its token.
+// The token is not stored and cannot be retrieved again.
+func (s *apiTokenService) CreateToken(userID uint, name, scope string, expiresAt *time.Time) (*domain.APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrAPITokenNameRequired
+	}
+	if scope == "" {
+		scope = domain.TokenScopeRead
+	}
+	if !domain.IsValidTokenScope(scope) {
+		return nil, "", ErrInvalidTokenScope
+	}
+
+	random, err := genRandStr(API_TOKEN_LENGTH)
+	if err != nil {
+		log.Println("error generating api token", err)
+		return nil, "", ErrUnknown
+	}
+	token := API_TOKEN_PREFIX + random
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	apiToken := &domain.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Scope:     scope,
+		TokenHash: hashToken(token),
+		Prefix:    token[:API_TOKEN_DISPLAY_LENGTH],
+		ExpiresAt: expiresAt,
+	}
+	if err = s.db.WithContext(ctx).Create(apiToken).Error; err != nil {
+		log.Println("error creating api token", err)
+		return nil, "", ErrUnknown
+	}
+	return apiToken, token, nil
+}
+
+// GetTokens returns every API token a user has created, newest first.
+func (s *apiTokenService) GetTokens(userID uint) ([]domain.APIToken, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var tokens []domain.APIToken
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error
+	if err != nil {
+		log.Println("error getting api tokens", err)
+		return nil, ErrUnknown
+	}
+	return tokens, nil
+}
+
+// RevokeToken stops one of a user's API tokens from being used.
+func (s *apiTokenService) RevokeToken(userID, tokenID uint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	result := s.db.WithContext(ctx).
+		Model(&domain.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Println("error revoking api token", result.Error)
+		return ErrUnknown
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// revokeAPITokensWithTx stops every active API token of a user from being used.
+func revokeAPITokensWithTx(tx *gorm.DB, userID uint, now time.Time) error {
+	err := tx.Model(&domain.APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+	if err != nil {
+		log.Println("error revoking api tokens", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// Authenticate returns the user an API token belongs to, along with the token
+// so its scope can be checked, and records that the token was used.
+func (s *apiTokenService) Authenticate(token string) (*domain.User, *domain.APIToken, error) {
+	if !strings.HasPrefix(token, API_TOKEN_PREFIX) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var apiToken domain.APIToken
+	err := s.db.WithContext(ctx).Where("token_hash = ?", hashToken(token)).First(&apiToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrAPITokenInvalid
+		}
+		log.Println("error getting api token", err)
+		return nil, nil, ErrUnknown
+	}
+
+	now := time.Now()
+	if !apiToken.Active(now) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+
+	var user domain.User
+	if err = s.db.WithContext(ctx).First(&user, apiToken.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrAPITokenInvalid
+		}
+		log.Println("error getting api token user", err)
+		return nil, nil, ErrUnknown
+	}
+
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) >= API_TOKEN_LAST_USED_INTERVAL {
+		err = s.db.WithContext(ctx).Model(&apiToken).Update("last_used_at", now).Error
+		if err != nil {
+			// a stale last used time is not worth failing the request over
+			log.Println("error updating api token last used", err)
+		}
+	}
+
+	return &user, &apiToken, nil
+}
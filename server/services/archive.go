@@ -0,0 +1,368 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	ARCHIVE_FORMAT  = "go-recipe-archive"
+	ARCHIVE_VERSION = 1
+	// MAX_ARCHIVE_SIZE is the largest archive, compressed or not, that will be imported
+	MAX_ARCHIVE_SIZE = 100 << 20
+	// MAX_ARCHIVE_RECIPE_SIZE is the largest recipe document that will be read from an archive
+	MAX_ARCHIVE_RECIPE_SIZE = 1 << 20
+	// ARCHIVE_IMPORT_TIMEOUT is how long saving an archive's recipes and tags can take
+	ARCHIVE_IMPORT_TIMEOUT = time.Minute
+)
+
+// ArchiveManifest describes the contents of an account archive. It is written
+// to manifest.json at the root of the archive.
+type ArchiveManifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	Username   string    `json:"username"`
+	ExportedAt time.Time `json:"exported_at"`
+	Recipes    []string  `json:"recipes"`
+	Files      []string  `json:"files"`
+}
+
+// ArchiveImportSummary counts what was restored from an archive.
+type ArchiveImportSummary struct {
+	Recipes int `json:"recipes"`
+	Tags    int `json:"tags"`
+	Files   int `json:"files"`
+}
+
+type ArchiveService interface {
+	ExportUser(userID uint, w io.Writer) error
+	ImportArchive(userID uint, archive io.ReaderAt, size int64) (*ArchiveImportSummary, error)
+}
+
+type archiveService struct {
+	db            *gorm.DB
+	ctx           context.Context
+	bucketService BucketService
+}
+
+func NewArchiveService(db *gorm.DB, minio *minio.Client) ArchiveService {
+	ctx := context.Background()
+	return &archiveService{
+		db:            db,
+		ctx:           ctx,
+		bucketService: NewBucketService(db, minio),
+	}
+}
+
+// ExportUser writes a zip archive of everything the user owns to w: a manifest,
+// one JSON document per recipe, the names of the tags on those recipes and every
+// file they have uploaded.
+func (s *archiveService) ExportUser(userID uint, w io.Writer) error {
+	var user domain.User
+	err := s.db.First(&user, userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	var recipes []domain.Recipe
+	err = s.db.
+		Preload("Ingredients").
+		Preload("Instructions", func(db *gorm.DB) *gorm.DB {
+			return db.Order("step")
+		}).
+		Preload("Tags").
+		Where("user_id = ?", userID).
+		Order("id").
+		Find(&recipes).Error
+	if err != nil {
+		return err
+	}
+
+	files, err := s.bucketService.GetFilesByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+
+	manifest := ArchiveManifest{
+		Format:     ARCHIVE_FORMAT,
+		Version:    ARCHIVE_VERSION,
+		Username:   user.Username,
+		ExportedAt: time.Now().UTC(),
+		Recipes:    make([]string, len(recipes)),
+		Files:      make([]string, len(files)),
+	}
+
+	var tags []string
+	seenTags := make(map[string]bool)
+	for i, recipe := range recipes {
+		name := fmt.Sprintf("recipes/%04d-%s.json", i+1, slugify(recipe.Name))
+		manifest.Recipes[i] = name
+		if err = writeArchiveJSON(zw, name, recipe.Snapshot()); err != nil {
+			return err
+		}
+		for _, tag := range recipe.Tags {
+			if !seenTags[tag.Tag] {
+				seenTags[tag.Tag] = true
+				tags = append(tags, tag.Tag)
+			}
+		}
+	}
+
+	if err = writeArchiveJSON(zw, "tags.json", tags); err != nil {
+		return err
+	}
+
+	seenFiles := make(map[string]bool, len(files))
+	for i, file := range files {
+		name := uniqueArchiveName(seenFiles, "files/"+path.Base(file.Name))
+		manifest.Files[i] = name
+		if err = s.writeArchiveFile(zw, name, &file); err != nil {
+			return err
+		}
+	}
+
+	if err = writeArchiveJSON(zw, "manifest.json", manifest); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func (s *archiveService) writeArchiveFile(zw *zip.Writer, name string, file *domain.File) error {
+	data, err := s.bucketService.DownloadFile(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := data.Close(); err != nil {
+			log.Println("failed to close file", err)
+		}
+	}()
+
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, data)
+	return err
+}
+
+// uniqueArchiveName returns name, or if it has been seen already, name with a
+// number before its extension, e.g. "files/photo-2.jpg", and records it as seen.
+func uniqueArchiveName(seen map[string]bool, name string) string {
+	unique := name
+	ext := path.Ext(name)
+	for n := 2; seen[unique]; n++ {
+		unique = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	seen[unique] = true
+	return unique
+}
+
+func writeArchiveJSON(zw *zip.Writer, name string, v any) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ImportArchive restores an archive written by ExportUser into the user's account.
+// Tags are matched to existing tags by name and only created if missing.
+// The whole archive is read and validated before anything is saved, and then
+// everything in it is saved together, so a failed import leaves nothing behind.
+func (s *archiveService) ImportArchive(userID uint, archive io.ReaderAt, size int64) (*ArchiveImportSummary, error) {
+	if size > MAX_ARCHIVE_SIZE {
+		return nil, ErrArchiveTooLarge
+	}
+
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+
+	manifest, recipes, tags, files, err := readArchive(zr)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("importing archive from %s: %d recipes, %d files", manifest.Username, len(recipes), len(files))
+
+	// files are uploaded first, and removed again if the rest cannot be saved
+	uploaded := make([]*domain.File, 0, len(files))
+	for _, f := range files {
+		file, err := s.importArchiveFile(userID, f)
+		if err != nil {
+			s.removeObjects(uploaded)
+			return nil, err
+		}
+		uploaded = append(uploaded, file)
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, ARCHIVE_IMPORT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	if err = importArchiveWithTx(ctx, tx, userID, recipes, tags, uploaded); err != nil {
+		tx.Rollback()
+		s.removeObjects(uploaded)
+		return nil, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		s.removeObjects(uploaded)
+		return nil, ErrCommit
+	}
+
+	return &ArchiveImportSummary{
+		Recipes: len(recipes),
+		Tags:    len(tags),
+		Files:   len(uploaded),
+	}, nil
+}
+
+// importArchiveWithTx saves an archive's tags, recipes and uploaded files to the user's account.
+func importArchiveWithTx(ctx context.Context, tx *gorm.DB, userID uint, recipes []domain.RecipeSnapshot, tags []string, files []*domain.File) error {
+	for _, tag := range tags {
+		if _, err := findOrCreateTagWithTx(tx, tag); err != nil {
+			return err
+		}
+	}
+
+	for _, snapshot := range recipes {
+		recipe := snapshot.Recipe()
+		if _, err := importRecipeWithTx(ctx, tx, userID, &recipe); err != nil {
+			return err
+		}
+	}
+
+	if len(files) > 0 {
+		if err := tx.Create(files).Error; err != nil {
+			log.Println("error creating imported files", err)
+			return ErrUnknown
+		}
+	}
+	return nil
+}
+
+// importArchiveFile uploads a file from an archive to the bucket without saving it.
+func (s *archiveService) importArchiveFile(userID uint, f *zip.File) (*domain.File, error) {
+	filename, err := url.QueryUnescape(path.Base(f.Name))
+	if err != nil {
+		filename = path.Base(f.Name)
+	}
+
+	data, err := f.Open()
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	defer func() {
+		if err := data.Close(); err != nil {
+			log.Println("failed to close file", err)
+		}
+	}()
+
+	return s.bucketService.PutObject(userID, filename, data, int64(f.UncompressedSize64))
+}
+
+// removeObjects removes the objects of files that were uploaded for an import that failed.
+func (s *archiveService) removeObjects(files []*domain.File) {
+	for _, file := range files {
+		if err := s.bucketService.RemoveObject(file.Name); err != nil {
+			log.Println("failed to remove object", err)
+		}
+	}
+}
+
+// readArchive reads and validates the manifest, recipes and tags in an archive and
+// returns the file entries still to be uploaded.
+func readArchive(zr *zip.Reader) (*ArchiveManifest, []domain.RecipeSnapshot, []string, []*zip.File, error) {
+	var (
+		manifest *ArchiveManifest
+		recipes  []domain.RecipeSnapshot
+		tags     []string
+		files    []*zip.File
+		total    uint64
+	)
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		total += f.UncompressedSize64
+		if total > MAX_ARCHIVE_SIZE {
+			return nil, nil, nil, nil, ErrArchiveTooLarge
+		}
+
+		switch {
+		case f.Name == "manifest.json":
+			manifest = &ArchiveManifest{}
+			if err := readArchiveJSON(f, manifest); err != nil {
+				return nil, nil, nil, nil, err
+			}
+		case f.Name == "tags.json":
+			if err := readArchiveJSON(f, &tags); err != nil {
+				return nil, nil, nil, nil, err
+			}
+		case strings.HasPrefix(f.Name, "recipes/") && strings.HasSuffix(f.Name, ".json"):
+			var recipe domain.RecipeSnapshot
+			if err := readArchiveJSON(f, &recipe); err != nil {
+				return nil, nil, nil, nil, err
+			}
+			if strings.TrimSpace(recipe.Name) == "" {
+				return nil, nil, nil, nil, ErrInvalidArchive
+			}
+			recipes = append(recipes, recipe)
+		case strings.HasPrefix(f.Name, "files/"):
+			files = append(files, f)
+		}
+	}
+
+	if manifest == nil || manifest.Format != ARCHIVE_FORMAT {
+		return nil, nil, nil, nil, ErrInvalidArchive
+	}
+	if manifest.Version > ARCHIVE_VERSION {
+		return nil, nil, nil, nil, ErrUnsupportedArchiveVersion
+	}
+
+	return manifest, recipes, tags, files, nil
+}
+
+func readArchiveJSON(f *zip.File, v any) error {
+	if f.UncompressedSize64 > MAX_ARCHIVE_RECIPE_SIZE {
+		return ErrArchiveTooLarge
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return ErrInvalidArchive
+	}
+	defer r.Close()
+
+	err = json.NewDecoder(io.LimitReader(r, MAX_ARCHIVE_RECIPE_SIZE)).Decode(v)
+	if err != nil {
+		return ErrInvalidArchive
+	}
+	return nil
+}
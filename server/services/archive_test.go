@@ -0,0 +1,216 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"io"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeBucketService keeps the objects in the bucket in memory, and tracks
+// which were put in and removed.
+type fakeBucketService struct {
+	BucketService
+	objects map[string]bool
+	put     []string
+	removed []string
+}
+
+func (b *fakeBucketService) PutObject(userID uint, filename string, _ io.Reader, _ int64) (*domain.File, error) {
+	name, err := newObjectName(userID, filename)
+	if err != nil {
+		return nil, err
+	}
+	b.objects[name] = true
+	b.put = append(b.put, name)
+	return &domain.File{Name: name, UserID: userID}, nil
+}
+
+func (b *fakeBucketService) RemoveObject(objectName string) error {
+	delete(b.objects, objectName)
+	b.removed = append(b.removed, objectName)
+	return nil
+}
+
+func buildArchive(t *testing.T, entries map[string]any) *zip.Reader {
+	t.Helper()
+
+	data := buildArchiveBytes(t, entries)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func buildArchiveBytes(t *testing.T, entries map[string]any) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, v := range entries {
+		if err := writeArchiveJSON(zw, name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	snapshot := exportFixture().Snapshot()
+
+	zr := buildArchive(t, map[string]any{
+		"manifest.json":                    ArchiveManifest{Format: ARCHIVE_FORMAT, Version: ARCHIVE_VERSION, Username: "jackson"},
+		"tags.json":                        []string{"curry", "vegan"},
+		"recipes/0001-chickpea-curry.json": snapshot,
+		"files/hero.jpg":                   "not really a jpeg",
+	})
+
+	manifest, recipes, tags, files, err := readArchive(zr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if manifest.Username != "jackson" {
+		t.Errorf("expected username jackson, got %q", manifest.Username)
+	}
+	if len(recipes) != 1 || !reflect.DeepEqual(recipes[0], snapshot) {
+		t.Errorf("expected recipes %+v, got %+v", []domain.RecipeSnapshot{snapshot}, recipes)
+	}
+	if !reflect.DeepEqual(tags, []string{"curry", "vegan"}) {
+		t.Errorf("unexpected tags %q", tags)
+	}
+	if len(files) != 1 || files[0].Name != "files/hero.jpg" {
+		t.Errorf("unexpected files %+v", files)
+	}
+
+	restored := recipes[0].Recipe()
+	if restored.Name != "Chickpea Curry" || len(restored.Ingredients) != 3 || restored.Instructions[1].Step != 2 || restored.Tags[1].Tag != "vegan" {
+		t.Errorf("unexpected restored recipe %+v", restored)
+	}
+}
+
+func TestReadArchive_invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  map[string]any
+		expected error
+	}{
+		{
+			name:     "no manifest",
+			entries:  map[string]any{"tags.json": []string{}},
+			expected: ErrInvalidArchive,
+		},
+		{
+			name:     "wrong format",
+			entries:  map[string]any{"manifest.json": ArchiveManifest{Format: "something-else", Version: 1}},
+			expected: ErrInvalidArchive,
+		},
+		{
+			name:     "newer version",
+			entries:  map[string]any{"manifest.json": ArchiveManifest{Format: ARCHIVE_FORMAT, Version: ARCHIVE_VERSION + 1}},
+			expected: ErrUnsupportedArchiveVersion,
+		},
+		{
+			name: "unnamed recipe",
+			entries: map[string]any{
+				"manifest.json":     ArchiveManifest{Format: ARCHIVE_FORMAT, Version: ARCHIVE_VERSION},
+				"recipes/0001.json": domain.RecipeSnapshot{},
+			},
+			expected: ErrInvalidArchive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, _, err := readArchive(buildArchive(t, tt.entries))
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestArchiveService_ImportArchive_rollsBackOnFailure(t *testing.T) {
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the user already has a photo.jpg, which the import must not touch
+	existing, err := newObjectName(1, "photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := &fakeBucketService{objects: map[string]bool{existing: true}}
+	s := &archiveService{db: db, ctx: context.Background(), bucketService: bucket}
+
+	archive := buildArchiveBytes(t, map[string]any{
+		"manifest.json":                    ArchiveManifest{Format: ARCHIVE_FORMAT, Version: ARCHIVE_VERSION},
+		"tags.json":                        []string{"vegan"},
+		"recipes/0001-chickpea-curry.json": exportFixture().Snapshot(),
+		"files/photo.jpg":                  "not really a photo",
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "tags"`).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	summary, err := s.ImportArchive(1, bytes.NewReader(archive), int64(len(archive)))
+	if !errors.Is(err, ErrUnknown) {
+		t.Errorf("expected ErrUnknown, got %v", err)
+	}
+	if summary != nil {
+		t.Errorf("expected no summary, got %+v", summary)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if len(bucket.put) != 1 || bucket.put[0] == existing || path.Base(bucket.put[0]) != "photo.jpg" {
+		t.Errorf("expected photo.jpg to be put in a new object, got %v", bucket.put)
+	}
+	if !reflect.DeepEqual(bucket.removed, bucket.put) {
+		t.Errorf("expected only %v to be removed, got %v", bucket.put, bucket.removed)
+	}
+	if !bucket.objects[existing] {
+		t.Errorf("expected the existing object %s to be kept", existing)
+	}
+}
+
+func TestNewObjectName(t *testing.T) {
+	a, err := newObjectName(1, "my photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newObjectName(1, "my photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("expected two uploads of the same file to get different objects, got %s twice", a)
+	}
+	if !strings.HasPrefix(a, "1/") || path.Base(a) != "my+photo.jpg" {
+		t.Errorf("expected an object under 1/ named my+photo.jpg, got %s", a)
+	}
+}
+
+func TestUniqueArchiveName(t *testing.T) {
+	seen := make(map[string]bool)
+	var got []string
+	for _, name := range []string{"files/photo.jpg", "files/photo.jpg", "files/notes", "files/photo.jpg", "files/notes"} {
+		got = append(got, uniqueArchiveName(seen, name))
+	}
+
+	expected := []string{"files/photo.jpg", "files/photo-2.jpg", "files/notes", "files/photo-3.jpg", "files/notes-2"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -1,27 +1,64 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/platform/mailer"
 	"gorm.io/gorm"
 	"log"
+	"net/url"
+	"time"
 )
 
+// PASSWORD_RESET_TIMEOUT is how long a password reset link can be used for.
+const PASSWORD_RESET_TIMEOUT = time.Hour
+
+// PASSWORD_RESET_TOKEN_LENGTH is the length of the random tokens in password reset links.
+const PASSWORD_RESET_TOKEN_LENGTH = 32
+
 type authService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	ctx    context.Context
+	mail   mailer.Mailer
+	appURL string
 }
 
 type AuthService interface {
 	CreateUser(user domain.User) error
 	GetUserByName(name string) (*domain.User, error)
 	LoginUser(name, password string) (*domain.User, error)
+
+	// PASSWORDS
+	ChangePassword(userID, sessionID uint, currentPassword, newPassword string) error
+	RequestPasswordReset(name string) error
+	ResetPassword(token, newPassword string) error
+
+	// EMAIL
+	ChangeEmail(userID uint, password, email string) error
+	SendVerification(userID uint) error
+	VerifyEmail(token string) error
 }
 
-func NewAuthService(db *gorm.DB) AuthService {
-	return &authService{db: db}
+// NewAuthService creates the auth service. Emails are sent with mail, and link
+// back to the site at appURL, e.g. "https://recipes.example.com".
+func NewAuthService(db *gorm.DB, mail mailer.Mailer, appURL string) AuthService {
+	ctx := context.Background()
+	return &authService{db: db, ctx: ctx, mail: mail, appURL: appURL}
 }
 
+// CreateUser creates a user. If they gave an email address, a link to verify
+// it is sent to them.
 func (s *authService) CreateUser(user domain.User) error {
+	if user.Email != nil {
+		email, ok := domain.NormalizeEmail(*user.Email)
+		if !ok {
+			return ErrInvalidEmail
+		}
+		user.Email = &email
+	}
+	user.EmailVerifiedAt = nil
+
 	salt, err := genRandStr(32)
 	if err != nil {
 		return err
@@ -44,7 +81,17 @@ func (s *authService) CreateUser(user domain.User) error {
 		return ErrUnknown
 	}
 
-	return result.Error
+	if user.Email != nil {
+		ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+		defer cancel()
+
+		// the account is usable without a verified email, and the link can be sent again
+		if err = s.sendVerification(ctx, &user); err != nil {
+			log.Println("error sending verification to new user", err)
+		}
+	}
+
+	return nil
 }
 
 func (s *authService) GetUserByName(name string) (*domain.User, error) {
@@ -78,3 +125,228 @@ func (s *authService) LoginUser(name, password string) (*domain.User, error) {
 
 	return user, nil
 }
+
+// ChangePassword changes a user's password after checking their current one,
+// signs out every session except sessionID and revokes the user's API tokens.
+func (s *authService) ChangePassword(userID, sessionID uint, currentPassword, newPassword string) error {
+	if newPassword == "" {
+		return ErrInvalidPassword
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	user, err := getUserByIdWithTx(s.db.WithContext(ctx), userID)
+	if err != nil {
+		return err
+	}
+
+	if !checkPasswordHash(currentPassword, user.Salt, user.Password) {
+		return ErrPasswordMismatch
+	}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	if err := setPasswordWithTx(tx, userID, newPassword); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Delete(&domain.Session{}, "user_id = ? AND id <> ?", userID, sessionID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Println("error deleting sessions", err)
+		return ErrUnknown
+	}
+
+	if err = revokeAPITokensWithTx(tx, userID, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return ErrCommit
+	}
+	return nil
+}
+
+// RequestPasswordReset emails the user called name a link to reset their
+// password. To avoid revealing which users exist, nothing is returned when
+// there is no such user or nowhere to email them.
+func (s *authService) RequestPasswordReset(name string) error {
+	user, err := s.GetUserByName(name)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	email, err := userEmailWithTx(s.db.WithContext(ctx), user)
+	if err != nil {
+		return err
+	}
+	if email == "" {
+		log.Printf("not sending password reset to user %d: no email address", user.ID)
+		return nil
+	}
+
+	token, err := genRandStr(PASSWORD_RESET_TOKEN_LENGTH)
+	if err != nil {
+		log.Println("error generating password reset token", err)
+		return ErrUnknown
+	}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	// only the newest link works
+	err = tx.Delete(&domain.PasswordReset{}, "user_id = ? AND used_at IS NULL", user.ID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Println("error deleting password resets", err)
+		return ErrUnknown
+	}
+
+	reset := domain.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(PASSWORD_RESET_TIMEOUT),
+	}
+	if err = tx.Create(&reset).Error; err != nil {
+		tx.Rollback()
+		log.Println("error creating password reset", err)
+		return ErrUnknown
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return ErrCommit
+	}
+
+	err = s.mail.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: "Someone asked to reset the password for " + user.Username + ".\n\n" +
+			"To choose a new password, open this link within the next hour:\n\n" +
+			s.appURL + "/reset-password?token=" + url.QueryEscape(token) + "\n\n" +
+			"If you did not ask to reset your password, you can ignore this email.\n",
+	})
+	if err != nil {
+		log.Println("error sending password reset email", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// ResetPassword sets a new password for the user a reset token was sent to,
+// signs out all of their sessions and revokes their API tokens. Each token can
+// only be used once.
+func (s *authService) ResetPassword(token, newPassword string) error {
+	if newPassword == "" {
+		return ErrInvalidPassword
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	var reset domain.PasswordReset
+	err := tx.Where("token_hash = ?", hashToken(token)).First(&reset).Error
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		log.Println("error getting password reset", err)
+		return ErrUnknown
+	}
+
+	now := time.Now()
+	if !reset.Usable(now) {
+		tx.Rollback()
+		return ErrInvalidResetToken
+	}
+
+	// the used_at check makes sure two requests cannot both use the token
+	res := tx.Model(&domain.PasswordReset{}).
+		Where("id = ? AND used_at IS NULL", reset.ID).
+		Update("used_at", now)
+	if res.Error != nil {
+		tx.Rollback()
+		log.Println("error using password reset", res.Error)
+		return ErrUnknown
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrInvalidResetToken
+	}
+
+	if err = setPasswordWithTx(tx, reset.UserID, newPassword); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Delete(&domain.Session{}, "user_id = ?", reset.UserID).Error; err != nil {
+		tx.Rollback()
+		log.Println("error deleting sessions", err)
+		return ErrUnknown
+	}
+
+	if err = revokeAPITokensWithTx(tx, reset.UserID, now); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return ErrCommit
+	}
+	return nil
+}
+
+// setPasswordWithTx hashes password with a new salt and saves it as the user's password.
+func setPasswordWithTx(tx *gorm.DB, userID uint, password string) error {
+	salt, err := genRandStr(32)
+	if err != nil {
+		return err
+	}
+	hashed, err := hashPassword(password, salt)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&domain.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"password": hashed,
+		"salt":     salt,
+	}).Error
+	if err != nil {
+		log.Println("error updating password", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// userEmailWithTx returns the address to email a user at, or "" if there is none.
+// That is their own address once it is verified, or else the latest address an
+// OIDC provider reported as verified for them.
+func userEmailWithTx(tx *gorm.DB, user *domain.User) (string, error) {
+	if user.EmailVerified() {
+		return *user.Email, nil
+	}
+
+	var identity domain.UserIdentity
+	err := tx.Where("user_id = ? AND email <> ''", user.ID).Order("updated_at DESC").First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		log.Println("error getting user email", err)
+		return "", ErrUnknown
+	}
+	return identity.Email, nil
+}
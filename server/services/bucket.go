@@ -2,24 +2,34 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"github.com/jacksonopp/go-recipe/domain"
 	"github.com/minio/minio-go/v7"
 	"gorm.io/gorm"
+	"io"
 	"log"
 	"mime/multipart"
 	"net/url"
+	"path"
 	"time"
 )
 
 const (
 	BUCKET_NAME = "go-recipe"
 	URL_EXPIRY  = time.Hour * 24 * 7
+	// OBJECT_KEY_LENGTH is the length of the random part of object names
+	OBJECT_KEY_LENGTH = 16
 )
 
 type BucketService interface {
 	UploadFile(userID uint, file *multipart.FileHeader) (*domain.File, error)
 	GetFileByObjectName(objectName string) (*domain.File, error)
 	GetFileByID(fileID uint) (*domain.File, error)
+	GetFilesByUserID(userID uint) ([]domain.File, error)
+	UploadObject(userID uint, filename string, data io.Reader, size int64) (*domain.File, error)
+	PutObject(userID uint, filename string, data io.Reader, size int64) (*domain.File, error)
+	RemoveObject(objectName string) error
+	DownloadFile(file *domain.File) (io.ReadCloser, error)
 }
 
 type bucketService struct {
@@ -49,9 +59,43 @@ func (s *bucketService) UploadFile(userID uint, file *multipart.FileHeader) (*do
 		return nil, err
 	}
 
-	filename := url.QueryEscape(file.Filename)
+	return s.UploadObject(userID, file.Filename, data, file.Size)
+}
+
+// UploadObject uploads size bytes read from data to the bucket under filename
+// and creates a database entry for the file
+//
+// satisfying the BucketService interface
+func (s *bucketService) UploadObject(userID uint, filename string, data io.Reader, size int64) (*domain.File, error) {
+	dbFile, err := s.PutObject(userID, filename, data, size)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Create(dbFile).Error
+	if err != nil {
+		if err := s.RemoveObject(dbFile.Name); err != nil {
+			log.Println("failed to remove object", err)
+		}
+		return nil, err
+	}
+
+	return dbFile, nil
+}
+
+// PutObject uploads size bytes read from data to the bucket under filename and
+// returns the file object without saving it, so the caller can save it along
+// with other changes. Every upload gets a new object, so it never replaces
+// another file, even one of the same user's with the same name.
+//
+// satisfying the BucketService interface
+func (s *bucketService) PutObject(userID uint, filename string, data io.Reader, size int64) (*domain.File, error) {
+	objectName, err := newObjectName(userID, filename)
+	if err != nil {
+		return nil, err
+	}
 
-	info, err := s.minio.PutObject(s.ctx, BUCKET_NAME, filename, data, file.Size, minio.PutObjectOptions{})
+	info, err := s.minio.PutObject(s.ctx, BUCKET_NAME, objectName, data, size, minio.PutObjectOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -61,18 +105,29 @@ func (s *bucketService) UploadFile(userID uint, file *multipart.FileHeader) (*do
 		return nil, err
 	}
 
-	dbFile := &domain.File{
+	return &domain.File{
 		Name:      info.Key,
 		Url:       objUrl,
 		UrlExpiry: time.Now().Add(URL_EXPIRY),
 		UserID:    userID,
-	}
-	err = s.db.Create(dbFile).Error
+	}, nil
+}
+
+// RemoveObject removes an object from the bucket
+//
+// satisfying the BucketService interface
+func (s *bucketService) RemoveObject(objectName string) error {
+	return s.minio.RemoveObject(s.ctx, BUCKET_NAME, objectName, minio.RemoveObjectOptions{})
+}
+
+// newObjectName returns a new object name for a file a user uploads, of the form
+// "<userID>/<random>/<filename>", so that path.Base gives back the file name.
+func newObjectName(userID uint, filename string) (string, error) {
+	key, err := genRandStr(OBJECT_KEY_LENGTH)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-
-	return dbFile, nil
+	return fmt.Sprintf("%d/%s/%s", userID, key, url.QueryEscape(filename)), nil
 }
 
 // GetFileByObjectName returns a file object by its object name
@@ -108,10 +163,33 @@ func (s *bucketService) GetFileByID(fileID uint) (*domain.File, error) {
 	return file, nil
 }
 
+// GetFilesByUserID returns every file uploaded by a user
+//
+// satisfying the BucketService interface
+func (s *bucketService) GetFilesByUserID(userID uint) ([]domain.File, error) {
+	var files []domain.File
+	err := s.db.Where("user_id = ?", userID).Order("id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// DownloadFile returns the contents of a file from the bucket. The caller must close the reader.
+//
+// satisfying the BucketService interface
+func (s *bucketService) DownloadFile(file *domain.File) (io.ReadCloser, error) {
+	obj, err := s.minio.GetObject(s.ctx, BUCKET_NAME, file.Name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
 // CreatePresignedUrl creates a presigned URL for an object in the bucket
 func (s *bucketService) createPresignedUrl(objectName string) (string, error) {
 	reqParams := make(url.Values)
-	reqParams.Set("response-content-disposition", "attachment; filename="+objectName)
+	reqParams.Set("response-content-disposition", "attachment; filename="+path.Base(objectName))
 	reqParams.Set("response-content-type", "application/octet-stream")
 	reqParams.Set("response-expires", "Fri, 01 Jan 2100 00:00:00 GMT")
 
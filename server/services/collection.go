@@ -0,0 +1,533 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/db"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+)
+
+type CollectionService interface {
+	CreateCollection(userID uint, name, description, visibility string) (*domain.Collection, error)
+	GetCollection(viewerID, collectionID uint) (*domain.Collection, error)
+	GetUserCollections(username string, viewerID uint, page, limit int) ([]domain.Collection, error)
+	UpdateCollection(userID, collectionID uint, name, description, visibility string) (*domain.Collection, error)
+	DeleteCollection(userID, collectionID uint) error
+
+	AddRecipeToCollection(userID, collectionID, recipeID uint) (*domain.Collection, error)
+	RemoveRecipeFromCollection(userID, collectionID, recipeID uint) (*domain.Collection, error)
+	ReorderCollection(userID, collectionID uint, recipeIDs []uint) (*domain.Collection, error)
+	RemoveHiddenRecipes(userID, collectionID uint) (*domain.Collection, error)
+}
+
+type collectionService struct {
+	db  *gorm.DB
+	ctx context.Context
+}
+
+func NewCollectionService(db *gorm.DB) CollectionService {
+	ctx := context.Background()
+	return &collectionService{db: db, ctx: ctx}
+}
+
+// CreateCollection creates an empty collection. Visibility defaults to private.
+func (s *collectionService) CreateCollection(userID uint, name, description, visibility string) (*domain.Collection, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, ErrCollectionNameRequired
+	}
+	if visibility == "" {
+		visibility = domain.VisibilityPrivate
+	}
+	if !domain.IsValidVisibility(visibility) {
+		return nil, ErrInvalidVisibility
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	collection := &domain.Collection{
+		Name:        name,
+		Description: description,
+		UserID:      userID,
+		Visibility:  visibility,
+		Recipes:     []domain.CollectionRecipe{},
+	}
+	err := s.db.WithContext(ctx).Create(collection).Error
+	if err != nil {
+		log.Println("error creating collection", err)
+		return nil, ErrUnknown
+	}
+	return collection, nil
+}
+
+// GetCollection returns a collection with its recipes in order. Recipes the viewer
+// may not see, e.g. ones made private after they were added, are left out.
+func (s *collectionService) GetCollection(viewerID, collectionID uint) (*domain.Collection, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	collection, err := getCollectionWithTx(s.db.WithContext(ctx), collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !collection.VisibleTo(viewerID) {
+		return nil, ErrCollectionNotFound
+	}
+
+	collection.Recipes = visibleCollectionRecipes(collection.Recipes, viewerID)
+
+	return collection, nil
+}
+
+// GetUserCollections returns a page of a user's collections, without their recipes.
+// Viewers other than the user themselves only see public collections.
+func (s *collectionService) GetUserCollections(username string, viewerID uint, page, limit int) ([]domain.Collection, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var user domain.User
+	err := s.db.WithContext(ctx).Where("username = ?", username).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		log.Println("error getting user", err)
+		return nil, ErrUnknown
+	}
+
+	query := s.db.WithContext(ctx).
+		Scopes(db.Paginate(page, limit)).
+		Where("user_id = ?", user.ID).
+		Order("name, id")
+	if viewerID != user.ID {
+		query = query.Where("visibility = ?", domain.VisibilityPublic)
+	}
+
+	var collections []domain.Collection
+	if err = query.Find(&collections).Error; err != nil {
+		log.Println("error getting collections", err)
+		return nil, ErrUnknown
+	}
+	return collections, nil
+}
+
+// UpdateCollection updates a collection's details. Empty values are left unchanged.
+func (s *collectionService) UpdateCollection(userID, collectionID uint, name, description, visibility string) (*domain.Collection, error) {
+	if visibility != "" && !domain.IsValidVisibility(visibility) {
+		return nil, ErrInvalidVisibility
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+	tx := s.db.WithContext(ctx)
+
+	collection, err := getOwnCollectionWithTx(tx, userID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]any{}
+	if strings.TrimSpace(name) != "" {
+		updates["name"] = name
+	}
+	if description != "" {
+		updates["description"] = description
+	}
+	if visibility != "" {
+		updates["visibility"] = visibility
+	}
+	if len(updates) > 0 {
+		err = tx.Model(&domain.Collection{}).Where("id = ?", collectionID).Updates(updates).Error
+		if err != nil {
+			log.Println("error updating collection", err)
+			return nil, ErrUnknown
+		}
+	}
+
+	collection, err = getCollectionWithTx(tx, collection.ID)
+	if err != nil {
+		return nil, err
+	}
+	collection.Recipes = visibleCollectionRecipes(collection.Recipes, userID)
+	return collection, nil
+}
+
+// DeleteCollection deletes a collection. The recipes in it are not affected.
+func (s *collectionService) DeleteCollection(userID, collectionID uint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	if _, err := getOwnCollectionWithTx(tx, userID, collectionID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err := tx.Where("collection_id = ?", collectionID).Delete(&domain.CollectionRecipe{}).Error
+	if err != nil {
+		log.Println("error removing collection recipes", err)
+		tx.Rollback()
+		return ErrUnknown
+	}
+
+	err = tx.Delete(&domain.Collection{}, collectionID).Error
+	if err != nil {
+		log.Println("error deleting collection", err)
+		tx.Rollback()
+		return ErrUnknown
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return ErrCommit
+	}
+	return nil
+}
+
+// AddRecipeToCollection appends a recipe to the end of a collection. The recipe
+// must be one the collection's owner can find: their own or a public one.
+func (s *collectionService) AddRecipeToCollection(userID, collectionID, recipeID uint) (*domain.Collection, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	collection, err := getOwnCollectionWithTx(tx, userID, collectionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	recipe, err := getRecipeByIdWithTx(ctx, tx, recipeID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !recipe.ListedFor(userID) {
+		tx.Rollback()
+		return nil, ErrRecipeNotFound
+	}
+
+	for _, cr := range collection.Recipes {
+		if cr.RecipeID == recipeID {
+			tx.Rollback()
+			return nil, ErrCollectionConflict
+		}
+	}
+
+	var last int
+	err = tx.Model(&domain.CollectionRecipe{}).
+		Where("collection_id = ?", collectionID).
+		Select("COALESCE(MAX(position), 0)").
+		Scan(&last).Error
+	if err != nil {
+		log.Println("error getting collection position", err)
+		tx.Rollback()
+		return nil, ErrUnknown
+	}
+
+	err = tx.Create(&domain.CollectionRecipe{
+		CollectionID: collectionID,
+		RecipeID:     recipeID,
+		Position:     last + 1,
+	}).Error
+	if err != nil {
+		log.Println("error adding recipe to collection", err)
+		tx.Rollback()
+		return nil, ErrUnknown
+	}
+
+	collection, err = getCollectionWithTx(tx, collectionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return nil, ErrCommit
+	}
+	collection.Recipes = visibleCollectionRecipes(collection.Recipes, userID)
+	return collection, nil
+}
+
+// RemoveRecipeFromCollection removes a recipe from a collection and closes the gap it leaves.
+// Recipes that have since been deleted or hidden from the owner can be removed too.
+func (s *collectionService) RemoveRecipeFromCollection(userID, collectionID, recipeID uint) (*domain.Collection, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	collection, err := getOwnCollectionWithTx(tx, userID, collectionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	recipeIDs, err := getCollectionRecipeIDsWithTx(tx, collection.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	remaining := make([]uint, 0, len(recipeIDs))
+	for _, id := range recipeIDs {
+		if id != recipeID {
+			remaining = append(remaining, id)
+		}
+	}
+	if len(remaining) == len(recipeIDs) {
+		tx.Rollback()
+		return nil, ErrRecipeNotFound
+	}
+
+	err = tx.Where("collection_id = ? AND recipe_id = ?", collectionID, recipeID).Delete(&domain.CollectionRecipe{}).Error
+	if err != nil {
+		log.Println("error removing recipe from collection", err)
+		tx.Rollback()
+		return nil, ErrUnknown
+	}
+
+	if err = setCollectionOrderWithTx(tx, collectionID, remaining); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	collection, err = getCollectionWithTx(tx, collectionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return nil, ErrCommit
+	}
+	collection.Recipes = visibleCollectionRecipes(collection.Recipes, userID)
+	return collection, nil
+}
+
+// ReorderCollection puts a collection's recipes in the given order. recipeIDs
+// must list every recipe the owner sees in the collection exactly once. Recipes
+// that have since been deleted or hidden from the owner are kept at the end.
+func (s *collectionService) ReorderCollection(userID, collectionID uint, recipeIDs []uint) (*domain.Collection, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	collection, err := getOwnCollectionWithTx(tx, userID, collectionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if !isCollectionOrder(visibleCollectionRecipes(collection.Recipes, userID), recipeIDs) {
+		tx.Rollback()
+		return nil, ErrInvalidCollectionOrder
+	}
+
+	all, err := getCollectionRecipeIDsWithTx(tx, collectionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = setCollectionOrderWithTx(tx, collectionID, appendHiddenRecipes(recipeIDs, all)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	collection, err = getCollectionWithTx(tx, collectionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return nil, ErrCommit
+	}
+	collection.Recipes = visibleCollectionRecipes(collection.Recipes, userID)
+	return collection, nil
+}
+
+// RemoveHiddenRecipes removes the recipes that have been deleted or hidden from
+// the owner since they were added to their collection.
+func (s *collectionService) RemoveHiddenRecipes(userID, collectionID uint) (*domain.Collection, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	collection, err := getOwnCollectionWithTx(tx, userID, collectionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	visible := visibleCollectionRecipes(collection.Recipes, userID)
+	recipeIDs := make([]uint, len(visible))
+	for i, cr := range visible {
+		recipeIDs[i] = cr.RecipeID
+	}
+
+	query := tx.Where("collection_id = ?", collectionID)
+	if len(recipeIDs) > 0 {
+		query = query.Where("recipe_id NOT IN ?", recipeIDs)
+	}
+	if err = query.Delete(&domain.CollectionRecipe{}).Error; err != nil {
+		log.Println("error removing hidden recipes from collection", err)
+		tx.Rollback()
+		return nil, ErrUnknown
+	}
+
+	if err = setCollectionOrderWithTx(tx, collectionID, recipeIDs); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	collection, err = getCollectionWithTx(tx, collectionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return nil, ErrCommit
+	}
+	collection.Recipes = visibleCollectionRecipes(collection.Recipes, userID)
+	return collection, nil
+}
+
+// visibleCollectionRecipes leaves out the recipes the viewer may not see, e.g.
+// ones made private after they were added.
+func visibleCollectionRecipes(recipes []domain.CollectionRecipe, viewerID uint) []domain.CollectionRecipe {
+	visible := make([]domain.CollectionRecipe, 0, len(recipes))
+	for _, cr := range recipes {
+		if cr.Recipe.VisibleTo(viewerID) {
+			visible = append(visible, cr)
+		}
+	}
+	return visible
+}
+
+// appendHiddenRecipes returns recipeIDs followed by the rest of all, in the order they appear in all.
+func appendHiddenRecipes(recipeIDs, all []uint) []uint {
+	placed := make(map[uint]bool, len(recipeIDs))
+	for _, id := range recipeIDs {
+		placed[id] = true
+	}
+
+	order := append(make([]uint, 0, len(all)), recipeIDs...)
+	for _, id := range all {
+		if !placed[id] {
+			order = append(order, id)
+		}
+	}
+	return order
+}
+
+// isCollectionOrder reports whether recipeIDs lists every recipe in current exactly once.
+func isCollectionOrder(current []domain.CollectionRecipe, recipeIDs []uint) bool {
+	if len(current) != len(recipeIDs) {
+		return false
+	}
+
+	inCollection := make(map[uint]bool, len(current))
+	for _, cr := range current {
+		inCollection[cr.RecipeID] = true
+	}
+	for _, id := range recipeIDs {
+		if !inCollection[id] {
+			return false
+		}
+		// each recipe can only be placed once
+		delete(inCollection, id)
+	}
+	return true
+}
+
+func setCollectionOrderWithTx(tx *gorm.DB, collectionID uint, recipeIDs []uint) error {
+	for i, recipeID := range recipeIDs {
+		err := tx.Model(&domain.CollectionRecipe{}).
+			Where("collection_id = ? AND recipe_id = ?", collectionID, recipeID).
+			Update("position", i+1).Error
+		if err != nil {
+			log.Println("error ordering collection", err)
+			return ErrUnknown
+		}
+	}
+	return nil
+}
+
+// getCollectionWithTx returns a collection with its recipes in order. Recipes
+// that have been deleted are left out.
+func getCollectionWithTx(tx *gorm.DB, collectionID uint) (*domain.Collection, error) {
+	var collection domain.Collection
+	err := tx.
+		Preload("Recipes", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("position")
+		}).
+		Preload("Recipes.Recipe").
+		Preload("Recipes.Recipe.Ingredients").
+		Preload("Recipes.Recipe.Instructions", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("instructions.step ASC")
+		}).
+		Preload("Recipes.Recipe.Tags").
+		Preload("Recipes.Recipe.ForkedFrom").
+		First(&collection, collectionID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCollectionNotFound
+		}
+		log.Println("error getting collection", err)
+		return nil, ErrUnknown
+	}
+
+	recipes := make([]domain.CollectionRecipe, 0, len(collection.Recipes))
+	for _, cr := range collection.Recipes {
+		if cr.Recipe.ID != 0 {
+			recipes = append(recipes, cr)
+		}
+	}
+	collection.Recipes = recipes
+
+	return &collection, nil
+}
+
+// getCollectionRecipeIDsWithTx returns the IDs of every recipe in a collection in
+// order, including ones that have been deleted.
+func getCollectionRecipeIDsWithTx(tx *gorm.DB, collectionID uint) ([]uint, error) {
+	var recipeIDs []uint
+	err := tx.Model(&domain.CollectionRecipe{}).
+		Where("collection_id = ?", collectionID).
+		Order("position").
+		Pluck("recipe_id", &recipeIDs).Error
+	if err != nil {
+		log.Println("error getting collection recipes", err)
+		return nil, ErrUnknown
+	}
+	return recipeIDs, nil
+}
+
+func getOwnCollectionWithTx(tx *gorm.DB, userID, collectionID uint) (*domain.Collection, error) {
+	collection, err := getCollectionWithTx(tx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if collection.UserID != userID {
+		// other users' private collections are reported as missing, not forbidden
+		if !collection.VisibleTo(userID) {
+			return nil, ErrCollectionNotFound
+		}
+		return nil, ErrUnauthorized
+	}
+	return collection, nil
+}
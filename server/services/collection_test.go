@@ -0,0 +1,53 @@
+package services
+
+import (
+	"github.com/jacksonopp/go-recipe/domain"
+	"reflect"
+	"testing"
+)
+
+func TestIsCollectionOrder(t *testing.T) {
+	current := []domain.CollectionRecipe{{RecipeID: 1}, {RecipeID: 2}, {RecipeID: 3}}
+
+	tests := []struct {
+		name      string
+		recipeIDs []uint
+		valid     bool
+	}{
+		{"same order", []uint{1, 2, 3}, true},
+		{"reversed", []uint{3, 2, 1}, true},
+		{"missing a recipe", []uint{1, 2}, false},
+		{"extra recipe", []uint{1, 2, 3, 4}, false},
+		{"unknown recipe", []uint{1, 2, 4}, false},
+		{"duplicate recipe", []uint{1, 1, 2}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCollectionOrder(current, tt.recipeIDs); got != tt.valid {
+				t.Errorf("expected %v, got %v", tt.valid, got)
+			}
+		})
+	}
+}
+
+func TestAppendHiddenRecipes(t *testing.T) {
+	tests := []struct {
+		name      string
+		recipeIDs []uint
+		all       []uint
+		expected  []uint
+	}{
+		{"nothing hidden", []uint{3, 1, 2}, []uint{1, 2, 3}, []uint{3, 1, 2}},
+		{"hidden kept at the end", []uint{3, 1}, []uint{1, 2, 3, 4}, []uint{3, 1, 2, 4}},
+		{"only hidden", []uint{}, []uint{2, 1}, []uint{2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := appendHiddenRecipes(tt.recipeIDs, tt.all); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+type CommentService interface {
+	CreateComment(userID, recipeID uint, instructionID, parentID *uint, body string) (*domain.Comment, error)
+	GetComments(viewerID, recipeID uint, instructionID *uint) ([]*domain.Comment, error)
+	UpdateComment(userID, commentID uint, body string) (*domain.Comment, error)
+	DeleteComment(userID, commentID uint) error
+}
+
+type commentService struct {
+	db  *gorm.DB
+	ctx context.Context
+}
+
+func NewCommentService(db *gorm.DB) CommentService {
+	ctx := context.Background()
+	return &commentService{db: db, ctx: ctx}
+}
+
+// CreateComment adds a comment to a recipe the user can see. The comment is on
+// the instruction step with instructionID if it is set, and is a reply to the
+// comment with parentID if that is set. Replies are always on their parent's step.
+func (s *commentService) CreateComment(userID, recipeID uint, instructionID, parentID *uint, body string) (*domain.Comment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, ErrCommentBodyRequired
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	recipe, err := getVisibleRecipeWithTx(ctx, tx, userID, recipeID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID != nil {
+		parent, err := getCommentWithTx(tx, *parentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent.RecipeID != recipeID || parent.IsRemoved() {
+			return nil, ErrCommentNotFound
+		}
+		instructionID = parent.InstructionID
+	} else if instructionID != nil {
+		found := false
+		for _, instruction := range recipe.Instructions {
+			if instruction.ID == *instructionID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrInstructionNotFound
+		}
+	}
+
+	comment := &domain.Comment{
+		RecipeID:      recipeID,
+		InstructionID: instructionID,
+		ParentID:      parentID,
+		UserID:        userID,
+		Body:          body,
+	}
+	if err = tx.Create(comment).Error; err != nil {
+		log.Println("error creating comment", err)
+		return nil, ErrUnknown
+	}
+	return comment, nil
+}
+
+// GetComments returns the comment threads on a recipe, oldest first. When
+// instructionID is set only the threads on that instruction step are returned.
+func (s *commentService) GetComments(viewerID, recipeID uint, instructionID *uint) ([]*domain.Comment, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	if _, err := getVisibleRecipeWithTx(ctx, tx, viewerID, recipeID, ""); err != nil {
+		return nil, err
+	}
+
+	query := tx.Where("recipe_id = ?", recipeID)
+	if instructionID != nil {
+		query = query.Where("instruction_id = ?", *instructionID)
+	}
+
+	var comments []domain.Comment
+	err := query.Order("created_at ASC, id ASC").Find(&comments).Error
+	if err != nil {
+		log.Println("error getting comments", err)
+		return nil, ErrUnknown
+	}
+	return domain.BuildCommentThreads(comments), nil
+}
+
+// UpdateComment changes the body of a comment. Only the author can edit it.
+func (s *commentService) UpdateComment(userID, commentID uint, body string) (*domain.Comment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, ErrCommentBodyRequired
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	comment, err := getCommentWithTx(tx, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.IsRemoved() {
+		return nil, ErrCommentNotFound
+	}
+	if comment.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	now := time.Now()
+	comment.Body = body
+	comment.EditedAt = &now
+	if err = tx.Save(comment).Error; err != nil {
+		log.Println("error updating comment", err)
+		return nil, ErrUnknown
+	}
+	return comment, nil
+}
+
+// DeleteComment removes a comment. Its author can remove it, and so can the owner
+// of the recipe to moderate the discussion. Replies to the comment are kept.
+func (s *commentService) DeleteComment(userID, commentID uint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	comment, err := getCommentWithTx(tx, commentID)
+	if err != nil {
+		return err
+	}
+	if comment.IsRemoved() {
+		return ErrCommentNotFound
+	}
+
+	if comment.UserID != userID {
+		var recipe domain.Recipe
+		err = tx.Select("id", "user_id").First(&recipe, comment.RecipeID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("error getting comment recipe", err)
+			return ErrUnknown
+		}
+		if recipe.UserID != userID {
+			return ErrUnauthorized
+		}
+	}
+
+	now := time.Now()
+	err = tx.Model(comment).Updates(map[string]any{
+		"removed_at":    &now,
+		"removed_by_id": userID,
+	}).Error
+	if err != nil {
+		log.Println("error removing comment", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// moveCommentsToRecipeWithTx moves the comments on instruction steps that are being
+// deleted to the recipe itself, so the discussion is kept.
+func moveCommentsToRecipeWithTx(tx *gorm.DB, instructionIDs []uint) error {
+	err := tx.Model(&domain.Comment{}).
+		Where("instruction_id IN ?", instructionIDs).
+		UpdateColumn("instruction_id", nil).Error
+	if err != nil {
+		log.Println("error moving comments to recipe", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+func getCommentWithTx(tx *gorm.DB, commentID uint) (*domain.Comment, error) {
+	var comment domain.Comment
+	err := tx.First(&comment, commentID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		log.Println("error getting comment", err)
+		return nil, ErrUnknown
+	}
+	return &comment, nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+)
+
+// commentRows is comment 1 on recipe 1, written by user 2.
+func commentRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "recipe_id", "user_id", "body"}).AddRow(1, 1, 2, "Needs more salt")
+}
+
+func TestCommentService_UpdateComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   uint
+		expected error
+	}{
+		{"author", 2, nil},
+		// not even the recipe owner can put words in someone else's mouth
+		{"someone else", 3, ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := mockDb()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &commentService{db: db, ctx: context.Background()}
+
+			mock.ExpectQuery(`SELECT \* FROM "comments"`).WithArgs(1, 1).WillReturnRows(commentRows())
+			if tt.expected == nil {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "comments" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			comment, err := s.UpdateComment(tt.userID, 1, "Needs less salt")
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, err)
+			}
+			if err == nil && (comment.Body != "Needs less salt" || comment.EditedAt == nil) {
+				t.Errorf("expected an edited comment, got %+v", comment)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCommentService_DeleteComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   uint
+		expected error
+	}{
+		{"author", 2, nil},
+		{"recipe owner", 1, nil},
+		{"someone else", 3, ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := mockDb()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &commentService{db: db, ctx: context.Background()}
+
+			mock.ExpectQuery(`SELECT \* FROM "comments"`).WithArgs(1, 1).WillReturnRows(commentRows())
+			if tt.userID != 2 {
+				mock.ExpectQuery(`SELECT "id","user_id" FROM "recipes"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, 1))
+			}
+			if tt.expected == nil {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "comments" SET "removed_at"=\$1,"removed_by_id"=\$2,"updated_at"=\$3 WHERE "id" = \$4`).
+					WithArgs(sqlmock.AnyArg(), tt.userID, sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			if err = s.DeleteComment(tt.userID, 1); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/platform/mailer"
+	"gorm.io/gorm"
+	"log"
+	"net/url"
+	"time"
+)
+
+// EMAIL_VERIFICATION_TIMEOUT is how long an email verification link can be used for.
+const EMAIL_VERIFICATION_TIMEOUT = 24 * time.Hour
+
+// EMAIL_VERIFICATION_TOKEN_LENGTH is the length of the random tokens in email verification links.
+const EMAIL_VERIFICATION_TOKEN_LENGTH = 32
+
+// ChangeEmail changes a user's email address after checking their password.
+// The new address has to be verified again, so a verification link is sent to
+// it, and the old address is told about the change if it was verified.
+// Whether another user has the address is only checked when it is verified.
+func (s *authService) ChangeEmail(userID uint, password, email string) error {
+	email, ok := domain.NormalizeEmail(email)
+	if !ok {
+		return ErrInvalidEmail
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	user, err := getUserByIdWithTx(s.db.WithContext(ctx), userID)
+	if err != nil {
+		return err
+	}
+	if !checkPasswordHash(password, user.Salt, user.Password) {
+		return ErrPasswordMismatch
+	}
+
+	if user.Email != nil && *user.Email == email {
+		if user.EmailVerified() {
+			return nil
+		}
+		return s.sendVerification(ctx, user)
+	}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	err = tx.Model(&domain.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"email":             email,
+		"email_verified_at": nil,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		log.Println("error updating email", err)
+		return ErrUnknown
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return ErrCommit
+	}
+
+	if user.EmailVerified() {
+		err = s.mail.Send(ctx, emailChangedMessage(user.Username, *user.Email, email))
+		if err != nil {
+			// the new address still needs its verification link
+			log.Println("error sending email changed notice", err)
+		}
+	}
+
+	user.Email, user.EmailVerifiedAt = &email, nil
+	return s.sendVerification(ctx, user)
+}
+
+// SendVerification sends a new verification link to a user's email address.
+func (s *authService) SendVerification(userID uint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	user, err := getUserByIdWithTx(s.db.WithContext(ctx), userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == nil {
+		return ErrNoEmail
+	}
+	if user.EmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// VerifyEmail marks the email address a verification token was sent to as
+// verified. Each token can only be used once, and only while the user still
+// has the address it was sent to. An address belongs to the first user to
+// verify it: other users lose their unverified claims on it, and it cannot be
+// verified for anyone else.
+func (s *authService) VerifyEmail(token string) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	var verification domain.EmailVerification
+	err := tx.Where("token_hash = ?", hashToken(token)).First(&verification).Error
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		log.Println("error getting email verification", err)
+		return ErrUnknown
+	}
+
+	now := time.Now()
+	if !verification.Usable(now) {
+		tx.Rollback()
+		return ErrInvalidVerificationToken
+	}
+
+	user, err := getUserByIdWithTx(tx, verification.UserID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+	if user.Email == nil || *user.Email != verification.Email {
+		tx.Rollback()
+		return ErrInvalidVerificationToken
+	}
+
+	// the used_at check makes sure two requests cannot both use the token
+	res := tx.Model(&domain.EmailVerification{}).
+		Where("id = ? AND used_at IS NULL", verification.ID).
+		Update("used_at", now)
+	if res.Error != nil {
+		tx.Rollback()
+		log.Println("error using email verification", res.Error)
+		return ErrUnknown
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrInvalidVerificationToken
+	}
+
+	// deleted users keep their address, as with usernames
+	var taken int64
+	err = tx.Model(&domain.User{}).Unscoped().
+		Where("email = ? AND email_verified_at IS NOT NULL AND id <> ?", verification.Email, user.ID).
+		Count(&taken).Error
+	if err != nil {
+		tx.Rollback()
+		log.Println("error checking email", err)
+		return ErrUnknown
+	}
+	if taken > 0 {
+		tx.Rollback()
+		return ErrEmailAlreadyExists
+	}
+
+	err = tx.Model(&domain.User{}).Where("id = ?", user.ID).Update("email_verified_at", now).Error
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrEmailAlreadyExists
+		}
+		log.Println("error verifying email", err)
+		return ErrUnknown
+	}
+
+	err = tx.Model(&domain.User{}).Unscoped().
+		Where("email = ? AND email_verified_at IS NULL AND id <> ?", verification.Email, user.ID).
+		Update("email", nil).Error
+	if err != nil {
+		tx.Rollback()
+		log.Println("error removing unverified email claims", err)
+		return ErrUnknown
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return ErrCommit
+	}
+	return nil
+}
+
+// sendVerification creates a verification token for the user's current email
+// address and emails it to them. Earlier tokens stop working.
+func (s *authService) sendVerification(ctx context.Context, user *domain.User) error {
+	token, err := genRandStr(EMAIL_VERIFICATION_TOKEN_LENGTH)
+	if err != nil {
+		log.Println("error generating email verification token", err)
+		return ErrUnknown
+	}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	err = tx.Delete(&domain.EmailVerification{}, "user_id = ? AND used_at IS NULL", user.ID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Println("error deleting email verifications", err)
+		return ErrUnknown
+	}
+
+	verification := domain.EmailVerification{
+		UserID:    user.ID,
+		Email:     *user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(EMAIL_VERIFICATION_TIMEOUT),
+	}
+	if err = tx.Create(&verification).Error; err != nil {
+		tx.Rollback()
+		log.Println("error creating email verification", err)
+		return ErrUnknown
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return ErrCommit
+	}
+
+	link := s.appURL + "/verify-email?token=" + url.QueryEscape(token)
+	if err = s.mail.Send(ctx, verifyEmailMessage(user.Username, *user.Email, link)); err != nil {
+		log.Println("error sending email verification", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// getUserByIdWithTx returns the user with the given ID.
+func getUserByIdWithTx(tx *gorm.DB, userID uint) (*domain.User, error) {
+	var user domain.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		log.Println("error getting user", err)
+		return nil, ErrUnknown
+	}
+	return &user, nil
+}
+
+func verifyEmailMessage(username, email, link string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: "Hi " + username + ",\n\n" +
+			"To confirm that " + email + " is your email address, open this link within the next day:\n\n" +
+			link + "\n\n" +
+			"If you did not add this address to an account, you can ignore this email.\n",
+	}
+}
+
+func emailChangedMessage(username, oldEmail, newEmail string) mailer.Message {
+	return mailer.Message{
+		To:      oldEmail,
+		Subject: "Your email address was changed",
+		Body: "Hi " + username + ",\n\n" +
+			"The email address on your account was changed from " + oldEmail + " to " + newEmail + ".\n\n" +
+			"If you did not change it, reset your password straight away.\n",
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jacksonopp/go-recipe/platform/mailer/mailertest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureArg matches any argument and keeps it.
+type captureArg struct {
+	value driver.Value
+}
+
+func (a *captureArg) Match(v driver.Value) bool {
+	a.value = v
+	return true
+}
+
+func userRows(email any, verifiedAt any) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "username", "email", "email_verified_at"}).
+		AddRow(1, "cook", email, verifiedAt)
+}
+
+func TestAuthService_SendVerification(t *testing.T) {
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := mailertest.NewMailer()
+	s := NewAuthService(db, mail, "https://recipes.example.com")
+
+	tokenHash := &captureArg{}
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(userRows("cook@example.com", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "email_verifications"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "email_verifications"`).
+		WithArgs(sqlmock.AnyArg(), 1, "cook@example.com", tokenHash, sqlmock.AnyArg(), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	if err = s.SendVerification(1); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := mail.Last()
+	if !ok {
+		t.Fatal("expected a verification email")
+	}
+	if msg.To != "cook@example.com" {
+		t.Errorf("expected email to cook@example.com, got %s", msg.To)
+	}
+
+	// the emailed token is the one whose hash was stored
+	start := strings.Index(msg.Body, "https://recipes.example.com/verify-email?")
+	if start < 0 {
+		t.Fatalf("expected a verification link, got:\n%s", msg.Body)
+	}
+	link, err := url.Parse(strings.Fields(msg.Body[start:])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := link.Query().Get("token")
+	if len(token) != EMAIL_VERIFICATION_TOKEN_LENGTH || hashToken(token) != tokenHash.value {
+		t.Errorf("expected the stored hash %v to be of the emailed token %q", tokenHash.value, token)
+	}
+}
+
+func TestAuthService_SendVerification_nothingToVerify(t *testing.T) {
+	tests := map[string]struct {
+		email      any
+		verifiedAt any
+		err        error
+	}{
+		"no email": {nil, nil, ErrNoEmail},
+		"verified": {"cook@example.com", time.Now(), ErrEmailAlreadyVerified},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := mockDb()
+			if err != nil {
+				t.Fatal(err)
+			}
+			mail := mailertest.NewMailer()
+			s := &authService{db: db, ctx: context.Background(), mail: mail}
+
+			mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(userRows(tt.email, tt.verifiedAt))
+
+			if err = s.SendVerification(1); !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+			if len(mail.Messages()) != 0 {
+				t.Errorf("expected no emails, got %v", mail.Messages())
+			}
+		})
+	}
+}
+
+func TestAuthService_VerifyEmail(t *testing.T) {
+	tests := map[string]struct {
+		taken    int
+		expected error
+	}{
+		"unclaimed": {0, nil},
+		// someone else verified the address after the link was sent
+		"verified by another user": {1, ErrEmailAlreadyExists},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := mockDb()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewAuthService(db, mailertest.NewMailer(), "https://recipes.example.com")
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT \* FROM "email_verifications"`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "email", "token_hash", "expires_at", "used_at"}).
+					AddRow(1, 1, "cook@example.com", hashToken("token"), time.Now().Add(time.Hour), nil))
+			mock.ExpectQuery(`SELECT \* FROM "users"`).WillReturnRows(userRows("cook@example.com", nil))
+			mock.ExpectExec(`UPDATE "email_verifications" SET "used_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE email = \$1 AND email_verified_at IS NOT NULL AND id <> \$2`).
+				WithArgs("cook@example.com", 1).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.taken))
+			if tt.expected == nil {
+				mock.ExpectExec(`UPDATE "users" SET "email_verified_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				// other accounts' unverified claims on the address are dropped
+				mock.ExpectExec(`UPDATE "users" SET "email"=\$1,"updated_at"=\$2 WHERE email = \$3 AND email_verified_at IS NULL AND id <> \$4`).
+					WithArgs(nil, sqlmock.AnyArg(), "cook@example.com", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			if err = s.VerifyEmail("token"); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAuthService_ChangeEmail_unverifiedClaim(t *testing.T) {
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := mailertest.NewMailer()
+	s := NewAuthService(db, mail, "https://recipes.example.com")
+
+	hashed, err := hashPassword("password", "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing checks whether another user has claimed the address, so the
+	// response does not tell who has
+	mock.ExpectQuery(`SELECT \* FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "salt", "email"}).
+			AddRow(1, "cook", hashed, "salt", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "email"=\$1,"email_verified_at"=\$2`).
+		WithArgs("cook@example.com", nil, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "email_verifications"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO "email_verifications"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	if err = s.ChangeEmail(1, "password", "Cook@Example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if msg, ok := mail.Last(); !ok || msg.To != "cook@example.com" {
+		t.Errorf("expected a verification email to cook@example.com, got %v", mail.Messages())
+	}
+}
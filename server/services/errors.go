@@ -34,6 +34,105 @@ var (
 	// ErrInvalidPassword is returned when a password is invalid
 	ErrInvalidPassword = errors.New("invalid password")
 
+	// ErrInvalidResetToken is returned when a password reset token is unknown, expired or already used
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+
+	// Email errors
+
+	// ErrInvalidEmail is returned when an email address cannot be parsed
+	ErrInvalidEmail = errors.New("invalid email")
+
+	// ErrEmailAlreadyExists is returned when an email address is already verified by another user
+	ErrEmailAlreadyExists = errors.New("email already exists")
+
+	// ErrNoEmail is returned when a user without an email address asks for it to be verified
+	ErrNoEmail = errors.New("no email")
+
+	// ErrEmailAlreadyVerified is returned when a verified email address is sent another verification
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+
+	// ErrInvalidVerificationToken is returned when an email verification token is unknown, expired,
+	// already used, or was sent to an address the user no longer has
+	ErrInvalidVerificationToken = errors.New("invalid email verification token")
+
+	// ErrEmailNotVerified is returned when a user without a verified email address tries to publish
+	ErrEmailNotVerified = errors.New("email not verified")
+
+	// Meal plan errors
+
+	// ErrMealPlanEntryNotFound is returned when a meal plan entry is not found
+	ErrMealPlanEntryNotFound = errors.New("meal plan entry not found")
+
+	// ErrInvalidMealSlot is returned when a meal slot is not breakfast, lunch, dinner or snack
+	ErrInvalidMealSlot = errors.New("invalid meal slot")
+
+	// ErrInvalidServings is returned when planned servings are not a positive number
+	ErrInvalidServings = errors.New("invalid servings")
+
+	// ErrInvalidDateRange is returned when a date range is backwards or too long
+	ErrInvalidDateRange = errors.New("invalid date range")
+
+	// Shopping list errors
+
+	// ErrShoppingListNotFound is returned when a shopping list is not found or not shared with the user
+	ErrShoppingListNotFound = errors.New("shopping list not found")
+
+	// ErrShoppingListNameRequired is returned when a shopping list is renamed to nothing
+	ErrShoppingListNameRequired = errors.New("shopping list name required")
+
+	// ErrShoppingListItemNotFound is returned when a shopping list item is not found
+	ErrShoppingListItemNotFound = errors.New("shopping list item not found")
+
+	// ErrShoppingListItemNameRequired is returned when a shopping list item has no name
+	ErrShoppingListItemNameRequired = errors.New("shopping list item name required")
+
+	// ErrInvalidShoppingListMember is returned when the owner of a shopping list shares it with themselves
+	ErrInvalidShoppingListMember = errors.New("invalid shopping list member")
+
+	// Pantry errors
+
+	// ErrPantryItemNotFound is returned when a pantry item is not found
+	ErrPantryItemNotFound = errors.New("pantry item not found")
+
+	// ErrPantryItemNameRequired is returned when a pantry item has no name
+	ErrPantryItemNameRequired = errors.New("pantry item name required")
+
+	// Follow errors
+
+	// ErrFollowSelf is returned when a user tries to follow themselves
+	ErrFollowSelf = errors.New("cannot follow self")
+
+	// OIDC errors
+
+	// ErrOIDCNotConfigured is returned when signing in with an OIDC provider that has not been configured
+	ErrOIDCNotConfigured = errors.New("oidc not configured")
+
+	// ErrOIDCInvalidState is returned when an OIDC callback does not match a login that was started, or the login expired
+	ErrOIDCInvalidState = errors.New("invalid oidc state")
+
+	// ErrOIDCExchange is returned when the provider will not exchange an authorization code
+	ErrOIDCExchange = errors.New("oidc code exchange failed")
+
+	// ErrOIDCInvalidToken is returned when an ID token cannot be verified or was not issued for the login
+	ErrOIDCInvalidToken = errors.New("invalid oidc id token")
+
+	// ErrOIDCIdentityConflict is returned when a provider account is already linked to another user
+	ErrOIDCIdentityConflict = errors.New("oidc identity linked to another user")
+
+	// API token errors
+
+	// ErrAPITokenNotFound is returned when an API token is not found, or has already been revoked
+	ErrAPITokenNotFound = errors.New("api token not found")
+
+	// ErrAPITokenNameRequired is returned when an API token is created without a name
+	ErrAPITokenNameRequired = errors.New("api token name required")
+
+	// ErrInvalidTokenScope is returned when an API token is created with an unknown scope
+	ErrInvalidTokenScope = errors.New("invalid api token scope")
+
+	// ErrAPITokenInvalid is returned when a bearer token does not match an active API token
+	ErrAPITokenInvalid = errors.New("invalid api token")
+
 	// Recipe errors
 
 	// ErrRecipeNotFound is returned when a recipe is not found
@@ -51,6 +150,54 @@ var (
 	// ErrInstructionConflict is returned when an instruction conflict occurs
 	ErrInstructionConflict = errors.New("instruction conflict")
 
+	// ErrRecipeIncomplete is returned when a recipe without ingredients or instructions is published
+	ErrRecipeIncomplete = errors.New("recipe incomplete")
+
+	// ErrInvalidVisibility is returned when a recipe visibility is not private, unlisted or public
+	ErrInvalidVisibility = errors.New("invalid visibility")
+
+	// ErrShareNotFound is returned when a recipe share link is not found
+	ErrShareNotFound = errors.New("share not found")
+
+	// ErrVersionNotFound is returned when a recipe version is not found
+	ErrVersionNotFound = errors.New("version not found")
+
+	// Review errors
+
+	// ErrReviewNotFound is returned when a review is not found
+	ErrReviewNotFound = errors.New("review not found")
+
+	// ErrReviewConflict is returned when a user reviews a recipe they have already reviewed
+	ErrReviewConflict = errors.New("review conflict")
+
+	// ErrInvalidRating is returned when a rating is not a whole number of stars from 1 to 5
+	ErrInvalidRating = errors.New("invalid rating")
+
+	// ErrOwnRecipeReview is returned when a user tries to review their own recipe
+	ErrOwnRecipeReview = errors.New("cannot review own recipe")
+
+	// Comment errors
+
+	// ErrCommentNotFound is returned when a comment is not found or has been removed
+	ErrCommentNotFound = errors.New("comment not found")
+
+	// ErrCommentBodyRequired is returned when a comment is empty
+	ErrCommentBodyRequired = errors.New("comment body required")
+
+	// Collection errors
+
+	// ErrCollectionNotFound is returned when a collection is not found
+	ErrCollectionNotFound = errors.New("collection not found")
+
+	// ErrCollectionNameRequired is returned when a collection is created without a name
+	ErrCollectionNameRequired = errors.New("collection name required")
+
+	// ErrCollectionConflict is returned when a recipe is already in a collection
+	ErrCollectionConflict = errors.New("recipe already in collection")
+
+	// ErrInvalidCollectionOrder is returned when a new order does not list exactly the recipes in a collection
+	ErrInvalidCollectionOrder = errors.New("invalid collection order")
+
 	// Tag Errors
 
 	// ErrTagNotFound is returned when a tag is not found
@@ -69,4 +216,29 @@ var (
 
 	// Bucket errors
 	ErrFileNotFound = errors.New("item not found")
+
+	// Import errors
+
+	// ErrInvalidImportUrl is returned when an import url is not an absolute http(s) url
+	ErrInvalidImportUrl = errors.New("invalid import url")
+
+	// ErrImportFetch is returned when the page to import cannot be fetched
+	ErrImportFetch = errors.New("import fetch failed")
+
+	// ErrNoRecipeInPage is returned when a page has no schema.org recipe
+	ErrNoRecipeInPage = errors.New("no recipe in page")
+
+	// Export errors
+
+	// ErrUnknownExportFormat is returned when a recipe is exported to an unsupported format
+	ErrUnknownExportFormat = errors.New("unknown export format")
+
+	// Archive errors
+
+	// ErrInvalidArchive is returned when an uploaded archive is not one written by the account export
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrUnsupportedArchiveVersion is returned when an archive was written by a newer version of the server
+	ErrUnsupportedArchiveVersion = errors.New("unsupported archive version")
+	// ErrArchiveTooLarge is returned when an archive or one of its entries is over the size limit
+	ErrArchiveTooLarge = errors.New("archive too large")
 )
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Export formats supported by ExportService.
+const (
+	ExportFormatJSONLD   = "jsonld"
+	ExportFormatMarkdown = "markdown"
+	ExportFormatCooklang = "cooklang"
+)
+
+// RecipeExport is a recipe rendered in one of the export formats.
+type RecipeExport struct {
+	Filename    string
+	ContentType string
+	Body        []byte
+}
+
+type ExportService interface {
+	ExportRecipe(viewerID, recipeID uint, shareToken, format string) (*RecipeExport, error)
+}
+
+type exportService struct {
+	db  *gorm.DB
+	ctx context.Context
+}
+
+func NewExportService(db *gorm.DB) ExportService {
+	ctx := context.Background()
+	return &exportService{db: db, ctx: ctx}
+}
+
+// ExportRecipe renders the recipe with the given ID as schema.org JSON-LD, Markdown or Cooklang,
+// if the viewer may see it.
+func (s *exportService) ExportRecipe(viewerID, recipeID uint, shareToken, format string) (*RecipeExport, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	recipe, err := getVisibleRecipeWithTx(ctx, s.db, viewerID, recipeID, shareToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var author domain.User
+	err = s.db.WithContext(ctx).Select("id", "username").First(&author, recipe.UserID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println("error getting recipe author", err)
+		return nil, ErrUnknown
+	}
+
+	slug := slugify(recipe.Name)
+	switch format {
+	case ExportFormatJSONLD:
+		body, err := renderJSONLD(recipe, author.Username)
+		if err != nil {
+			log.Println("error rendering json-ld", err)
+			return nil, ErrUnknown
+		}
+		return &RecipeExport{Filename: slug + ".jsonld", ContentType: "application/ld+json", Body: body}, nil
+	case ExportFormatMarkdown:
+		return &RecipeExport{Filename: slug + ".md", ContentType: "text/markdown; charset=utf-8", Body: renderMarkdown(recipe)}, nil
+	case ExportFormatCooklang:
+		return &RecipeExport{Filename: slug + ".cook", ContentType: "text/plain; charset=utf-8", Body: renderCooklang(recipe)}, nil
+	default:
+		return nil, ErrUnknownExportFormat
+	}
+}
+
+// renderJSONLD renders a recipe as a schema.org Recipe, suitable for embedding in a
+// <script type="application/ld+json"> tag.
+func renderJSONLD(recipe *domain.Recipe, author string) ([]byte, error) {
+	ingredients := make([]string, len(recipe.Ingredients))
+	for i, ingredient := range recipe.Ingredients {
+		ingredients[i] = ingredientLine(ingredient)
+	}
+
+	instructions := make([]map[string]any, len(recipe.Instructions))
+	for i, instruction := range recipe.Instructions {
+		instructions[i] = map[string]any{
+			"@type":    "HowToStep",
+			"position": i + 1,
+			"text":     instruction.Contents,
+		}
+	}
+
+	doc := map[string]any{
+		"@context":           "https://schema.org",
+		"@type":              "Recipe",
+		"name":               recipe.Name,
+		"recipeYield":        strconv.Itoa(recipe.Servings),
+		"recipeIngredient":   ingredients,
+		"recipeInstructions": instructions,
+	}
+	if recipe.Description != "" {
+		doc["description"] = recipe.Description
+	}
+	if !recipe.CreatedAt.IsZero() {
+		doc["datePublished"] = recipe.CreatedAt.Format("2006-01-02")
+	}
+	if cookTime, ok := isoDurationFromText(recipe.CookTime); ok {
+		doc["cookTime"] = cookTime
+	}
+	if len(recipe.Tags) > 0 {
+		doc["keywords"] = strings.Join(tagNames(recipe), ", ")
+	}
+	if author != "" {
+		doc["author"] = map[string]any{"@type": "Person", "name": author}
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// renderMarkdown renders a recipe as a Markdown document.
+func renderMarkdown(recipe *domain.Recipe) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", recipe.Name)
+	if recipe.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", recipe.Description)
+	}
+
+	fmt.Fprintf(&b, "- **Servings:** %d\n", recipe.Servings)
+	if recipe.CookTime != "" {
+		fmt.Fprintf(&b, "- **Cook time:** %s\n", recipe.CookTime)
+	}
+	if len(recipe.Tags) > 0 {
+		fmt.Fprintf(&b, "- **Tags:** %s\n", strings.Join(tagNames(recipe), ", "))
+	}
+
+	if len(recipe.Ingredients) > 0 {
+		b.WriteString("\n## Ingredients\n\n")
+		for _, ingredient := range recipe.Ingredients {
+			fmt.Fprintf(&b, "- %s\n", ingredientLine(ingredient))
+		}
+	}
+
+	if len(recipe.Instructions) > 0 {
+		b.WriteString("\n## Instructions\n\n")
+		for i, instruction := range recipe.Instructions {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, instruction.Contents)
+		}
+	}
+
+	return []byte(b.String())
+}
+
+// renderCooklang renders a recipe in Cooklang (https://cooklang.org).
+// Cooklang declares ingredients inline, so each ingredient is marked up where its
+// name first appears in the instructions, and any that never appear are gathered
+// into an extra first step. Ingredients without a name are left out.
+func renderCooklang(recipe *domain.Recipe) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, ">> title: %s\n", recipe.Name)
+	if recipe.Description != "" {
+		fmt.Fprintf(&b, ">> description: %s\n", strings.Join(strings.Fields(recipe.Description), " "))
+	}
+	fmt.Fprintf(&b, ">> servings: %d\n", recipe.Servings)
+	if recipe.CookTime != "" {
+		fmt.Fprintf(&b, ">> cook time: %s\n", recipe.CookTime)
+	}
+	if len(recipe.Tags) > 0 {
+		fmt.Fprintf(&b, ">> tags: %s\n", strings.Join(tagNames(recipe), ", "))
+	}
+
+	steps := make([][]cooklangSegment, len(recipe.Instructions))
+	for i, instruction := range recipe.Instructions {
+		steps[i] = []cooklangSegment{{text: strings.Join(strings.Fields(instruction.Contents), " ")}}
+	}
+
+	// longer names are marked up first, so "pepper" cannot match inside "bell pepper"
+	var named []int
+	for i, ingredient := range recipe.Ingredients {
+		if strings.TrimSpace(ingredient.Name) != "" {
+			named = append(named, i)
+		}
+	}
+	sort.SliceStable(named, func(a, b int) bool {
+		return len(recipe.Ingredients[named[a]].Name) > len(recipe.Ingredients[named[b]].Name)
+	})
+	used := make([]bool, len(recipe.Ingredients))
+	for _, i := range named {
+		used[i] = markCooklangIngredient(steps, recipe.Ingredients[i])
+	}
+
+	var unused []string
+	for i, ingredient := range recipe.Ingredients {
+		if !used[i] && strings.TrimSpace(ingredient.Name) != "" {
+			unused = append(unused, cooklangIngredient(ingredient))
+		}
+	}
+
+	if len(unused) > 0 {
+		fmt.Fprintf(&b, "\nYou will need %s.\n", strings.Join(unused, ", "))
+	}
+
+	for _, step := range steps {
+		b.WriteString("\n")
+		for _, segment := range step {
+			b.WriteString(segment.text)
+		}
+		b.WriteString("\n")
+	}
+
+	return []byte(b.String())
+}
+
+// cooklangSegment is part of an instruction step: either plain text, or an
+// ingredient reference that has already been marked up.
+type cooklangSegment struct {
+	text   string
+	markup bool
+}
+
+// markCooklangIngredient marks up the first mention of the ingredient in the
+// plain text of steps, and reports whether there was one.
+func markCooklangIngredient(steps [][]cooklangSegment, ingredient domain.Ingredient) bool {
+	pattern := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(ingredient.Name) + `\b`)
+	for i, step := range steps {
+		for j, segment := range step {
+			if segment.markup {
+				continue
+			}
+			loc := pattern.FindStringIndex(segment.text)
+			if loc == nil {
+				continue
+			}
+			marked := []cooklangSegment{
+				{text: segment.text[:loc[0]]},
+				{text: cooklangIngredient(ingredient), markup: true},
+				{text: segment.text[loc[1]:]},
+			}
+			steps[i] = append(step[:j:j], append(marked, step[j+1:]...)...)
+			return true
+		}
+	}
+	return false
+}
+
+// cooklangIngredient renders an ingredient as a Cooklang ingredient reference, e.g. "@olive oil{2%tbsp}".
+func cooklangIngredient(ingredient domain.Ingredient) string {
+	quantity := ingredient.Quantity
+	if ingredient.Amount != nil && ingredient.AmountMax == nil {
+		// Cooklang has no mixed numbers, so "1 1/2" is written as 1.5
+		quantity = strconv.FormatFloat(*ingredient.Amount, 'f', -1, 64)
+	}
+	if ingredient.Unit != "" {
+		quantity += "%" + ingredient.Unit
+	}
+	return "@" + ingredient.Name + "{" + quantity + "}"
+}
+
+// ingredientLine renders an ingredient the way it would be written in a recipe, e.g. "2 tbsp olive oil".
+func ingredientLine(ingredient domain.Ingredient) string {
+	return strings.Join(strings.Fields(ingredient.Quantity+" "+ingredient.Unit+" "+ingredient.Name), " ")
+}
+
+func tagNames(recipe *domain.Recipe) []string {
+	names := make([]string, len(recipe.Tags))
+	for i, tag := range recipe.Tags {
+		names[i] = tag.Tag
+	}
+	return names
+}
+
+var durationParts = regexp.MustCompile(`(?i)(\d+)\s*(h|hours?|hrs?|m|mins?|minutes?)\b`)
+
+// isoDurationFromText converts free text such as "1 hour 15 minutes" or "45 mins"
+// to an ISO 8601 duration, since that is what schema.org expects.
+func isoDurationFromText(text string) (string, bool) {
+	hours, minutes := 0, 0
+	matches := durationParts.FindAllStringSubmatch(text, -1)
+	for _, m := range matches {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return "", false
+		}
+		if strings.HasPrefix(strings.ToLower(m[2]), "h") {
+			hours += n
+		} else {
+			minutes += n
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	hours += minutes / 60
+	minutes %= 60
+
+	duration := "PT"
+	if hours > 0 {
+		duration += strconv.Itoa(hours) + "H"
+	}
+	if minutes > 0 || hours == 0 {
+		duration += strconv.Itoa(minutes) + "M"
+	}
+	return duration, true
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"github.com/jacksonopp/go-recipe/domain"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportFixture() *domain.Recipe {
+	amount := 1.5
+	return &domain.Recipe{
+		Name:        "Chickpea Curry",
+		Description: "A quick & cozy weeknight curry.",
+		Servings:    4,
+		CookTime:    "1 hour 15 minutes",
+		Ingredients: []domain.Ingredient{
+			{Quantity: "1 1/2", Unit: "cups", Name: "onion", Amount: &amount},
+			{Quantity: "2", Unit: "tbsp", Name: "olive oil"},
+			{Name: "salt"},
+		},
+		Instructions: []domain.Instruction{
+			{Step: 1, Contents: "Dice the onion."},
+			{Step: 2, Contents: "Fry it in the olive oil."},
+		},
+		Tags: []*domain.Tag{{Tag: "curry"}, {Tag: "vegan"}},
+	}
+}
+
+func TestRenderJSONLD_roundTrip(t *testing.T) {
+	recipe := exportFixture()
+	recipe.CreatedAt = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	body, err := renderJSONLD(recipe, "jackson")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := `<html><head><script type="application/ld+json">` + string(body) + `</script></head></html>`
+	parsed, err := parseRecipePage([]byte(page))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if parsed.Name != recipe.Name || parsed.Description != recipe.Description || parsed.Servings != recipe.Servings {
+		t.Errorf("expected %q/%q/%d, got %q/%q/%d", recipe.Name, recipe.Description, recipe.Servings, parsed.Name, parsed.Description, parsed.Servings)
+	}
+	if parsed.CookTime != recipe.CookTime {
+		t.Errorf("expected cook time %q, got %q", recipe.CookTime, parsed.CookTime)
+	}
+
+	var ingredients []string
+	for _, ingredient := range parsed.Ingredients {
+		ingredients = append(ingredients, ingredientLine(ingredient))
+	}
+	expected := []string{"1 1/2 cups onion", "2 tbsp olive oil", "salt"}
+	if !reflect.DeepEqual(ingredients, expected) {
+		t.Errorf("expected ingredients %q, got %q", expected, ingredients)
+	}
+
+	if len(parsed.Instructions) != 2 || parsed.Instructions[1].Contents != "Fry it in the olive oil." {
+		t.Errorf("unexpected instructions %+v", parsed.Instructions)
+	}
+	if len(parsed.Tags) != 2 || parsed.Tags[0].Tag != "curry" {
+		t.Errorf("unexpected tags %+v", parsed.Tags)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	expected := `# Chickpea Curry
+
+A quick & cozy weeknight curry.
+
+- **Servings:** 4
+- **Cook time:** 1 hour 15 minutes
+- **Tags:** curry, vegan
+
+## Ingredients
+
+- 1 1/2 cups onion
+- 2 tbsp olive oil
+- salt
+
+## Instructions
+
+1. Dice the onion.
+2. Fry it in the olive oil.
+`
+	if got := string(renderMarkdown(exportFixture())); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestRenderCooklang(t *testing.T) {
+	got := string(renderCooklang(exportFixture()))
+
+	for _, line := range []string{
+		">> title: Chickpea Curry",
+		">> servings: 4",
+		">> tags: curry, vegan",
+		"You will need @salt{}.",
+		"Dice the @onion{1.5%cups}.",
+		"Fry it in the @olive oil{2%tbsp}.",
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, got)
+		}
+	}
+}
+
+func TestRenderCooklang_overlappingNames(t *testing.T) {
+	recipe := &domain.Recipe{
+		Name:     "Stuffed Peppers",
+		Servings: 2,
+		Ingredients: []domain.Ingredient{
+			{Name: "pepper"},
+			{Quantity: "2", Name: "bell pepper"},
+			{Quantity: "1", Unit: "tbsp"},
+		},
+		Instructions: []domain.Instruction{
+			{Step: 1, Contents: "Halve the bell pepper and season with pepper."},
+		},
+	}
+	got := string(renderCooklang(recipe))
+
+	if !strings.Contains(got, "\nHalve the @bell pepper{2} and season with @pepper{}.\n") {
+		t.Errorf("expected both peppers marked up once in:\n%s", got)
+	}
+	// an ingredient without a name cannot be referenced
+	if strings.Contains(got, "@{") || strings.Contains(got, "You will need") {
+		t.Errorf("expected no reference to the unnamed ingredient in:\n%s", got)
+	}
+}
+
+func TestIsoDurationFromText(t *testing.T) {
+	tests := map[string]string{
+		"1 hour 15 minutes": "PT1H15M",
+		"45 mins":           "PT45M",
+		"90 minutes":        "PT1H30M",
+		"2 hrs":             "PT2H",
+	}
+
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			got, ok := isoDurationFromText(input)
+			if !ok || got != expected {
+				t.Errorf("expected %q, got %q", expected, got)
+			}
+		})
+	}
+
+	if _, ok := isoDurationFromText("overnight"); ok {
+		t.Error("expected no duration for free text")
+	}
+}
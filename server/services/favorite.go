@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/db"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"math"
+)
+
+// FavoriteRecipe saves a recipe to the user's favorites. Favoriting a recipe twice is not an error.
+func (r *recipeService) FavoriteRecipe(userID, recipeID uint) error {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	if _, err := getVisibleRecipeWithTx(ctx, r.db, userID, recipeID, ""); err != nil {
+		return err
+	}
+
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.Favorite{UserID: userID, RecipeID: recipeID}).Error
+	if err != nil {
+		log.Println("error favoriting recipe", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// UnfavoriteRecipe removes a recipe from the user's favorites, if it is there.
+func (r *recipeService) UnfavoriteRecipe(userID, recipeID uint) error {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	err := r.db.WithContext(ctx).
+		Delete(&domain.Favorite{}, "user_id = ? AND recipe_id = ?", userID, recipeID).Error
+	if err != nil {
+		log.Println("error unfavoriting recipe", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// GetUserFavorites returns a page of a user's favorite recipes, most recently
+// saved first, limited to the recipes the viewer could find themselves, along
+// with how many of those there are in all.
+func (r *recipeService) GetUserFavorites(username string, viewerID uint, page, limit int) ([]domain.Recipe, int64, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var user domain.User
+	err := r.db.WithContext(ctx).Where("username = ?", username).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, ErrUserNotFound
+		}
+		log.Println("error getting user", err)
+		return nil, 0, ErrUnknown
+	}
+
+	favorites := func(tx *gorm.DB) *gorm.DB {
+		return tx.
+			Scopes(listedFor(viewerID)).
+			Joins("JOIN favorites ON favorites.recipe_id = recipes.id").
+			Where("favorites.user_id = ?", user.ID)
+	}
+
+	var total int64
+	err = r.db.WithContext(ctx).Model(&domain.Recipe{}).Scopes(favorites).Count(&total).Error
+	if err != nil {
+		log.Println("error counting favorites", err)
+		return nil, 0, ErrUnknown
+	}
+
+	var recipes []domain.Recipe
+	err = r.db.WithContext(ctx).
+		Scopes(favorites, db.Paginate(page, limit)).
+		Preload("Ingredients").
+		Preload("Instructions", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("instructions.step ASC")
+		}).
+		Preload("Tags").
+		Preload("ForkedFrom").
+		Order("favorites.created_at DESC").
+		Find(&recipes).Error
+	if err != nil {
+		log.Println("error getting favorites", err)
+		return nil, 0, ErrUnknown
+	}
+	return recipes, total, nil
+}
+
+// AnnotateRecipes fills in each recipe's favorite count, average rating and
+// number of ratings and, for signed in viewers, whether the viewer has favorited it.
+func (r *recipeService) AnnotateRecipes(viewerID uint, recipes ...*domain.Recipe) error {
+	if len(recipes) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	ids := make([]uint, len(recipes))
+	for i, recipe := range recipes {
+		ids[i] = recipe.ID
+	}
+
+	var counts []struct {
+		RecipeID uint
+		Count    int64
+	}
+	err := r.db.WithContext(ctx).
+		Model(&domain.Favorite{}).
+		Select("recipe_id, COUNT(*) AS count").
+		Where("recipe_id IN ?", ids).
+		Group("recipe_id").
+		Scan(&counts).Error
+	if err != nil {
+		log.Println("error counting favorites", err)
+		return ErrUnknown
+	}
+	favoriteCounts := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		favoriteCounts[c.RecipeID] = c.Count
+	}
+
+	favorited := make(map[uint]bool)
+	if viewerID != 0 {
+		var mine []uint
+		err = r.db.WithContext(ctx).
+			Model(&domain.Favorite{}).
+			Where("user_id = ? AND recipe_id IN ?", viewerID, ids).
+			Pluck("recipe_id", &mine).Error
+		if err != nil {
+			log.Println("error getting favorites", err)
+			return ErrUnknown
+		}
+		for _, id := range mine {
+			favorited[id] = true
+		}
+	}
+
+	var ratings []struct {
+		RecipeID uint
+		Average  float64
+		Count    int64
+	}
+	err = r.db.WithContext(ctx).
+		Model(&domain.Review{}).
+		Select("recipe_id, AVG(rating) AS average, COUNT(*) AS count").
+		Where("recipe_id IN ?", ids).
+		Group("recipe_id").
+		Scan(&ratings).Error
+	if err != nil {
+		log.Println("error getting ratings", err)
+		return ErrUnknown
+	}
+	recipeRatings := make(map[uint]int, len(ratings))
+	for i, rating := range ratings {
+		recipeRatings[rating.RecipeID] = i
+	}
+
+	for _, recipe := range recipes {
+		recipe.FavoriteCount = favoriteCounts[recipe.ID]
+		if i, ok := recipeRatings[recipe.ID]; ok {
+			// one decimal place is plenty for a 5 star scale
+			recipe.RatingAverage = math.Round(ratings[i].Average*10) / 10
+			recipe.RatingCount = ratings[i].Count
+		}
+		if viewerID != 0 {
+			isFavorite := favorited[recipe.ID]
+			recipe.Favorited = &isFavorite
+		}
+	}
+	return nil
+}
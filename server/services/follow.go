@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/db"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+type FollowService interface {
+	FollowUser(followerID uint, username string) error
+	UnfollowUser(followerID uint, username string) error
+	GetFollowers(username string, page, limit int) ([]domain.Follow, error)
+	GetFollowing(username string, page, limit int) ([]domain.Follow, error)
+
+	GetFeed(userID uint, page, limit int) ([]domain.FeedItem, error)
+}
+
+type followService struct {
+	db  *gorm.DB
+	ctx context.Context
+}
+
+func NewFollowService(db *gorm.DB) FollowService {
+	ctx := context.Background()
+	return &followService{db: db, ctx: ctx}
+}
+
+// FollowUser makes the follower follow the user with the given username.
+// Following a user twice is not an error.
+func (s *followService) FollowUser(followerID uint, username string) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	followee, err := getUserByNameWithTx(s.db.WithContext(ctx), username)
+	if err != nil {
+		return err
+	}
+	if followee.ID == followerID {
+		return ErrFollowSelf
+	}
+
+	err = s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.Follow{FollowerID: followerID, FolloweeID: followee.ID}).Error
+	if err != nil {
+		log.Println("error following user", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// UnfollowUser stops the follower following the user with the given username, if they do.
+func (s *followService) UnfollowUser(followerID uint, username string) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	followee, err := getUserByNameWithTx(s.db.WithContext(ctx), username)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).
+		Delete(&domain.Follow{}, "follower_id = ? AND followee_id = ?", followerID, followee.ID).Error
+	if err != nil {
+		log.Println("error unfollowing user", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// GetFollowers returns a page of the users following the given user, most recent first.
+func (s *followService) GetFollowers(username string, page, limit int) ([]domain.Follow, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	user, err := getUserByNameWithTx(s.db.WithContext(ctx), username)
+	if err != nil {
+		return nil, err
+	}
+
+	var follows []domain.Follow
+	err = s.db.WithContext(ctx).
+		Scopes(db.Paginate(page, limit)).
+		Preload("Follower").
+		Where("followee_id = ?", user.ID).
+		Order("created_at DESC").
+		Find(&follows).Error
+	if err != nil {
+		log.Println("error getting followers", err)
+		return nil, ErrUnknown
+	}
+	return follows, nil
+}
+
+// GetFollowing returns a page of the users the given user follows, most recent first.
+func (s *followService) GetFollowing(username string, page, limit int) ([]domain.Follow, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	user, err := getUserByNameWithTx(s.db.WithContext(ctx), username)
+	if err != nil {
+		return nil, err
+	}
+
+	var follows []domain.Follow
+	err = s.db.WithContext(ctx).
+		Scopes(db.Paginate(page, limit)).
+		Preload("Followee").
+		Where("follower_id = ?", user.ID).
+		Order("created_at DESC").
+		Find(&follows).Error
+	if err != nil {
+		log.Println("error getting followed users", err)
+		return nil, ErrUnknown
+	}
+	return follows, nil
+}
+
+// feedQuery selects the activity of the users someone follows, newest first: the
+// public recipes and forks they have published and their reviews of public recipes.
+const feedQuery = `
+SELECT kind, id, user_id, at FROM (
+	SELECT
+		CASE WHEN recipes.forked_from_id IS NULL THEN @recipe ELSE @fork END AS kind,
+		recipes.id, recipes.user_id, recipes.published_at AS at
+	FROM recipes
+	JOIN follows ON follows.followee_id = recipes.user_id
+	WHERE follows.follower_id = @user
+		AND recipes.visibility = @public AND recipes.status = @published
+		AND recipes.published_at IS NOT NULL AND recipes.deleted_at IS NULL
+	UNION ALL
+	SELECT @review AS kind, reviews.id, reviews.user_id, reviews.created_at AS at
+	FROM reviews
+	JOIN follows ON follows.followee_id = reviews.user_id
+	JOIN recipes ON recipes.id = reviews.recipe_id
+	WHERE follows.follower_id = @user
+		AND recipes.visibility = @public AND recipes.status = @published
+		AND recipes.deleted_at IS NULL
+) feed
+ORDER BY at DESC, kind, id DESC
+LIMIT @limit OFFSET @offset`
+
+// GetFeed returns a page of activity from the users the user follows, newest first.
+func (s *followService) GetFeed(userID uint, page, limit int) ([]domain.FeedItem, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+	page, limit = db.PageBounds(page, limit)
+
+	var rows []struct {
+		Kind   string
+		ID     uint
+		UserID uint
+		At     time.Time
+	}
+	err := tx.Raw(feedQuery, map[string]any{
+		"user":      userID,
+		"recipe":    domain.FeedItemRecipe,
+		"fork":      domain.FeedItemFork,
+		"review":    domain.FeedItemReview,
+		"public":    domain.VisibilityPublic,
+		"published": domain.RecipeStatusPublished,
+		"limit":     limit,
+		"offset":    (page - 1) * limit,
+	}).Scan(&rows).Error
+	if err != nil {
+		log.Println("error getting feed", err)
+		return nil, ErrUnknown
+	}
+
+	var recipeIDs, reviewIDs, userIDs []uint
+	for _, row := range rows {
+		if row.Kind == domain.FeedItemReview {
+			reviewIDs = append(reviewIDs, row.ID)
+		} else {
+			recipeIDs = append(recipeIDs, row.ID)
+		}
+		userIDs = append(userIDs, row.UserID)
+	}
+
+	reviews := make(map[uint]*domain.Review, len(reviewIDs))
+	if len(reviewIDs) > 0 {
+		var found []domain.Review
+		if err = tx.Where("id IN ?", reviewIDs).Find(&found).Error; err != nil {
+			log.Println("error getting feed reviews", err)
+			return nil, ErrUnknown
+		}
+		for i := range found {
+			reviews[found[i].ID] = &found[i]
+			recipeIDs = append(recipeIDs, found[i].RecipeID)
+		}
+	}
+
+	recipes := make(map[uint]*domain.Recipe, len(recipeIDs))
+	if len(recipeIDs) > 0 {
+		var found []domain.Recipe
+		err = tx.
+			Preload("Ingredients").
+			Preload("Instructions", func(tx *gorm.DB) *gorm.DB {
+				return tx.Order("instructions.step ASC")
+			}).
+			Preload("Tags").
+			Preload("ForkedFrom").
+			Where("id IN ?", recipeIDs).
+			Find(&found).Error
+		if err != nil {
+			log.Println("error getting feed recipes", err)
+			return nil, ErrUnknown
+		}
+		for i := range found {
+			recipes[found[i].ID] = &found[i]
+		}
+	}
+
+	usernames := make(map[uint]string, len(userIDs))
+	if len(userIDs) > 0 {
+		var users []domain.User
+		if err = tx.Select("id", "username").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			log.Println("error getting feed users", err)
+			return nil, ErrUnknown
+		}
+		for _, user := range users {
+			usernames[user.ID] = user.Username
+		}
+	}
+
+	items := make([]domain.FeedItem, 0, len(rows))
+	for _, row := range rows {
+		item := domain.FeedItem{
+			Type:      row.Kind,
+			CreatedAt: row.At,
+			UserID:    row.UserID,
+			Username:  usernames[row.UserID],
+		}
+		if row.Kind == domain.FeedItemReview {
+			item.Review = reviews[row.ID]
+			if item.Review == nil {
+				continue
+			}
+			item.Recipe = recipes[item.Review.RecipeID]
+		} else {
+			item.Recipe = recipes[row.ID]
+		}
+		if item.Recipe == nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func getUserByNameWithTx(tx *gorm.DB, username string) (*domain.User, error) {
+	var user domain.User
+	err := tx.Where("username = ?", username).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		log.Println("error getting user", err)
+		return nil, ErrUnknown
+	}
+	return &user, nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"log"
+)
+
+// ForkRecipe copies a recipe, with its ingredients, instructions and tags, into
+// the user's account. The copy links back to the original through ForkedFromID
+// and keeps its visibility, so forking never makes a recipe more visible.
+// Like any new recipe, the fork starts out as a draft.
+func (r *recipeService) ForkRecipe(userID, recipeID uint) (*domain.Recipe, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+	ch := make(chan recipeVal)
+
+	go func() {
+		defer cancel()
+		tx := r.db.Begin()
+		defer recoverTx(tx)
+
+		original, err := getVisibleRecipeWithTx(r.ctx, tx, userID, recipeID, "")
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{nil, err}
+			return
+		}
+
+		fork := &domain.Recipe{
+			Name:         original.Name,
+			Description:  original.Description,
+			CookTime:     original.CookTime,
+			Servings:     original.Servings,
+			UserID:       userID,
+			Visibility:   original.Visibility,
+			Status:       domain.RecipeStatusDraft,
+			ForkedFromID: &original.ID,
+		}
+		err = tx.Create(fork).Error
+		if err != nil {
+			log.Println("error creating fork", err)
+			tx.Rollback()
+			ch <- recipeVal{nil, ErrUnknown}
+			return
+		}
+
+		ingredients := make([]domain.Ingredient, len(original.Ingredients))
+		for i, ingredient := range original.Ingredients {
+			ingredients[i] = domain.Ingredient{
+				Name:          ingredient.Name,
+				Quantity:      ingredient.Quantity,
+				Unit:          ingredient.Unit,
+				Amount:        ingredient.Amount,
+				AmountMax:     ingredient.AmountMax,
+				CanonicalUnit: ingredient.CanonicalUnit,
+				RecipeID:      fork.ID,
+			}
+		}
+		if len(ingredients) > 0 {
+			err = tx.Create(&ingredients).Error
+		}
+		if err != nil {
+			log.Println("error copying ingredients", err)
+			tx.Rollback()
+			ch <- recipeVal{nil, ErrUnknown}
+			return
+		}
+
+		instructions := make([]domain.Instruction, len(original.Instructions))
+		for i, instruction := range original.Instructions {
+			instructions[i] = domain.Instruction{
+				Step:     instruction.Step,
+				Contents: instruction.Contents,
+				RecipeID: fork.ID,
+			}
+		}
+		if len(instructions) > 0 {
+			err = tx.Create(&instructions).Error
+		}
+		if err != nil {
+			log.Println("error copying instructions", err)
+			tx.Rollback()
+			ch <- recipeVal{nil, ErrUnknown}
+			return
+		}
+
+		if len(original.Tags) > 0 {
+			err = tx.Model(fork).Association("Tags").Append(original.Tags)
+			if err != nil {
+				log.Println("error copying tags", err)
+				tx.Rollback()
+				ch <- recipeVal{nil, ErrUnknown}
+				return
+			}
+		}
+
+		err = recipeChangedWithTx(r.ctx, tx, fork.ID, userID, domain.VersionChangeForkRecipe)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{nil, err}
+			return
+		}
+
+		created, err := getRecipeByIdWithTx(r.ctx, tx, fork.ID)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{nil, err}
+			return
+		}
+
+		err = tx.Commit().Error
+		if err != nil {
+			log.Println("error committing transaction", err)
+			ch <- recipeVal{nil, ErrCommit}
+			return
+		}
+		ch <- recipeVal{created, nil}
+	}()
+
+	select {
+	case v := <-ch:
+		return v.recipe, v.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, ErrTimeoutNoMessage
+	}
+}
+
+// GetRecipeForks returns the direct forks of a recipe, newest first.
+// Only the recipe's owner can list its forks.
+func (r *recipeService) GetRecipeForks(userID, recipeID uint, page, limit int) ([]domain.Recipe, int64, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	recipe, err := getRecipeByIdWithTx(ctx, r.db, recipeID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = doesUserOwnRecipe(userID, recipe.UserID); err != nil {
+		return nil, 0, err
+	}
+
+	return r.GetRecipes(RecipeFilter{
+		ViewerID:     userID,
+		ForkedFromID: recipeID,
+		Sort:         RecipeSortCreatedAt,
+		Desc:         true,
+		Page:         page,
+		Limit:        limit,
+	})
+}
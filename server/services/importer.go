@@ -0,0 +1,536 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jacksonopp/go-recipe/domain"
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MAX_IMPORT_SIZE is the largest page the importer will read.
+	MAX_IMPORT_SIZE = 5 << 20
+	IMPORT_TIMEOUT  = 10 * time.Second
+)
+
+type ImportService interface {
+	PreviewHTML(page []byte) (*domain.Recipe, error)
+	PreviewURL(pageUrl string) (*domain.Recipe, error)
+	Import(userID uint, recipe *domain.Recipe) (*domain.Recipe, error)
+}
+
+type importService struct {
+	db            *gorm.DB
+	ctx           context.Context
+	client        *http.Client
+	recipeService RecipeService
+}
+
+func NewImportService(db *gorm.DB) ImportService {
+	ctx := context.Background()
+	return &importService{
+		db:            db,
+		ctx:           ctx,
+		client:        newImportClient(),
+		recipeService: NewRecipeService(db),
+	}
+}
+
+// newImportClient returns an http client that refuses to connect to loopback,
+// private and link-local addresses, so imports cannot be used to probe our own network.
+func newImportClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: IMPORT_TIMEOUT,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+				return fmt.Errorf("refusing to connect to %s", host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: IMPORT_TIMEOUT, Transport: transport}
+}
+
+// PreviewHTML extracts a schema.org Recipe from an HTML page without saving it.
+func (s *importService) PreviewHTML(page []byte) (*domain.Recipe, error) {
+	return parseRecipePage(page)
+}
+
+// PreviewURL fetches a page and extracts a schema.org Recipe from it without saving it.
+func (s *importService) PreviewURL(pageUrl string) (*domain.Recipe, error) {
+	u, err := url.Parse(pageUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidImportUrl
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, IMPORT_TIMEOUT)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidImportUrl
+	}
+	req.Header.Set("Accept", "text/html")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		log.Println("error fetching import url", err)
+		return nil, ErrImportFetch
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		log.Printf("error fetching import url: status %d", res.StatusCode)
+		return nil, ErrImportFetch
+	}
+
+	page, err := io.ReadAll(io.LimitReader(res.Body, MAX_IMPORT_SIZE))
+	if err != nil {
+		log.Println("error reading import url", err)
+		return nil, ErrImportFetch
+	}
+
+	return parseRecipePage(page)
+}
+
+// Import saves a previewed recipe to the user's account, creating any of its tags that do not exist yet.
+// The recipe and its tags are saved together, so a failed import leaves nothing behind.
+func (s *importService) Import(userID uint, recipe *domain.Recipe) (*domain.Recipe, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	created, err := importRecipeWithTx(ctx, tx, userID, recipe)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return nil, ErrCommit
+	}
+
+	return s.recipeService.GetRecipeById(created.ID)
+}
+
+// importRecipeWithTx saves a copy of recipe, with its ingredients, instructions
+// and tags, as a new draft of the user's.
+func importRecipeWithTx(ctx context.Context, tx *gorm.DB, userID uint, recipe *domain.Recipe) (*domain.Recipe, error) {
+	ingredients := make([]domain.IngredientDto, len(recipe.Ingredients))
+	for i, ingredient := range recipe.Ingredients {
+		ingredients[i] = domain.IngredientDto{
+			Name:     ingredient.Name,
+			Quantity: ingredient.Quantity,
+			Unit:     ingredient.Unit,
+		}
+	}
+
+	instructions := make([]domain.InstructionDto, len(recipe.Instructions))
+	for i, instruction := range recipe.Instructions {
+		instructions[i] = domain.InstructionDto{
+			Step:     instruction.Step,
+			Contents: instruction.Contents,
+		}
+	}
+
+	created, err := createRecipeWithTx(tx, userID, recipe.Name, recipe.Description, recipe.CookTime, recipe.Servings, ingredients, instructions)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var tags []*domain.Tag
+	for _, t := range recipe.Tags {
+		if seen[t.Tag] {
+			continue
+		}
+		seen[t.Tag] = true
+
+		tag, err := findOrCreateTagWithTx(tx, t.Tag)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > 0 {
+		if err = tx.Model(created).Association("Tags").Append(tags); err != nil {
+			log.Println("error adding tags to imported recipe", err)
+			return nil, ErrUnknown
+		}
+	}
+
+	if err = recipeChangedWithTx(ctx, tx, created.ID, userID, domain.VersionChangeCreateRecipe); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// parseRecipePage finds the first schema.org Recipe in an HTML page, looking at
+// JSON-LD first and falling back to microdata.
+func parseRecipePage(page []byte) (*domain.Recipe, error) {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, ErrNoRecipeInPage
+	}
+
+	if node := findJSONLDRecipe(doc); node != nil {
+		return schemaRecipeToDomain(node)
+	}
+	if node := findMicrodataRecipe(doc); node != nil {
+		return schemaRecipeToDomain(node)
+	}
+	return nil, ErrNoRecipeInPage
+}
+
+// findJSONLDRecipe returns the first Recipe object in the page's JSON-LD scripts.
+func findJSONLDRecipe(doc *html.Node) map[string]any {
+	var found map[string]any
+	walkHTML(doc, func(n *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if n.Type != html.ElementNode || n.Data != "script" || !strings.EqualFold(htmlAttr(n, "type"), "application/ld+json") {
+			return true
+		}
+
+		var data any
+		if err := json.Unmarshal([]byte(htmlText(n)), &data); err != nil {
+			log.Println("skipping invalid json-ld", err)
+			return false
+		}
+		found = findSchemaRecipe(data)
+		return false
+	})
+	return found
+}
+
+// findSchemaRecipe searches decoded JSON-LD, including @graph lists, for a Recipe object.
+func findSchemaRecipe(data any) map[string]any {
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			if recipe := findSchemaRecipe(item); recipe != nil {
+				return recipe
+			}
+		}
+	case map[string]any:
+		if isSchemaType(v["@type"], "Recipe") {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findSchemaRecipe(graph)
+		}
+	}
+	return nil
+}
+
+func isSchemaType(t any, name string) bool {
+	for _, s := range schemaStrings(t) {
+		if s == name || strings.HasSuffix(s, "/"+name) || strings.HasSuffix(s, ":"+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// findMicrodataRecipe converts the first element with itemtype schema.org/Recipe to the same shape as JSON-LD.
+func findMicrodataRecipe(doc *html.Node) map[string]any {
+	var found map[string]any
+	walkHTML(doc, func(n *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if n.Type == html.ElementNode && hasAttr(n, "itemscope") && isSchemaType(htmlAttr(n, "itemtype"), "Recipe") {
+			found = microdataItem(n)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// microdataItem collects the itemprops of an itemscope element. Repeated properties become lists
+// and nested itemscopes become nested objects.
+func microdataItem(scope *html.Node) map[string]any {
+	item := map[string]any{"@type": htmlAttr(scope, "itemtype")}
+
+	add := func(name string, value any) {
+		switch existing := item[name].(type) {
+		case nil:
+			item[name] = value
+		case []any:
+			item[name] = append(existing, value)
+		default:
+			item[name] = []any{existing, value}
+		}
+	}
+
+	for c := scope.FirstChild; c != nil; c = c.NextSibling {
+		walkHTML(c, func(n *html.Node) bool {
+			if n.Type != html.ElementNode {
+				return true
+			}
+
+			props := strings.Fields(htmlAttr(n, "itemprop"))
+			if hasAttr(n, "itemscope") {
+				if len(props) > 0 {
+					nested := microdataItem(n)
+					for _, prop := range props {
+						add(prop, nested)
+					}
+				}
+				// properties inside a nested item belong to that item
+				return false
+			}
+
+			for _, prop := range props {
+				add(prop, microdataValue(n))
+			}
+			return true
+		})
+	}
+
+	return item
+}
+
+func microdataValue(n *html.Node) string {
+	switch n.Data {
+	case "meta":
+		return htmlAttr(n, "content")
+	case "time":
+		if datetime := htmlAttr(n, "datetime"); datetime != "" {
+			return datetime
+		}
+	case "a", "link":
+		return htmlAttr(n, "href")
+	case "img":
+		return htmlAttr(n, "src")
+	}
+	if content := htmlAttr(n, "content"); content != "" {
+		return content
+	}
+	return htmlText(n)
+}
+
+// schemaRecipeToDomain maps a schema.org Recipe onto a domain.Recipe.
+func schemaRecipeToDomain(node map[string]any) (*domain.Recipe, error) {
+	recipe := &domain.Recipe{
+		Name:        cleanText(firstSchemaString(node["name"])),
+		Description: cleanText(firstSchemaString(node["description"])),
+		Servings:    parseYield(node["recipeYield"]),
+		CookTime:    formatDuration(firstSchemaString(node["cookTime"])),
+	}
+	if recipe.CookTime == "" {
+		recipe.CookTime = formatDuration(firstSchemaString(node["totalTime"]))
+	}
+	if recipe.Name == "" {
+		return nil, ErrNoRecipeInPage
+	}
+
+	lines := node["recipeIngredient"]
+	if lines == nil {
+		// the recipeIngredient property replaced ingredients
+		lines = node["ingredients"]
+	}
+	for _, line := range schemaStrings(lines) {
+		line = cleanText(line)
+		if line == "" {
+			continue
+		}
+		recipe.Ingredients = append(recipe.Ingredients, domain.ParseIngredientLine(line))
+	}
+
+	for i, contents := range schemaInstructions(node["recipeInstructions"]) {
+		recipe.Instructions = append(recipe.Instructions, domain.Instruction{
+			Step:     i + 1,
+			Contents: contents,
+		})
+	}
+
+	seen := map[string]bool{}
+	for _, keywords := range schemaStrings(node["keywords"]) {
+		for _, keyword := range strings.Split(keywords, ",") {
+			tag := strings.ToLower(cleanText(keyword))
+			if tag == "" || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			recipe.Tags = append(recipe.Tags, &domain.Tag{Tag: tag})
+		}
+	}
+
+	return recipe, nil
+}
+
+// schemaInstructions flattens recipeInstructions, which may be a block of text,
+// a list of strings, HowToSteps or HowToSections of HowToSteps.
+func schemaInstructions(v any) []string {
+	var steps []string
+	switch v := v.(type) {
+	case string:
+		for _, line := range strings.Split(v, "\n") {
+			if line = cleanText(line); line != "" {
+				steps = append(steps, line)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			steps = append(steps, schemaInstructions(item)...)
+		}
+	case map[string]any:
+		if isSchemaType(v["@type"], "HowToSection") || v["itemListElement"] != nil {
+			return schemaInstructions(v["itemListElement"])
+		}
+		text := firstSchemaString(v["text"])
+		if text == "" {
+			text = firstSchemaString(v["name"])
+		}
+		if text = cleanText(text); text != "" {
+			steps = append(steps, text)
+		}
+	}
+	return steps
+}
+
+// schemaStrings returns the string values of a property that may be a single value or a list.
+func schemaStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []any:
+		var strs []string
+		for _, item := range v {
+			strs = append(strs, schemaStrings(item)...)
+		}
+		return strs
+	case map[string]any:
+		// e.g. {"@type": "Text", "@value": "..."}
+		return schemaStrings(v["@value"])
+	}
+	return nil
+}
+
+func firstSchemaString(v any) string {
+	if strs := schemaStrings(v); len(strs) > 0 {
+		return strs[0]
+	}
+	return ""
+}
+
+var firstNumber = regexp.MustCompile(`\d+`)
+
+// parseYield returns the number of servings from a yield such as 4, "4" or "Serves 4-6".
+func parseYield(v any) int {
+	for _, yield := range schemaStrings(v) {
+		if n, err := strconv.Atoi(firstNumber.FindString(yield)); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// formatDuration renders an ISO 8601 duration such as "PT1H30M" as "1 hour 30 minutes".
+// Anything that is not an ISO 8601 duration is returned as is.
+func formatDuration(d string) string {
+	d = strings.TrimSpace(d)
+	m := isoDuration.FindStringSubmatch(strings.ToUpper(d))
+	if m == nil {
+		return d
+	}
+
+	days, _ := strconv.Atoi(m[1])
+	hours, _ := strconv.Atoi(m[2])
+	minutes, _ := strconv.Atoi(m[3])
+	hours += days * 24
+
+	var parts []string
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	if hours > 0 {
+		parts = append(parts, plural(hours, "hour"))
+	}
+	if minutes > 0 {
+		parts = append(parts, plural(minutes, "minute"))
+	}
+	return strings.Join(parts, " ")
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// cleanText strips markup and entities that some sites leave in their structured data, and collapses whitespace.
+func cleanText(s string) string {
+	s = html.UnescapeString(htmlTag.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// walkHTML calls fn for n and its descendants in document order. Returning false skips the node's children.
+func walkHTML(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkHTML(c, fn)
+	}
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func htmlText(n *html.Node) string {
+	var text strings.Builder
+	walkHTML(n, func(n *html.Node) bool {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+		return true
+	})
+	return text.String()
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jacksonopp/go-recipe/domain"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseRecipePage(t *testing.T) {
+	type ingredient struct {
+		quantity string
+		unit     string
+		name     string
+	}
+
+	tests := []struct {
+		fixture      string
+		name         string
+		description  string
+		servings     int
+		cookTime     string
+		ingredients  []ingredient
+		instructions []string
+		tags         []string
+	}{
+		{
+			fixture:     "testdata/jsonld_recipe.html",
+			name:        "Chickpea Curry",
+			description: "A quick & cozy weeknight curry.",
+			servings:    4,
+			cookTime:    "1 hour 15 minutes",
+			ingredients: []ingredient{
+				{"2", "tbsp", "olive oil"},
+				{"1 1/2", "cups", "diced onion"},
+				{"2-3", "cloves", "garlic, minced"},
+				{"1", "", "(14 oz) can chickpeas"},
+				{"", "", "salt to taste"},
+			},
+			instructions: []string{
+				"Dice the onion.",
+				"Fry the onion in the oil.",
+				"Add the chickpeas and simmer for 20 minutes.",
+			},
+			tags: []string{"curry", "vegan", "weeknight"},
+		},
+		{
+			fixture:     "testdata/microdata_recipe.html",
+			name:        "Buttermilk Pancakes",
+			description: "Fluffy pancakes for a lazy Sunday.",
+			servings:    6,
+			cookTime:    "20 minutes",
+			ingredients: []ingredient{
+				{"2", "cups", "flour"},
+				{"2", "tablespoons", "sugar"},
+				{"2", "cups", "buttermilk"},
+			},
+			instructions: []string{
+				"Whisk the dry ingredients.",
+				"Stir in the buttermilk and fry.",
+			},
+			tags: []string{"breakfast", "pancakes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			page, err := os.ReadFile(tt.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recipe, err := parseRecipePage(page)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if recipe.Name != tt.name {
+				t.Errorf("expected name %q, got %q", tt.name, recipe.Name)
+			}
+			if recipe.Description != tt.description {
+				t.Errorf("expected description %q, got %q", tt.description, recipe.Description)
+			}
+			if recipe.Servings != tt.servings {
+				t.Errorf("expected %d servings, got %d", tt.servings, recipe.Servings)
+			}
+			if recipe.CookTime != tt.cookTime {
+				t.Errorf("expected cook time %q, got %q", tt.cookTime, recipe.CookTime)
+			}
+
+			ingredients := make([]ingredient, len(recipe.Ingredients))
+			for i, ing := range recipe.Ingredients {
+				ingredients[i] = ingredient{ing.Quantity, ing.Unit, ing.Name}
+			}
+			if !reflect.DeepEqual(ingredients, tt.ingredients) {
+				t.Errorf("expected ingredients %q, got %q", tt.ingredients, ingredients)
+			}
+
+			instructions := make([]string, len(recipe.Instructions))
+			for i, instruction := range recipe.Instructions {
+				if instruction.Step != i+1 {
+					t.Errorf("expected step %d, got %d", i+1, instruction.Step)
+				}
+				instructions[i] = instruction.Contents
+			}
+			if !reflect.DeepEqual(instructions, tt.instructions) {
+				t.Errorf("expected instructions %q, got %q", tt.instructions, instructions)
+			}
+
+			tags := make([]string, len(recipe.Tags))
+			for i, tag := range recipe.Tags {
+				tags[i] = tag.Tag
+			}
+			if !reflect.DeepEqual(tags, tt.tags) {
+				t.Errorf("expected tags %q, got %q", tt.tags, tags)
+			}
+		})
+	}
+}
+
+func TestParseRecipePage_noRecipe(t *testing.T) {
+	page := []byte(`<html><head><script type="application/ld+json">{"@type": "WebSite"}</script></head></html>`)
+	if _, err := parseRecipePage(page); !errors.Is(err, ErrNoRecipeInPage) {
+		t.Errorf("expected ErrNoRecipeInPage, got %v", err)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[string]string{
+		"PT30M":     "30 minutes",
+		"PT1H":      "1 hour",
+		"PT2H5M":    "2 hours 5 minutes",
+		"P1DT1H":    "25 hours",
+		"45 mins":   "45 mins",
+		"PT0H30M0S": "30 minutes",
+	}
+
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			if got := formatDuration(input); got != expected {
+				t.Errorf("expected %q, got %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestImportService_Import_rollsBackOnTagFailure(t *testing.T) {
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewImportService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "recipes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`SELECT \* FROM "tags"`).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	recipe := &domain.Recipe{Name: "Chickpea Curry", Tags: []*domain.Tag{{Tag: "vegan"}}}
+	if _, err = s.Import(1, recipe); !errors.Is(err, ErrUnknown) {
+		t.Errorf("expected ErrUnknown, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
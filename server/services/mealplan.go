@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+	"sort"
+	"time"
+)
+
+// MAX_MEAL_PLAN_DAYS is the longest range of days a meal plan can be read for at once.
+const MAX_MEAL_PLAN_DAYS = 62
+
+// MealPlanEntryUpdate holds the changes to a meal plan entry. Nil fields are left
+// unchanged, and a Servings of 0 goes back to the recipe's own servings.
+type MealPlanEntryUpdate struct {
+	Date     *time.Time
+	Slot     *string
+	Servings *int
+}
+
+type MealPlanService interface {
+	CreateEntry(userID uint, date time.Time, slot string, recipeID uint, servings *int) (*domain.MealPlanEntry, error)
+	GetEntry(userID, entryID uint) (*domain.MealPlanEntry, error)
+	GetEntries(userID uint, from, to time.Time) ([]domain.MealPlanEntry, error)
+	UpdateEntry(userID, entryID uint, update MealPlanEntryUpdate) (*domain.MealPlanEntry, error)
+	DeleteEntry(userID, entryID uint) error
+
+	CopyWeek(userID uint, from, to time.Time) ([]domain.MealPlanEntry, error)
+}
+
+type mealPlanService struct {
+	db  *gorm.DB
+	ctx context.Context
+}
+
+func NewMealPlanService(db *gorm.DB) MealPlanService {
+	ctx := context.Background()
+	return &mealPlanService{db: db, ctx: ctx}
+}
+
+// CreateEntry plans a recipe the user can see for a meal on a date.
+func (s *mealPlanService) CreateEntry(userID uint, date time.Time, slot string, recipeID uint, servings *int) (*domain.MealPlanEntry, error) {
+	if !domain.IsValidMealSlot(slot) {
+		return nil, ErrInvalidMealSlot
+	}
+	if servings != nil && *servings <= 0 {
+		return nil, ErrInvalidServings
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	if _, err := getVisibleRecipeWithTx(ctx, tx, userID, recipeID, ""); err != nil {
+		return nil, err
+	}
+
+	entry := &domain.MealPlanEntry{
+		UserID:   userID,
+		Date:     toDate(date),
+		Slot:     slot,
+		RecipeID: recipeID,
+		Servings: servings,
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		log.Println("error creating meal plan entry", err)
+		return nil, ErrUnknown
+	}
+	return getMealPlanEntryWithTx(tx, userID, entry.ID)
+}
+
+// GetEntry returns one of the user's meal plan entries with its recipe. An entry
+// whose recipe has since been deleted or hidden from the user is not returned.
+func (s *mealPlanService) GetEntry(userID, entryID uint) (*domain.MealPlanEntry, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	return getMealPlanEntryWithTx(s.db.WithContext(ctx), userID, entryID)
+}
+
+// GetEntries returns the user's meal plan from one date to another, inclusive,
+// ordered by date and meal. Entries whose recipe has since been deleted or hidden
+// from the user are left out.
+func (s *mealPlanService) GetEntries(userID uint, from, to time.Time) ([]domain.MealPlanEntry, error) {
+	from, to = toDate(from), toDate(to)
+	if to.Before(from) || to.Sub(from) >= MAX_MEAL_PLAN_DAYS*24*time.Hour {
+		return nil, ErrInvalidDateRange
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var entries []domain.MealPlanEntry
+	err := mealPlanEntries(s.db.WithContext(ctx)).
+		Where("user_id = ? AND date BETWEEN ? AND ?", userID, from, to).
+		Find(&entries).Error
+	if err != nil {
+		log.Println("error getting meal plan", err)
+		return nil, ErrUnknown
+	}
+
+	visible := visibleMealPlanEntries(entries, userID)
+	sort.SliceStable(visible, func(i, j int) bool {
+		return visible[i].Before(&visible[j])
+	})
+	return visible, nil
+}
+
+// UpdateEntry moves a meal plan entry to another date or meal, or changes its servings.
+// Entries whose recipe has since been deleted or hidden from the user can only be deleted.
+func (s *mealPlanService) UpdateEntry(userID, entryID uint, update MealPlanEntryUpdate) (*domain.MealPlanEntry, error) {
+	if update.Slot != nil && !domain.IsValidMealSlot(*update.Slot) {
+		return nil, ErrInvalidMealSlot
+	}
+	if update.Servings != nil && *update.Servings < 0 {
+		return nil, ErrInvalidServings
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	entry, err := getMealPlanEntryWithTx(tx, userID, entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Date != nil {
+		entry.Date = toDate(*update.Date)
+	}
+	if update.Slot != nil {
+		entry.Slot = *update.Slot
+	}
+	if update.Servings != nil {
+		entry.Servings = update.Servings
+		if *update.Servings == 0 {
+			entry.Servings = nil
+		}
+	}
+
+	err = tx.Model(&domain.MealPlanEntry{}).Where("id = ?", entry.ID).Updates(map[string]any{
+		"date":     entry.Date,
+		"slot":     entry.Slot,
+		"servings": entry.Servings,
+	}).Error
+	if err != nil {
+		log.Println("error updating meal plan entry", err)
+		return nil, ErrUnknown
+	}
+	return entry, nil
+}
+
+// DeleteEntry removes a recipe from the user's meal plan.
+func (s *mealPlanService) DeleteEntry(userID, entryID uint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	res := s.db.WithContext(ctx).Delete(&domain.MealPlanEntry{}, "id = ? AND user_id = ?", entryID, userID)
+	if res.Error != nil {
+		log.Println("error deleting meal plan entry", res.Error)
+		return ErrUnknown
+	}
+	if res.RowsAffected == 0 {
+		return ErrMealPlanEntryNotFound
+	}
+	return nil
+}
+
+// CopyWeek copies the seven days of the user's meal plan starting at from to the
+// seven days starting at to, and returns the new entries. Entries that are already
+// planned in the target week, or whose recipe is no longer visible to the user,
+// are not copied.
+func (s *mealPlanService) CopyWeek(userID uint, from, to time.Time) ([]domain.MealPlanEntry, error) {
+	from, to = toDate(from), toDate(to)
+	if from.Equal(to) {
+		return nil, ErrInvalidDateRange
+	}
+	offset := to.Sub(from)
+	week := 6 * 24 * time.Hour
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	var source, existing []domain.MealPlanEntry
+	err := tx.Preload("Recipe").Where("user_id = ? AND date BETWEEN ? AND ?", userID, from, from.Add(week)).Find(&source).Error
+	if err == nil {
+		err = tx.Where("user_id = ? AND date BETWEEN ? AND ?", userID, to, to.Add(week)).Find(&existing).Error
+	}
+	if err != nil {
+		log.Println("error getting meal plan week", err)
+		tx.Rollback()
+		return nil, ErrUnknown
+	}
+
+	type planned struct {
+		date     time.Time
+		slot     string
+		recipeID uint
+	}
+	seen := make(map[planned]bool, len(existing))
+	for _, entry := range existing {
+		seen[planned{entry.Date.UTC(), entry.Slot, entry.RecipeID}] = true
+	}
+
+	source = visibleMealPlanEntries(source, userID)
+	ids := make([]uint, 0, len(source))
+	for _, entry := range source {
+		date := toDate(entry.Date.Add(offset))
+		if seen[planned{date, entry.Slot, entry.RecipeID}] {
+			continue
+		}
+
+		copied := domain.MealPlanEntry{
+			UserID:   userID,
+			Date:     date,
+			Slot:     entry.Slot,
+			RecipeID: entry.RecipeID,
+			Servings: entry.Servings,
+		}
+		if err = tx.Create(&copied).Error; err != nil {
+			log.Println("error copying meal plan entry", err)
+			tx.Rollback()
+			return nil, ErrUnknown
+		}
+		ids = append(ids, copied.ID)
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return nil, ErrCommit
+	}
+
+	if len(ids) == 0 {
+		return []domain.MealPlanEntry{}, nil
+	}
+
+	var entries []domain.MealPlanEntry
+	if err = mealPlanEntries(s.db.WithContext(ctx)).Where("id IN ?", ids).Find(&entries).Error; err != nil {
+		log.Println("error getting copied meal plan entries", err)
+		return nil, ErrUnknown
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Before(&entries[j])
+	})
+	return entries, nil
+}
+
+// mealPlanEntries preloads the recipes of meal plan entries.
+func mealPlanEntries(tx *gorm.DB) *gorm.DB {
+	return tx.
+		Preload("Recipe").
+		Preload("Recipe.Ingredients").
+		Preload("Recipe.Instructions", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("instructions.step ASC")
+		}).
+		Preload("Recipe.Tags")
+}
+
+// visibleMealPlanEntries leaves out the entries whose recipe has been deleted or hidden from the user.
+func visibleMealPlanEntries(entries []domain.MealPlanEntry, userID uint) []domain.MealPlanEntry {
+	visible := make([]domain.MealPlanEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Recipe.ID != 0 && entry.Recipe.VisibleTo(userID) {
+			visible = append(visible, entry)
+		}
+	}
+	return visible
+}
+
+// getMealPlanEntryWithTx returns one of the user's meal plan entries with its
+// recipe, or ErrRecipeNotFound if the recipe has been deleted or hidden from them.
+func getMealPlanEntryWithTx(tx *gorm.DB, userID, entryID uint) (*domain.MealPlanEntry, error) {
+	var entry domain.MealPlanEntry
+	err := mealPlanEntries(tx).Where("user_id = ?", userID).First(&entry, entryID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMealPlanEntryNotFound
+		}
+		log.Println("error getting meal plan entry", err)
+		return nil, ErrUnknown
+	}
+	if entry.Recipe.ID == 0 || !entry.Recipe.VisibleTo(userID) {
+		return nil, ErrRecipeNotFound
+	}
+	return &entry, nil
+}
+
+// toDate drops the time of day from t, leaving midnight UTC on the same calendar day.
+func toDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/platform/authenticator"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// OIDC_LOGIN_TIMEOUT is how long a user has to finish signing in at the provider.
+const OIDC_LOGIN_TIMEOUT = 10 * time.Minute
+
+// MAX_USERNAME_LENGTH is the longest username generated for new OIDC users.
+const MAX_USERNAME_LENGTH = 32
+
+type OIDCService interface {
+	BeginLogin(linkUserID uint, redirectTo string) (string, string, error)
+	CompleteLogin(state, browserState, code string) (*domain.User, string, error)
+}
+
+type oidcService struct {
+	db   *gorm.DB
+	ctx  context.Context
+	auth *authenticator.Authenticator
+}
+
+func NewOIDCService(db *gorm.DB, auth *authenticator.Authenticator) OIDCService {
+	ctx := context.Background()
+	return &oidcService{db: db, ctx: ctx, auth: auth}
+}
+
+// oidcClaims are the ID token claims used to find or create a user.
+type oidcClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Nickname          string `json:"nickname"`
+	Name              string `json:"name"`
+}
+
+// verifiedEmail returns the email address in the claims, or "" unless the
+// provider has verified it. Password reset links can be sent to it, so an
+// address anyone could have typed in at the provider is not kept.
+func (c *oidcClaims) verifiedEmail() string {
+	if !c.EmailVerified {
+		return ""
+	}
+	return c.Email
+}
+
+// BeginLogin starts signing in with the OIDC provider and returns the URL to
+// send the user to, along with the login's state. The state must be kept in the
+// user's browser and handed back to CompleteLogin, so that the login can only
+// be finished by the browser that started it. If linkUserID is set the provider
+// account is linked to that user instead of being used to sign in. Once signed
+// in the user is sent to redirectTo.
+func (s *oidcService) BeginLogin(linkUserID uint, redirectTo string) (string, string, error) {
+	if s.auth == nil {
+		return "", "", ErrOIDCNotConfigured
+	}
+
+	state, err := genRandStr(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := genRandStr(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	login := domain.OIDCLogin{
+		StateHash:  hashToken(state),
+		Nonce:      nonce,
+		Verifier:   verifier,
+		RedirectTo: redirectTo,
+		ExpiresAt:  time.Now().Add(OIDC_LOGIN_TIMEOUT),
+	}
+	if linkUserID != 0 {
+		login.LinkUserID = &linkUserID
+	}
+
+	// logins that were never finished are cleared out as new ones start
+	err = s.db.WithContext(ctx).Delete(&domain.OIDCLogin{}, "expires_at < ?", time.Now()).Error
+	if err != nil {
+		log.Println("error pruning oidc logins", err)
+	}
+
+	if err = s.db.WithContext(ctx).Create(&login).Error; err != nil {
+		log.Println("error creating oidc login", err)
+		return "", "", ErrUnknown
+	}
+
+	return s.auth.LoginURL(state, nonce, verifier), state, nil
+}
+
+// CompleteLogin finishes signing in with the code the provider sent back, and
+// returns the signed in user and the path to send them to. browserState is the
+// state kept in the browser the callback came from; it must match state, or
+// the callback was not made by the browser that started the login. Users
+// signing in for the first time get a new account.
+func (s *oidcService) CompleteLogin(state, browserState, code string) (*domain.User, string, error) {
+	if s.auth == nil {
+		return nil, "", ErrOIDCNotConfigured
+	}
+
+	// checked before the login is looked up, so a forged callback cannot use up
+	// someone else's login either
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return nil, "", ErrOIDCInvalidState
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var login domain.OIDCLogin
+	err := s.db.WithContext(ctx).Where("state_hash = ?", hashToken(state)).First(&login).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrOIDCInvalidState
+		}
+		log.Println("error getting oidc login", err)
+		return nil, "", ErrUnknown
+	}
+
+	// logins can only be completed once, so the state is used up whatever happens next
+	res := s.db.WithContext(ctx).Delete(&domain.OIDCLogin{}, login.ID)
+	if res.Error != nil {
+		log.Println("error deleting oidc login", res.Error)
+		return nil, "", ErrUnknown
+	}
+	if res.RowsAffected == 0 || login.ExpiresAt.Before(time.Now()) {
+		return nil, "", ErrOIDCInvalidState
+	}
+
+	claims, err := s.verifyCallback(ctx, &login, code)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	user, err := s.userForIdentityWithTx(tx, &login, claims)
+	if err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return nil, "", ErrCommit
+	}
+
+	user.Password = ""
+	user.Salt = ""
+	return user, login.RedirectTo, nil
+}
+
+// verifyCallback exchanges the code for an ID token using the login's PKCE
+// verifier and checks that the token was issued for the login's nonce.
+func (s *oidcService) verifyCallback(ctx context.Context, login *domain.OIDCLogin, code string) (*oidcClaims, error) {
+	token, err := s.auth.Exchange(ctx, code, login.Verifier)
+	if err != nil {
+		log.Println("error exchanging oidc code", err)
+		return nil, ErrOIDCExchange
+	}
+
+	idToken, err := s.auth.VerifyIDToken(ctx, token)
+	if err != nil {
+		log.Println("error verifying oidc id token", err)
+		return nil, ErrOIDCInvalidToken
+	}
+	if idToken.Nonce != login.Nonce {
+		return nil, ErrOIDCInvalidToken
+	}
+
+	var claims oidcClaims
+	if err = idToken.Claims(&claims); err != nil {
+		log.Println("error reading oidc claims", err)
+		return nil, ErrOIDCInvalidToken
+	}
+	claims.Subject = idToken.Subject
+	return &claims, nil
+}
+
+// userForIdentityWithTx returns the user linked to the provider account in claims,
+// linking it to the login's user or to a new account if it is not linked yet.
+func (s *oidcService) userForIdentityWithTx(tx *gorm.DB, login *domain.OIDCLogin, claims *oidcClaims) (*domain.User, error) {
+	issuer := s.auth.Issuer()
+
+	var identity domain.UserIdentity
+	err := tx.Preload("User").
+		Where("issuer = ? AND subject = ?", issuer, claims.Subject).
+		First(&identity).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println("error getting user identity", err)
+		return nil, ErrUnknown
+	}
+
+	if err == nil {
+		if login.LinkUserID != nil && *login.LinkUserID != identity.UserID {
+			return nil, ErrOIDCIdentityConflict
+		}
+		if email := claims.verifiedEmail(); email != "" && email != identity.Email {
+			if err = tx.Model(&identity).Update("email", email).Error; err != nil {
+				log.Println("error updating user identity", err)
+				return nil, ErrUnknown
+			}
+		}
+		if identity.User.ID == 0 {
+			return nil, ErrUserNotFound
+		}
+		return &identity.User, nil
+	}
+
+	var user domain.User
+	if login.LinkUserID != nil {
+		if err = tx.First(&user, *login.LinkUserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrUserNotFound
+			}
+			log.Println("error getting user", err)
+			return nil, ErrUnknown
+		}
+	} else {
+		created, err := createOIDCUserWithTx(tx, claims)
+		if err != nil {
+			return nil, err
+		}
+		user = *created
+	}
+
+	identity = domain.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  issuer,
+		Subject: claims.Subject,
+		Email:   claims.verifiedEmail(),
+	}
+	if err = tx.Create(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrOIDCIdentityConflict
+		}
+		log.Println("error creating user identity", err)
+		return nil, ErrUnknown
+	}
+	return &user, nil
+}
+
+// createOIDCUserWithTx creates an account for someone signing in with a provider
+// for the first time. They get a random password, so they can only sign in with
+// the provider until they set one.
+func createOIDCUserWithTx(tx *gorm.DB, claims *oidcClaims) (*domain.User, error) {
+	password, err := genRandStr(32)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := genRandStr(32)
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := hashPassword(password, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	base := usernameFromClaims(claims)
+	for i := 1; i <= 20; i++ {
+		username := base
+		if i > 1 {
+			suffix := fmt.Sprintf("-%d", i)
+			username = base[:min(len(base), MAX_USERNAME_LENGTH-len(suffix))] + suffix
+		}
+
+		var taken int64
+		if err = tx.Model(&domain.User{}).Unscoped().Where("username = ?", username).Count(&taken).Error; err != nil {
+			log.Println("error checking username", err)
+			return nil, ErrUnknown
+		}
+		if taken > 0 {
+			continue
+		}
+
+		user := domain.User{Username: username, Password: hashed, Salt: salt}
+		if err = tx.Create(&user).Error; err != nil {
+			log.Println("error creating oidc user", err)
+			return nil, ErrUnknown
+		}
+		return &user, nil
+	}
+	return nil, ErrUserAlreadyExists
+}
+
+// usernameFromClaims picks a username for a new user from their provider
+// profile: their preferred username, nickname, the start of their email address
+// or their name, reduced to letters, digits, dashes, dots and underscores.
+func usernameFromClaims(claims *oidcClaims) string {
+	email, _, _ := strings.Cut(claims.Email, "@")
+	for _, candidate := range []string{claims.PreferredUsername, claims.Nickname, email, claims.Name} {
+		username := strings.Map(func(r rune) rune {
+			switch {
+			case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)), r == '-', r == '.', r == '_':
+				return unicode.ToLower(r)
+			case unicode.IsSpace(r):
+				return '-'
+			}
+			return -1
+		}, candidate)
+		username = strings.Trim(username, "-._")
+		if len(username) > MAX_USERNAME_LENGTH {
+			username = username[:MAX_USERNAME_LENGTH]
+		}
+		if username != "" {
+			return username
+		}
+	}
+	return "user"
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"github.com/jacksonopp/go-recipe/platform/authenticator"
+	"github.com/jacksonopp/go-recipe/platform/authenticator/authenticatortest"
+	"golang.org/x/oauth2"
+	"testing"
+)
+
+func TestOIDCService_verifyCallback(t *testing.T) {
+	provider := authenticatortest.NewProvider(t)
+	provider.Claims["email"] = "cook@example.com"
+	provider.Claims["preferred_username"] = "Head Cook"
+	ctx := context.Background()
+
+	auth, err := authenticator.New(ctx, provider.Config("http://localhost/api/auth/oidc/callback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &oidcService{ctx: ctx, auth: auth}
+
+	login := func(nonce string) (*domain.OIDCLogin, string) {
+		l := &domain.OIDCLogin{Nonce: nonce, Verifier: oauth2.GenerateVerifier()}
+		code, _, err := provider.Authorize(auth.LoginURL("state", nonce, l.Verifier))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l, code
+	}
+
+	l, code := login("nonce")
+	claims, err := s.verifyCallback(ctx, l, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != provider.Subject || claims.Email != "cook@example.com" {
+		t.Errorf("expected claims for %s, got %+v", provider.Subject, claims)
+	}
+	if got := usernameFromClaims(claims); got != "head-cook" {
+		t.Errorf("expected username head-cook, got %s", got)
+	}
+
+	// a token issued for another login's nonce is rejected
+	l, code = login("other")
+	l.Nonce = "nonce"
+	if _, err = s.verifyCallback(ctx, l, code); !errors.Is(err, ErrOIDCInvalidToken) {
+		t.Errorf("expected ErrOIDCInvalidToken, got %v", err)
+	}
+
+	// codes can only be used once
+	l, code = login("nonce")
+	if _, err = s.verifyCallback(ctx, l, code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.verifyCallback(ctx, l, code); !errors.Is(err, ErrOIDCExchange) {
+		t.Errorf("expected ErrOIDCExchange, got %v", err)
+	}
+}
+
+func TestUsernameFromClaims(t *testing.T) {
+	tests := []struct {
+		claims oidcClaims
+		want   string
+	}{
+		{oidcClaims{PreferredUsername: "jdoe"}, "jdoe"},
+		{oidcClaims{Nickname: "J.Doe!"}, "j.doe"},
+		{oidcClaims{Email: "jane.doe+recipes@example.com"}, "jane.doerecipes"},
+		{oidcClaims{Name: "Jane Doe"}, "jane-doe"},
+		{oidcClaims{Name: "李"}, "user"},
+		{oidcClaims{}, "user"},
+	}
+
+	for _, tt := range tests {
+		if got := usernameFromClaims(&tt.claims); got != tt.want {
+			t.Errorf("%+v: expected %q, got %q", tt.claims, tt.want, got)
+		}
+	}
+}
+
+func TestOIDCClaims_verifiedEmail(t *testing.T) {
+	tests := []struct {
+		claims oidcClaims
+		want   string
+	}{
+		{oidcClaims{Email: "cook@example.com", EmailVerified: true}, "cook@example.com"},
+		{oidcClaims{Email: "cook@example.com"}, ""},
+		{oidcClaims{EmailVerified: true}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := tt.claims.verifiedEmail(); got != tt.want {
+			t.Errorf("%+v: expected %q, got %q", tt.claims, tt.want, got)
+		}
+	}
+}
+
+func TestOIDCService_CompleteLogin_browserState(t *testing.T) {
+	provider := authenticatortest.NewProvider(t)
+	ctx := context.Background()
+
+	auth, err := authenticator.New(ctx, provider.Config("http://localhost/api/auth/oidc/callback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewOIDCService(db, auth)
+
+	tests := map[string]string{
+		"no cookie":      "",
+		"other browser":  "another-login-state",
+		"state prefixed": "state-and-more",
+	}
+	for name, browserState := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := s.CompleteLogin("state", browserState, "code"); !errors.Is(err, ErrOIDCInvalidState) {
+				t.Errorf("expected ErrOIDCInvalidState, got %v", err)
+			}
+		})
+	}
+
+	// the login is not looked up, so it is not used up either
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
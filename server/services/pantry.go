@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/db"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+// MAX_COOKABLE_CANDIDATES is the most recipes that are matched against a pantry
+// to find cookable ones. Candidates are ranked in the database by how many of
+// their ingredients share a name with a pantry item, so the cap only drops the
+// weakest matches.
+const MAX_COOKABLE_CANDIDATES = 500
+
+// PantryItemUpdate holds the changes to a pantry item. Nil fields are left
+// unchanged, and ClearExpiresAt removes the expiry date.
+type PantryItemUpdate struct {
+	Name           *string
+	Quantity       *string
+	Unit           *string
+	ExpiresAt      *time.Time
+	ClearExpiresAt bool
+}
+
+type PantryService interface {
+	AddItem(userID uint, name, quantity, unit string, expiresAt *time.Time) (*domain.PantryItem, error)
+	GetItems(userID uint) ([]domain.PantryItem, error)
+	UpdateItem(userID, itemID uint, update PantryItemUpdate) (*domain.PantryItem, error)
+	DeleteItem(userID, itemID uint) error
+
+	GetCookableRecipes(userID uint, maxMissing, page, limit int) ([]domain.CookableRecipe, int64, error)
+}
+
+type pantryService struct {
+	db  *gorm.DB
+	ctx context.Context
+}
+
+func NewPantryService(db *gorm.DB) PantryService {
+	ctx := context.Background()
+	return &pantryService{db: db, ctx: ctx}
+}
+
+// AddItem adds an ingredient to the user's pantry.
+func (s *pantryService) AddItem(userID uint, name, quantity, unit string, expiresAt *time.Time) (*domain.PantryItem, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrPantryItemNameRequired
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	item := &domain.PantryItem{
+		UserID:   userID,
+		Name:     name,
+		Quantity: strings.TrimSpace(quantity),
+		Unit:     strings.TrimSpace(unit),
+	}
+	if expiresAt != nil {
+		date := toDate(*expiresAt)
+		item.ExpiresAt = &date
+	}
+	item.Parse()
+
+	if err := s.db.WithContext(ctx).Create(item).Error; err != nil {
+		log.Println("error adding pantry item", err)
+		return nil, ErrUnknown
+	}
+	return item, nil
+}
+
+// GetItems returns the user's pantry, soonest to expire first.
+func (s *pantryService) GetItems(userID uint) ([]domain.PantryItem, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var items []domain.PantryItem
+	err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("expires_at ASC NULLS LAST, name, id").
+		Find(&items).Error
+	if err != nil {
+		log.Println("error getting pantry", err)
+		return nil, ErrUnknown
+	}
+	return items, nil
+}
+
+// UpdateItem changes an item in the user's pantry.
+func (s *pantryService) UpdateItem(userID, itemID uint, update PantryItemUpdate) (*domain.PantryItem, error) {
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return nil, ErrPantryItemNameRequired
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	var item domain.PantryItem
+	err := tx.Where("user_id = ?", userID).First(&item, itemID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPantryItemNotFound
+		}
+		log.Println("error getting pantry item", err)
+		return nil, ErrUnknown
+	}
+
+	if update.Name != nil {
+		item.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Quantity != nil {
+		item.Quantity = strings.TrimSpace(*update.Quantity)
+	}
+	if update.Unit != nil {
+		item.Unit = strings.TrimSpace(*update.Unit)
+	}
+	if update.ExpiresAt != nil {
+		date := toDate(*update.ExpiresAt)
+		item.ExpiresAt = &date
+	}
+	if update.ClearExpiresAt {
+		item.ExpiresAt = nil
+	}
+	item.Parse()
+
+	if err = tx.Save(&item).Error; err != nil {
+		log.Println("error updating pantry item", err)
+		return nil, ErrUnknown
+	}
+	return &item, nil
+}
+
+// DeleteItem removes an item from the user's pantry.
+func (s *pantryService) DeleteItem(userID, itemID uint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	res := s.db.WithContext(ctx).Delete(&domain.PantryItem{}, "id = ? AND user_id = ?", itemID, userID)
+	if res.Error != nil {
+		log.Println("error deleting pantry item", res.Error)
+		return ErrUnknown
+	}
+	if res.RowsAffected == 0 {
+		return ErrPantryItemNotFound
+	}
+	return nil
+}
+
+// GetCookableRecipes returns a page of the recipes the user can find, ranked by
+// how many of their ingredients are covered by the user's pantry, along with the
+// number of recipes that matched. Only recipes that use at least one pantry
+// ingredient are considered. If maxMissing is not negative, recipes missing more
+// ingredients than that are left out. At most MAX_COOKABLE_CANDIDATES recipes are
+// matched, so past that the total is a lower bound.
+func (s *pantryService) GetCookableRecipes(userID uint, maxMissing, page, limit int) ([]domain.CookableRecipe, int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+	now := time.Now()
+
+	var pantry []domain.PantryItem
+	if err := tx.Where("user_id = ?", userID).Find(&pantry).Error; err != nil {
+		log.Println("error getting pantry", err)
+		return nil, 0, ErrUnknown
+	}
+
+	var conditions []string
+	var args []any
+	for _, item := range pantry {
+		name := domain.NormalizeIngredientName(item.Name)
+		if name == "" || item.Expired(now) {
+			continue
+		}
+		conditions = append(conditions, "LOWER(ingredients.name) LIKE ?")
+		args = append(args, "%"+escapeLike(name)+"%")
+	}
+	if len(conditions) == 0 {
+		return []domain.CookableRecipe{}, 0, nil
+	}
+
+	// count the ingredients of each recipe that share a name with a pantry item,
+	// so the best candidates are the ones kept
+	matches := tx.Model(&domain.Ingredient{}).
+		Select(
+			"ingredients.recipe_id, COUNT(*) AS ingredients, SUM(CASE WHEN "+strings.Join(conditions, " OR ")+" THEN 1 ELSE 0 END) AS matched",
+			args...,
+		).
+		Group("ingredients.recipe_id")
+
+	query := tx.
+		Scopes(listedFor(userID)).
+		Joins("JOIN (?) AS matches ON matches.recipe_id = recipes.id", matches).
+		Where("matches.matched > 0")
+	if maxMissing >= 0 {
+		// a name match may still not cover the ingredient, so this only rules
+		// out recipes that are certainly missing too much
+		query = query.Where("matches.ingredients - matches.matched <= ?", maxMissing)
+	}
+
+	var recipes []domain.Recipe
+	err := query.
+		Preload("Ingredients").
+		Preload("Instructions", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("instructions.step ASC")
+		}).
+		Preload("Tags").
+		Preload("ForkedFrom").
+		Order("matches.matched DESC, matches.ingredients - matches.matched, recipes.id DESC").
+		Limit(MAX_COOKABLE_CANDIDATES).
+		Find(&recipes).Error
+	if err != nil {
+		log.Println("error getting cookable recipes", err)
+		return nil, 0, ErrUnknown
+	}
+
+	cookable := make([]domain.CookableRecipe, 0, len(recipes))
+	for _, recipe := range recipes {
+		match := domain.MatchPantry(recipe, pantry, now)
+		if match.Covered == 0 || (maxMissing >= 0 && len(match.Missing) > maxMissing) {
+			continue
+		}
+		cookable = append(cookable, match)
+	}
+	domain.RankCookable(cookable)
+
+	total := int64(len(cookable))
+	page, limit = db.PageBounds(page, limit)
+	start := min((page-1)*limit, len(cookable))
+	end := min(start+limit, len(cookable))
+	return cookable[start:end], total, nil
+}
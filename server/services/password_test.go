@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func passwordResetRows(expiresAt time.Time, usedAt any) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "used_at"}).
+		AddRow(1, 1, hashToken("reset-token"), expiresAt, usedAt)
+}
+
+func TestAuthService_ResetPassword(t *testing.T) {
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &authService{db: db, ctx: context.Background()}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "password_resets"`).
+		WithArgs(hashToken("reset-token"), 1).
+		WillReturnRows(passwordResetRows(time.Now().Add(time.Hour), nil))
+	mock.ExpectExec(`UPDATE "password_resets" SET "used_at"=\$1 WHERE id = \$2 AND used_at IS NULL`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "users" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "sessions" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE "api_tokens" SET "revoked_at"=\$1 WHERE user_id = \$2 AND revoked_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err = s.ResetPassword("reset-token", "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAuthService_ResetPassword_unusable(t *testing.T) {
+	tests := map[string]struct {
+		expiresAt time.Time
+		usedAt    any
+	}{
+		"used":    {time.Now().Add(time.Hour), time.Now().Add(-time.Minute)},
+		"expired": {time.Now().Add(-time.Minute), nil},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := mockDb()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &authService{db: db, ctx: context.Background()}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT \* FROM "password_resets"`).WillReturnRows(passwordResetRows(tt.expiresAt, tt.usedAt))
+			mock.ExpectRollback()
+
+			if err = s.ResetPassword("reset-token", "new password"); !errors.Is(err, ErrInvalidResetToken) {
+				t.Errorf("expected ErrInvalidResetToken, got %v", err)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAuthService_ResetPassword_usedByAnotherRequest(t *testing.T) {
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &authService{db: db, ctx: context.Background()}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "password_resets"`).WillReturnRows(passwordResetRows(time.Now().Add(time.Hour), nil))
+	// another request set used_at after the token was read
+	mock.ExpectExec(`UPDATE "password_resets"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	if err = s.ResetPassword("reset-token", "new password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("expected ErrInvalidResetToken, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &authService{db: db, ctx: context.Background()}
+
+	hashed, err := hashPassword("old password", "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "salt"}).AddRow(1, "cook", hashed, "salt"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "sessions" SET "deleted_at"=\$1 WHERE \(user_id = \$2 AND id <> \$3\)`).
+		WithArgs(sqlmock.AnyArg(), 1, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "api_tokens" SET "revoked_at"=\$1 WHERE user_id = \$2 AND revoked_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err = s.ChangePassword(1, 5, "old password", "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
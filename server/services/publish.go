@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// PublishRecipe publishes a draft now, or schedules it to be published by
+// PublishService when at is in the future. Either way the recipe must be
+// complete, and its owner must have verified their email address.
+func (r *recipeService) PublishRecipe(userID, recipeID uint, at *time.Time) (*domain.Recipe, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	recipe, err := getRecipeByIdWithTx(ctx, r.db, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	if err = doesUserOwnRecipe(userID, recipe.UserID); err != nil {
+		return nil, err
+	}
+	if err = requireVerifiedEmailWithTx(r.db.WithContext(ctx), userID); err != nil {
+		return nil, err
+	}
+	if !recipe.IsComplete() {
+		return nil, ErrRecipeIncomplete
+	}
+
+	now := time.Now()
+	updates := map[string]any{}
+	if at != nil && at.After(now) {
+		updates["publish_at"] = *at
+		recipe.PublishAt = at
+	} else {
+		updates["status"] = domain.RecipeStatusPublished
+		updates["published_at"] = now
+		updates["publish_at"] = nil
+		recipe.Status, recipe.PublishedAt, recipe.PublishAt = domain.RecipeStatusPublished, &now, nil
+	}
+
+	err = r.db.WithContext(ctx).Model(&domain.Recipe{}).Where("id = ?", recipeID).Updates(updates).Error
+	if err != nil {
+		log.Println("error publishing recipe", err)
+		return nil, ErrUnknown
+	}
+	return recipe, nil
+}
+
+// UnpublishRecipe turns a recipe back into a draft and cancels any scheduled publishing.
+func (r *recipeService) UnpublishRecipe(userID, recipeID uint) (*domain.Recipe, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	recipe, err := getRecipeByIdWithTx(ctx, r.db, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	if err = doesUserOwnRecipe(userID, recipe.UserID); err != nil {
+		return nil, err
+	}
+
+	err = r.db.WithContext(ctx).
+		Model(&domain.Recipe{}).
+		Where("id = ?", recipeID).
+		Updates(map[string]any{"status": domain.RecipeStatusDraft, "publish_at": nil}).Error
+	if err != nil {
+		log.Println("error unpublishing recipe", err)
+		return nil, ErrUnknown
+	}
+
+	recipe.Status, recipe.PublishAt = domain.RecipeStatusDraft, nil
+	return recipe, nil
+}
+
+// requireVerifiedEmailWithTx returns ErrEmailNotVerified unless the user has verified their email address.
+func requireVerifiedEmailWithTx(tx *gorm.DB, userID uint) error {
+	user, err := getUserByIdWithTx(tx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified() {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// PublishService publishes drafts when their scheduled time comes.
+type PublishService struct {
+	db *gorm.DB
+}
+
+func NewPublishService(db *gorm.DB) PublishService {
+	return PublishService{db: db}
+}
+
+// PublishScheduled publishes every draft whose scheduled time has passed.
+// Drafts that have been emptied since they were scheduled are left as drafts
+// and their schedule is cancelled. Drafts whose owner has no verified email,
+// e.g. because they changed it since, wait until it is verified again.
+func (s *PublishService) PublishScheduled() error {
+	now := time.Now()
+
+	var recipes []domain.Recipe
+	err := s.db.
+		Preload("Ingredients").
+		Preload("Instructions").
+		Where("status = ? AND publish_at <= ?", domain.RecipeStatusDraft, now).
+		Where("user_id IN (?)", s.db.Model(&domain.User{}).Select("id").Where("email IS NOT NULL AND email_verified_at IS NOT NULL")).
+		Find(&recipes).Error
+	if err != nil {
+		return err
+	}
+
+	for _, recipe := range recipes {
+		updates := map[string]any{
+			"status":       domain.RecipeStatusPublished,
+			"published_at": now,
+			"publish_at":   nil,
+		}
+		if !recipe.IsComplete() {
+			log.Printf("not publishing incomplete recipe %d\n", recipe.ID)
+			updates = map[string]any{"publish_at": nil}
+		}
+
+		// only touch drafts that are still scheduled, in case the owner changed them meanwhile
+		res := s.db.Model(&domain.Recipe{}).
+			Where("id = ? AND status = ? AND publish_at <= ?", recipe.ID, domain.RecipeStatusDraft, now).
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+	}
+
+	if len(recipes) > 0 {
+		log.Printf("published %d scheduled recipes\n", len(recipes))
+	}
+	return nil
+}
+
+func (s *PublishService) PublishOnSchedule(t time.Duration) (chan<- bool, error) {
+	if t <= 0 {
+		return nil, errors.New("schedule interval must be positive")
+	}
+
+	done := make(chan bool)
+	ticker := time.NewTicker(t)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				log.Printf("stopping publish job\n")
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				if err := s.PublishScheduled(); err != nil {
+					log.Printf("error publishing scheduled recipes: %v\n", err)
+				}
+			}
+		}
+	}()
+
+	return done, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/jacksonopp/go-recipe/db"
 	"github.com/jacksonopp/go-recipe/domain"
 	"gorm.io/gorm"
 	"log"
@@ -14,6 +15,7 @@ type RecipeService interface {
 	// RECIPES
 	CreateRecipe(userID uint, name, description, cookTime string, servings int, ingredients []domain.IngredientDto, instructions []domain.InstructionDto) (*domain.Recipe, error)
 	GetRecipeById(id uint) (*domain.Recipe, error)
+	GetRecipes(filter RecipeFilter) ([]domain.Recipe, int64, error)
 	UpdateRecipe(userId, recipeID uint, name, description string) (*domain.Recipe, error)
 	DeleteRecipe(userId, recipeID uint) error
 
@@ -31,6 +33,39 @@ type RecipeService interface {
 	//	TAGS
 	AddTagToRecipe(userID uint, recipeID uint, tagId uint) (*domain.Recipe, error)
 	RemoveTagFromRecipe(userID uint, recipeID uint, tagID uint) error
+
+	// FORKS
+	ForkRecipe(userID, recipeID uint) (*domain.Recipe, error)
+	GetRecipeForks(userID, recipeID uint, page, limit int) ([]domain.Recipe, int64, error)
+
+	// REVIEWS
+	CreateReview(userID, recipeID uint, rating int, body string) (*domain.Review, error)
+	UpdateReview(userID, recipeID uint, rating int, body *string) (*domain.Review, error)
+	DeleteReview(userID, recipeID uint) error
+	GetReviews(viewerID, recipeID uint, page, limit int) ([]domain.Review, int64, error)
+
+	// PUBLISHING
+	PublishRecipe(userID, recipeID uint, at *time.Time) (*domain.Recipe, error)
+	UnpublishRecipe(userID, recipeID uint) (*domain.Recipe, error)
+
+	// FAVORITES
+	FavoriteRecipe(userID, recipeID uint) error
+	UnfavoriteRecipe(userID, recipeID uint) error
+	GetUserFavorites(username string, viewerID uint, page, limit int) ([]domain.Recipe, int64, error)
+	AnnotateRecipes(viewerID uint, recipes ...*domain.Recipe) error
+
+	// VISIBILITY
+	GetVisibleRecipe(viewerID, recipeID uint, shareToken string) (*domain.Recipe, error)
+	SetVisibility(userID, recipeID uint, visibility string) (*domain.Recipe, error)
+	CreateShare(userID, recipeID uint, expiresAt *time.Time) (*domain.RecipeShare, string, error)
+	GetShares(userID, recipeID uint) ([]domain.RecipeShare, error)
+	RevokeShare(userID, recipeID, shareID uint) error
+
+	// VERSIONS
+	GetRecipeVersions(viewerID, recipeID uint) ([]domain.RecipeVersion, error)
+	GetRecipeVersion(viewerID, recipeID uint, version int) (*domain.RecipeVersion, error)
+	DiffRecipeVersions(viewerID, recipeID uint, from, to int) (*domain.RecipeDiff, error)
+	RestoreRecipeVersion(userID, recipeID uint, version int) (*domain.Recipe, error)
 }
 
 type recipeService struct {
@@ -48,9 +83,92 @@ type recipeVal struct {
 	err    error
 }
 
+// RecipeFilter narrows and orders the recipes returned by GetRecipes.
+// Zero values are ignored, except ViewerID: only public recipes and the
+// viewer's own are ever returned, so a zero ViewerID only sees public recipes.
+type RecipeFilter struct {
+	ViewerID uint
+	// TagIDs only matches recipes that have every one of the given tags.
+	TagIDs        []uint
+	UserID        uint
+	MinServings   int
+	MaxServings   int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	ForkedFromID  uint
+	// Sort is one of the RecipeSort* constants, defaulting to RecipeSortCreatedAt.
+	Sort  string
+	Desc  bool
+	Page  int
+	Limit int
+}
+
+const (
+	RecipeSortName      = "name"
+	RecipeSortCreatedAt = "created_at"
+)
+
+var recipeSortColumns = map[string]string{
+	RecipeSortName:      "recipes.name",
+	RecipeSortCreatedAt: "recipes.created_at",
+}
+
+// IsValidRecipeSort reports whether sort can be used as RecipeFilter.Sort.
+func IsValidRecipeSort(sort string) bool {
+	_, ok := recipeSortColumns[sort]
+	return sort == "" || ok
+}
+
+// scope applies the filter's conditions, but not its ordering or pagination.
+func (f RecipeFilter) scope(tx *gorm.DB) *gorm.DB {
+	tx = tx.Scopes(listedFor(f.ViewerID))
+	if len(f.TagIDs) > 0 {
+		tx = tx.Where(
+			"recipes.id IN (?)",
+			tx.Session(&gorm.Session{NewDB: true}).
+				Table("recipe_tags").
+				Select("recipe_id").
+				Where("tag_id IN ?", f.TagIDs).
+				Group("recipe_id").
+				Having("COUNT(DISTINCT tag_id) = ?", len(f.TagIDs)),
+		)
+	}
+	if f.UserID != 0 {
+		tx = tx.Where("recipes.user_id = ?", f.UserID)
+	}
+	if f.MinServings > 0 {
+		tx = tx.Where("recipes.servings >= ?", f.MinServings)
+	}
+	if f.MaxServings > 0 {
+		tx = tx.Where("recipes.servings <= ?", f.MaxServings)
+	}
+	if !f.CreatedAfter.IsZero() {
+		tx = tx.Where("recipes.created_at >= ?", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		tx = tx.Where("recipes.created_at < ?", f.CreatedBefore)
+	}
+	if f.ForkedFromID != 0 {
+		tx = tx.Where("recipes.forked_from_id = ?", f.ForkedFromID)
+	}
+	return tx
+}
+
+func (f RecipeFilter) order() string {
+	column, ok := recipeSortColumns[f.Sort]
+	if !ok {
+		column = recipeSortColumns[RecipeSortCreatedAt]
+	}
+	if f.Desc {
+		return column + " DESC, recipes.id DESC"
+	}
+	return column + " ASC, recipes.id ASC"
+}
+
 // RECIPES
 
 // CreateRecipe creates a new recipe with the given name and description.
+// New recipes are drafts until they are published.
 func (r *recipeService) CreateRecipe(userID uint, name, description, cookTime string, servings int, ingredients []domain.IngredientDto, instructions []domain.InstructionDto) (*domain.Recipe, error) {
 	ctx, cancel := context.WithTimeout(r.ctx, 5*time.Second)
 	defer cancel()
@@ -62,60 +180,22 @@ func (r *recipeService) CreateRecipe(userID uint, name, description, cookTime st
 		tx := r.db.Begin()
 		defer recoverTx(tx)
 
-		recipe := &domain.Recipe{
-			Name:        name,
-			Description: description,
-			Servings:    servings,
-			CookTime:    cookTime,
-			UserID:      userID,
-		}
-
-		err := tx.Create(recipe).Error
-		if err != nil {
-			err := fmt.Sprintf("error creating recipe: %v", err)
-			log.Println(err)
-			ch <- recipeVal{
-				nil,
-				ErrUnknown,
-			}
-			return
-		}
-
-		ings := make([]domain.Ingredient, len(ingredients))
-		for i, ingredient := range ingredients {
-			ings[i] = domain.Ingredient{
-				Name:     ingredient.Name,
-				Quantity: ingredient.Quantity,
-				Unit:     ingredient.Unit,
-				RecipeID: recipe.ID,
-			}
-		}
-		err = tx.Create(&ings).Error
+		recipe, err := createRecipeWithTx(tx, userID, name, description, cookTime, servings, ingredients, instructions)
 		if err != nil {
-			err := fmt.Sprintf("error creating ingredients: %v", err)
-			log.Println(err)
+			tx.Rollback()
 			ch <- recipeVal{
 				nil,
-				ErrUnknown,
+				err,
 			}
 			return
 		}
 
-		insts := make([]domain.Instruction, len(instructions))
-		for i, instruction := range instructions {
-			insts[i] = domain.Instruction{
-				Step:     instruction.Step,
-				Contents: instruction.Contents,
-				RecipeID: recipe.ID,
-			}
-		}
-		err = tx.Create(&insts).Error
+		err = recipeChangedWithTx(r.ctx, tx, recipe.ID, userID, domain.VersionChangeCreateRecipe)
 		if err != nil {
-			err := fmt.Sprintf("error creating instructions: %v", err)
-			log.Println(err)
+			tx.Rollback()
 			ch <- recipeVal{
 				nil,
-				ErrUnknown,
+				err,
 			}
 			return
 		}
@@ -195,6 +275,16 @@ func (r *recipeService) UpdateRecipe(userId, recipeID uint, name, description st
 			return
 		}
 
+		err = recipeChangedWithTx(r.ctx, tx, recipe.ID, userId, domain.VersionChangeUpdateRecipe)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{
+				nil,
+				err,
+			}
+			return
+		}
+
 		err = tx.Commit().Error
 		if err != nil {
 			log.Println("error committing transaction", err)
@@ -223,6 +313,66 @@ func (r *recipeService) GetRecipeById(id uint) (*domain.Recipe, error) {
 	return getRecipeByIdWithTx(r.ctx, r.db, id)
 }
 
+// GetRecipes returns a page of recipes matching the filter along with the
+// total number of matching recipes.
+func (r *recipeService) GetRecipes(filter RecipeFilter) ([]domain.Recipe, int64, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	type recipesVal struct {
+		recipes []domain.Recipe
+		total   int64
+		err     error
+	}
+
+	ch := make(chan recipesVal)
+
+	go func() {
+		defer cancel()
+
+		var total int64
+		err := r.db.Model(&domain.Recipe{}).
+			Scopes(filter.scope).
+			Count(&total).
+			Error
+		if err != nil {
+			log.Println("error counting recipes", err)
+			ch <- recipesVal{nil, 0, ErrUnknown}
+			return
+		}
+
+		var recipes []domain.Recipe
+		err = r.db.
+			Scopes(filter.scope, db.Paginate(filter.Page, filter.Limit)).
+			Preload("Ingredients").
+			Preload("Instructions", func(tx *gorm.DB) *gorm.DB {
+				return tx.Order("instructions.step ASC")
+			}).
+			Preload("Tags").
+			Preload("ForkedFrom").
+			Order(filter.order()).
+			Find(&recipes).
+			Error
+		if err != nil {
+			log.Println("error getting recipes", err)
+			ch <- recipesVal{nil, 0, ErrUnknown}
+			return
+		}
+
+		ch <- recipesVal{recipes, total, nil}
+	}()
+
+	select {
+	case v := <-ch:
+		return v.recipes, v.total, v.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, 0, ErrTimeout
+		}
+		return nil, 0, ErrTimeoutNoMessage
+	}
+}
+
 // DeleteRecipe deletes the recipe with the given ID.
 func (r *recipeService) DeleteRecipe(userId, recipeID uint) error {
 	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
@@ -274,6 +424,12 @@ func (r *recipeService) DeleteRecipe(userId, recipeID uint) error {
 			errCh <- ErrUnknown
 			return
 		}
+		err = removeRecipeFromIndexWithTx(tx, recipeID)
+		if err != nil {
+			tx.Rollback()
+			errCh <- err
+			return
+		}
 		err = tx.Commit().Error
 		if err != nil {
 			log.Println("error committing transaction", err)
@@ -333,12 +489,15 @@ func (r *recipeService) AddIngredientToRecipe(userId, recipeID uint, name, quant
 			return
 		}
 
-		err = tx.Create(&domain.Ingredient{
+		ingredient := &domain.Ingredient{
 			Name:     name,
 			Quantity: quantity,
 			Unit:     unit,
 			RecipeID: recipeID,
-		}).Error
+		}
+		ingredient.Parse()
+
+		err = tx.Create(ingredient).Error
 		if err != nil {
 			log.Println("error creating ingredient", err)
 			tx.Rollback()
@@ -349,6 +508,16 @@ func (r *recipeService) AddIngredientToRecipe(userId, recipeID uint, name, quant
 			return
 		}
 
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userId, domain.VersionChangeAddIngredient)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{
+				nil,
+				err,
+			}
+			return
+		}
+
 		if err := tx.Commit().Error; err != nil {
 			log.Println("error committing transaction", err)
 			ch <- recipeVal{
@@ -425,6 +594,7 @@ func (r *recipeService) UpdateIngredient(userId, recipeID, ingredientID uint, na
 		if unit != "" {
 			ingredient.Unit = unit
 		}
+		ingredient.Parse()
 
 		err = tx.Save(&ingredient).Error
 		if err != nil {
@@ -458,6 +628,16 @@ func (r *recipeService) UpdateIngredient(userId, recipeID, ingredientID uint, na
 			return
 		}
 
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userId, domain.VersionChangeUpdateIngredient)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{
+				nil,
+				err,
+			}
+			return
+		}
+
 		err = tx.Commit().Error
 		if err != nil {
 			log.Println("error getting recipe", err)
@@ -529,6 +709,12 @@ func (r *recipeService) DeleteIngredient(userId, recipeID, ingredientID uint) er
 			errCh <- ErrUnknown
 			return
 		}
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userId, domain.VersionChangeDeleteIngredient)
+		if err != nil {
+			tx.Rollback()
+			errCh <- err
+			return
+		}
 		err = tx.Commit().Error
 		if err != nil {
 			log.Println("error committing transaction", err)
@@ -600,6 +786,16 @@ func (r *recipeService) AddInstructionToRecipe(userID uint, recipeID uint, step
 			return
 		}
 
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userID, domain.VersionChangeAddInstruction)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{
+				nil,
+				err,
+			}
+			return
+		}
+
 		err = tx.Commit().Error
 		if err != nil {
 			log.Println("error getting recipe", err)
@@ -694,6 +890,16 @@ func (r *recipeService) UpdateInstruction(userID, recipeID, instructionID uint,
 			return
 		}
 
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userID, domain.VersionChangeUpdateInstruction)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{
+				nil,
+				err,
+			}
+			return
+		}
+
 		err = tx.Commit().Error
 		if err != nil {
 			log.Println("error getting recipe", err)
@@ -808,6 +1014,16 @@ func (r *recipeService) SwapInstructions(userID, recipeID, instructionOneID, ins
 			return
 		}
 
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userID, domain.VersionChangeSwapInstructions)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{
+				nil,
+				err,
+			}
+			return
+		}
+
 		err = tx.Commit().Error
 		if err != nil {
 			log.Println("error getting recipe", err)
@@ -874,6 +1090,13 @@ func (r *recipeService) DeleteInstruction(userID, recipeID, instructionID uint)
 			return
 		}
 
+		err = moveCommentsToRecipeWithTx(tx, []uint{instruction.ID})
+		if err != nil {
+			tx.Rollback()
+			errCh <- err
+			return
+		}
+
 		err = tx.Delete(&instruction).Error
 		if err != nil {
 			log.Println("error deleting instruction", err)
@@ -881,6 +1104,12 @@ func (r *recipeService) DeleteInstruction(userID, recipeID, instructionID uint)
 			errCh <- ErrUnknown
 			return
 		}
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userID, domain.VersionChangeDeleteInstruction)
+		if err != nil {
+			tx.Rollback()
+			errCh <- err
+			return
+		}
 		tx.Commit()
 		log.Println("deleted instruction", instruction)
 	}()
@@ -987,6 +1216,16 @@ func (r *recipeService) AddTagToRecipe(userID uint, recipeID uint, tagID uint) (
 			return
 		}
 
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userID, domain.VersionChangeAddTag)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{
+				nil,
+				err,
+			}
+			return
+		}
+
 		// Commit transaction
 		err = tx.Commit().Error
 		if err != nil {
@@ -1065,6 +1304,13 @@ func (r *recipeService) RemoveTagFromRecipe(userID uint, recipeID uint, tagID ui
 			return
 		}
 
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userID, domain.VersionChangeRemoveTag)
+		if err != nil {
+			tx.Rollback()
+			errCh <- err
+			return
+		}
+
 		err = tx.Commit().Error
 		if err != nil {
 			errCh <- ErrCommit
@@ -1084,6 +1330,57 @@ func (r *recipeService) RemoveTagFromRecipe(userID uint, recipeID uint, tagID ui
 	}
 }
 
+// createRecipeWithTx creates a draft recipe with its ingredients and instructions.
+// The caller must still call recipeChangedWithTx once the recipe is complete.
+func createRecipeWithTx(tx *gorm.DB, userID uint, name, description, cookTime string, servings int, ingredients []domain.IngredientDto, instructions []domain.InstructionDto) (*domain.Recipe, error) {
+	recipe := &domain.Recipe{
+		Name:        name,
+		Description: description,
+		Servings:    servings,
+		CookTime:    cookTime,
+		UserID:      userID,
+		Status:      domain.RecipeStatusDraft,
+	}
+	if err := tx.Create(recipe).Error; err != nil {
+		log.Println("error creating recipe", err)
+		return nil, ErrUnknown
+	}
+
+	ings := make([]domain.Ingredient, len(ingredients))
+	for i, ingredient := range ingredients {
+		ings[i] = domain.Ingredient{
+			Name:     ingredient.Name,
+			Quantity: ingredient.Quantity,
+			Unit:     ingredient.Unit,
+			RecipeID: recipe.ID,
+		}
+		ings[i].Parse()
+	}
+	if len(ings) > 0 {
+		if err := tx.Create(&ings).Error; err != nil {
+			log.Println("error creating ingredients", err)
+			return nil, ErrUnknown
+		}
+	}
+
+	insts := make([]domain.Instruction, len(instructions))
+	for i, instruction := range instructions {
+		insts[i] = domain.Instruction{
+			Step:     instruction.Step,
+			Contents: instruction.Contents,
+			RecipeID: recipe.ID,
+		}
+	}
+	if len(insts) > 0 {
+		if err := tx.Create(&insts).Error; err != nil {
+			log.Println("error creating instructions", err)
+			return nil, ErrUnknown
+		}
+	}
+
+	return recipe, nil
+}
+
 func getRecipeByIdWithTx(ctx context.Context, tx *gorm.DB, id uint) (*domain.Recipe, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -1096,6 +1393,7 @@ func getRecipeByIdWithTx(ctx context.Context, tx *gorm.DB, id uint) (*domain.Rec
 		err := tx.
 			Preload("Ingredients").
 			Preload("Tags").
+			Preload("ForkedFrom").
 			First(&recipe, id).Error
 		if err != nil {
 			log.Println("error getting recipe", err)
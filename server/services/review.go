@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/db"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+)
+
+// CreateReview rates a recipe on behalf of a user, with an optional written review.
+// Users can review each recipe once and cannot review their own.
+func (r *recipeService) CreateReview(userID, recipeID uint, rating int, body string) (*domain.Review, error) {
+	if !domain.IsValidRating(rating) {
+		return nil, ErrInvalidRating
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	recipe, err := getVisibleRecipeWithTx(ctx, r.db, userID, recipeID, "")
+	if err != nil {
+		return nil, err
+	}
+	if recipe.UserID == userID {
+		return nil, ErrOwnRecipeReview
+	}
+
+	review := &domain.Review{
+		RecipeID: recipeID,
+		UserID:   userID,
+		Rating:   rating,
+		Body:     body,
+	}
+	err = r.db.WithContext(ctx).Create(review).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrReviewConflict
+		}
+		log.Println("error creating review", err)
+		return nil, ErrUnknown
+	}
+	return review, nil
+}
+
+// UpdateReview changes the user's review of a recipe. A rating of 0 leaves the
+// rating unchanged and a nil body leaves the written review unchanged.
+func (r *recipeService) UpdateReview(userID, recipeID uint, rating int, body *string) (*domain.Review, error) {
+	if rating != 0 && !domain.IsValidRating(rating) {
+		return nil, ErrInvalidRating
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var review domain.Review
+	err := r.db.WithContext(ctx).Where("recipe_id = ? AND user_id = ?", recipeID, userID).First(&review).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReviewNotFound
+		}
+		log.Println("error getting review", err)
+		return nil, ErrUnknown
+	}
+
+	if rating != 0 {
+		review.Rating = rating
+	}
+	if body != nil {
+		review.Body = *body
+	}
+
+	if err = r.db.WithContext(ctx).Save(&review).Error; err != nil {
+		log.Println("error updating review", err)
+		return nil, ErrUnknown
+	}
+	return &review, nil
+}
+
+// DeleteReview removes the user's review of a recipe.
+func (r *recipeService) DeleteReview(userID, recipeID uint) error {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	res := r.db.WithContext(ctx).Delete(&domain.Review{}, "recipe_id = ? AND user_id = ?", recipeID, userID)
+	if res.Error != nil {
+		log.Println("error deleting review", res.Error)
+		return ErrUnknown
+	}
+	if res.RowsAffected == 0 {
+		return ErrReviewNotFound
+	}
+	return nil
+}
+
+// GetReviews returns a page of a recipe's reviews, newest first, along with the total number of reviews.
+func (r *recipeService) GetReviews(viewerID, recipeID uint, page, limit int) ([]domain.Review, int64, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	if _, err := getVisibleRecipeWithTx(ctx, r.db, viewerID, recipeID, ""); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	err := r.db.WithContext(ctx).Model(&domain.Review{}).Where("recipe_id = ?", recipeID).Count(&total).Error
+	if err != nil {
+		log.Println("error counting reviews", err)
+		return nil, 0, ErrUnknown
+	}
+
+	var reviews []domain.Review
+	err = r.db.WithContext(ctx).
+		Scopes(db.Paginate(page, limit)).
+		Where("recipe_id = ?", recipeID).
+		Order("created_at DESC, id DESC").
+		Find(&reviews).Error
+	if err != nil {
+		log.Println("error getting reviews", err)
+		return nil, 0, ErrUnknown
+	}
+	return reviews, total, nil
+}
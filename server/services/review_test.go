@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jacksonopp/go-recipe/domain"
+	"testing"
+)
+
+// expectRecipe expects recipe 1, owned by user 1, to be loaded by getRecipeByIdWithTx.
+func expectRecipe(mock sqlmock.Sqlmock, visibility string) {
+	mock.ExpectQuery(`SELECT \* FROM "recipes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "user_id", "visibility", "status"}).
+			AddRow(1, "Soup", 1, visibility, domain.RecipeStatusPublished))
+	mock.ExpectQuery(`SELECT \* FROM "ingredients"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "recipe_tags"`).WillReturnRows(sqlmock.NewRows([]string{"recipe_id", "tag_id"}))
+	mock.ExpectQuery(`SELECT \* FROM "instructions"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+func TestRecipeService_CreateReview(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     uint
+		visibility string
+		// insertErr is what saving the review fails with, if it gets that far
+		insertErr error
+		expected  error
+	}{
+		{"review", 2, domain.VisibilityPublic, nil, nil},
+		{"own recipe", 1, domain.VisibilityPublic, nil, ErrOwnRecipeReview},
+		{"second review", 2, domain.VisibilityPublic, &pgconn.PgError{Code: "23505"}, ErrReviewConflict},
+		{"private recipe", 2, domain.VisibilityPrivate, nil, ErrRecipeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := mockDb()
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.Config.TranslateError = true
+			s := &recipeService{db: db, ctx: context.Background()}
+
+			expectRecipe(mock, tt.visibility)
+			if tt.expected == nil || tt.insertErr != nil {
+				mock.ExpectBegin()
+				insert := mock.ExpectQuery(`INSERT INTO "reviews"`)
+				if tt.insertErr != nil {
+					insert.WillReturnError(tt.insertErr)
+					mock.ExpectRollback()
+				} else {
+					insert.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					mock.ExpectCommit()
+				}
+			}
+
+			review, err := s.CreateReview(tt.userID, 1, 4, "Lovely")
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, err)
+			}
+			if err == nil && (review.UserID != tt.userID || review.Rating != 4) {
+				t.Errorf("expected a 4 star review by user %d, got %+v", tt.userID, review)
+			}
+			if err = mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
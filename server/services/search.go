@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/db"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"html"
+	"log"
+	"strings"
+)
+
+// searchConfig is the postgres text search configuration used for indexing and querying.
+const searchConfig = "english"
+
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2"
+
+type SearchService interface {
+	Search(query string, viewerID uint, page, limit int) ([]domain.RecipeSearchResult, int64, error)
+	IndexMissing() error
+}
+
+type searchService struct {
+	db  *gorm.DB
+	ctx context.Context
+}
+
+func NewSearchService(db *gorm.DB) SearchService {
+	ctx := context.Background()
+	return &searchService{db: db, ctx: ctx}
+}
+
+// Search returns a page of recipes matching the query, best matches first,
+// along with the total number of matching recipes.
+// The query supports web search syntax, e.g. `chickpea curry -coconut` or `"green curry"`.
+// Only public recipes and the viewer's own are searched.
+func (s *searchService) Search(query string, viewerID uint, page, limit int) ([]domain.RecipeSearchResult, int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	type searchVal struct {
+		results []domain.RecipeSearchResult
+		total   int64
+		err     error
+	}
+
+	ch := make(chan searchVal)
+
+	go func() {
+		defer cancel()
+
+		matches := func(tx *gorm.DB) *gorm.DB {
+			return tx.Table("recipe_search_documents AS d").
+				Joins("CROSS JOIN websearch_to_tsquery(?, ?) AS q", searchConfig, query).
+				Joins("JOIN recipes ON recipes.id = d.recipe_id AND recipes.deleted_at IS NULL").
+				Where("d.vector @@ q").
+				Scopes(listedFor(viewerID))
+		}
+
+		var total int64
+		err := s.db.Scopes(matches).Count(&total).Error
+		if err != nil {
+			log.Println("error counting search results", err)
+			ch <- searchVal{nil, 0, ErrUnknown}
+			return
+		}
+
+		var hits []struct {
+			RecipeID uint
+			Rank     float64
+			Snippet  string
+		}
+		err = s.db.
+			Scopes(matches, db.Paginate(page, limit)).
+			Select("d.recipe_id, ts_rank(d.vector, q) AS rank, ts_headline(?, d.document, q, ?) AS snippet", searchConfig, headlineOptions).
+			Order("rank DESC, d.recipe_id DESC").
+			Scan(&hits).
+			Error
+		if err != nil {
+			log.Println("error searching recipes", err)
+			ch <- searchVal{nil, 0, ErrUnknown}
+			return
+		}
+
+		ids := make([]uint, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.RecipeID
+		}
+
+		var recipes []domain.Recipe
+		if len(ids) > 0 {
+			err = s.db.
+				Preload("Ingredients").
+				Preload("Instructions", func(tx *gorm.DB) *gorm.DB {
+					return tx.Order("instructions.step ASC")
+				}).
+				Preload("Tags").
+				Preload("ForkedFrom").
+				Find(&recipes, ids).
+				Error
+			if err != nil {
+				log.Println("error getting search results", err)
+				ch <- searchVal{nil, 0, ErrUnknown}
+				return
+			}
+		}
+
+		byID := make(map[uint]domain.Recipe, len(recipes))
+		for _, recipe := range recipes {
+			byID[recipe.ID] = recipe
+		}
+
+		results := make([]domain.RecipeSearchResult, 0, len(hits))
+		for _, hit := range hits {
+			recipe, ok := byID[hit.RecipeID]
+			if !ok {
+				continue
+			}
+			results = append(results, domain.RecipeSearchResult{
+				Recipe:  recipe,
+				Rank:    hit.Rank,
+				Snippet: hit.Snippet,
+			})
+		}
+
+		ch <- searchVal{results, total, nil}
+	}()
+
+	select {
+	case v := <-ch:
+		return v.results, v.total, v.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, 0, ErrTimeout
+		}
+		return nil, 0, ErrTimeoutNoMessage
+	}
+}
+
+// IndexMissing indexes every recipe that does not have a search document yet,
+// e.g. recipes created before search was introduced.
+func (s *searchService) IndexMissing() error {
+	var ids []uint
+	err := s.db.Model(&domain.Recipe{}).
+		Where("id NOT IN (?)", s.db.Model(&domain.RecipeSearchDocument{}).Select("recipe_id")).
+		Pluck("id", &ids).
+		Error
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			return indexRecipeWithTx(s.ctx, tx, id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(ids) > 0 {
+		log.Printf("indexed %d recipes for search", len(ids))
+	}
+	return nil
+}
+
+// indexRecipeWithTx creates or refreshes the search document for a recipe.
+// It must be called after every change to the recipe's name, description,
+// ingredients or instructions.
+func indexRecipeWithTx(ctx context.Context, tx *gorm.DB, recipeID uint) error {
+	recipe, err := getRecipeByIdWithTx(ctx, tx, recipeID)
+	if err != nil {
+		return err
+	}
+
+	name, description, ingredients, instructions := searchFields(recipe)
+	document := html.EscapeString(strings.Join([]string{name, description, ingredients, instructions}, "\n"))
+
+	err = tx.Exec(`
+		INSERT INTO recipe_search_documents (recipe_id, document, vector, updated_at)
+		VALUES (
+			?,
+			?,
+			setweight(to_tsvector(?, ?), 'A') ||
+			setweight(to_tsvector(?, ?), 'B') ||
+			setweight(to_tsvector(?, ?), 'C') ||
+			setweight(to_tsvector(?, ?), 'D'),
+			NOW()
+		)
+		ON CONFLICT (recipe_id) DO UPDATE
+		SET document = EXCLUDED.document, vector = EXCLUDED.vector, updated_at = EXCLUDED.updated_at`,
+		recipe.ID,
+		document,
+		searchConfig, name,
+		searchConfig, ingredients,
+		searchConfig, description,
+		searchConfig, instructions,
+	).Error
+	if err != nil {
+		log.Println("error indexing recipe", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// removeRecipeFromIndexWithTx deletes the search document for a recipe.
+func removeRecipeFromIndexWithTx(tx *gorm.DB, recipeID uint) error {
+	err := tx.Delete(&domain.RecipeSearchDocument{}, "recipe_id = ?", recipeID).Error
+	if err != nil {
+		log.Println("error removing recipe from index", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// searchFields flattens the searchable parts of a recipe.
+// Matches are ranked name first, then ingredients, description and instructions.
+func searchFields(recipe *domain.Recipe) (name, description, ingredients, instructions string) {
+	ingredientNames := make([]string, len(recipe.Ingredients))
+	for i, ingredient := range recipe.Ingredients {
+		ingredientNames[i] = ingredient.Name
+	}
+
+	instructionContents := make([]string, len(recipe.Instructions))
+	for i, instruction := range recipe.Instructions {
+		instructionContents[i] = instruction.Contents
+	}
+
+	return recipe.Name, recipe.Description, strings.Join(ingredientNames, "\n"), strings.Join(instructionContents, "\n")
+}
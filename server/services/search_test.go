@@ -0,0 +1,42 @@
+package services
+
+import (
+	"github.com/jacksonopp/go-recipe/domain"
+	"testing"
+)
+
+func TestSearchFields(t *testing.T) {
+	recipe := &domain.Recipe{
+		Name:        "Chickpea Curry",
+		Description: "A weeknight staple",
+		Ingredients: []domain.Ingredient{
+			{Name: "chickpeas"},
+			{Name: "coconut milk"},
+		},
+		Instructions: []domain.Instruction{
+			{Step: 1, Contents: "Fry the onions."},
+			{Step: 2, Contents: "Add the chickpeas."},
+		},
+	}
+
+	name, description, ingredients, instructions := searchFields(recipe)
+
+	tests := []struct {
+		field    string
+		got      string
+		expected string
+	}{
+		{"name", name, "Chickpea Curry"},
+		{"description", description, "A weeknight staple"},
+		{"ingredients", ingredients, "chickpeas\ncoconut milk"},
+		{"instructions", instructions, "Fry the onions.\nAdd the chickpeas."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, tt.got)
+			}
+		})
+	}
+}
@@ -8,6 +8,13 @@ import (
 	"time"
 )
 
+// SESSION_DURATION is how long a session lasts after it was last used.
+const SESSION_DURATION = 24 * time.Hour
+
+// SESSION_TOUCH_INTERVAL is how often a session's last seen time and expiry are
+// updated, so that every request does not have to write to the database.
+const SESSION_TOUCH_INTERVAL = time.Minute
+
 type SessionService struct {
 	db *gorm.DB
 }
@@ -16,16 +23,22 @@ func NewSessionService(db *gorm.DB) SessionService {
 	return SessionService{db: db}
 }
 
-func (s *SessionService) CreateSession(userID uint) (string, error) {
+// CreateSession signs a user in and returns the new session's token. userAgent
+// and ipAddress describe the client signing in.
+func (s *SessionService) CreateSession(userID uint, userAgent, ipAddress string) (string, error) {
 	token, err := genRandStr(32)
 	if err != nil {
 		return "", err
 	}
 
+	now := time.Now()
 	session := domain.Session{
-		UserID:    userID,
-		Token:     token,
-		ExpiresAt: time.Now().Add(time.Hour * 24),
+		UserID:     userID,
+		Token:      token,
+		ExpiresAt:  now.Add(SESSION_DURATION),
+		LastSeenAt: now,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
 	}
 
 	res := s.db.Create(&session)
@@ -46,7 +59,7 @@ func (s *SessionService) CheckSession(token string) error {
 		return ErrUnknown
 	}
 
-	if session.ExpiresAt.Before(time.Now()) {
+	if session.Expired(time.Now()) {
 		err := s.DeleteSessionByToken(token)
 		if err != nil {
 			return err
@@ -57,6 +70,93 @@ func (s *SessionService) CheckSession(token string) error {
 	return nil
 }
 
+// Authenticate returns the user a session token belongs to, along with the
+// session. Using a session keeps it alive for another SESSION_DURATION.
+func (s *SessionService) Authenticate(token string) (*domain.User, *domain.Session, error) {
+	var session domain.Session
+	res := s.db.First(&session, "token = ?", token)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrSessionNotFound
+		}
+		log.Println("error getting session", res.Error)
+		return nil, nil, ErrUnknown
+	}
+
+	now := time.Now()
+	if session.Expired(now) {
+		return nil, nil, ErrSessionExpired
+	}
+
+	var user domain.User
+	res = s.db.First(&user, session.UserID)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrSessionNotFound
+		}
+		log.Println("error getting session user", res.Error)
+		return nil, nil, ErrUnknown
+	}
+
+	if now.Sub(session.LastSeenAt) >= SESSION_TOUCH_INTERVAL {
+		session.LastSeenAt = now
+		session.ExpiresAt = now.Add(SESSION_DURATION)
+		res = s.db.Model(&session).Updates(map[string]any{
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+		})
+		if res.Error != nil {
+			// the session is still valid until its old expiry
+			log.Println("error extending session", res.Error)
+		}
+	}
+
+	return &user, &session, nil
+}
+
+// GetSessions returns a user's sessions that have not expired, most recently used first.
+func (s *SessionService) GetSessions(userID uint) ([]domain.Session, error) {
+	var sessions []domain.Session
+	res := s.db.
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions)
+	if res.Error != nil {
+		log.Println("error getting sessions", res.Error)
+		return nil, ErrUnknown
+	}
+	return sessions, nil
+}
+
+// DeleteSession signs out one of a user's sessions.
+func (s *SessionService) DeleteSession(userID, sessionID uint) error {
+	res := s.db.Delete(&domain.Session{}, "id = ? AND user_id = ?", sessionID, userID)
+	if res.Error != nil {
+		log.Println("error deleting session", res.Error)
+		return ErrUnknown
+	}
+	if res.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// DeleteOtherSessions signs out every one of a user's sessions except keepID,
+// and returns how many were signed out. keepID must be the session asking, so
+// ErrSessionNotFound is returned when it is 0.
+func (s *SessionService) DeleteOtherSessions(userID, keepID uint) (int64, error) {
+	if keepID == 0 {
+		return 0, ErrSessionNotFound
+	}
+
+	res := s.db.Delete(&domain.Session{}, "user_id = ? AND id <> ?", userID, keepID)
+	if res.Error != nil {
+		log.Println("error deleting sessions", res.Error)
+		return 0, ErrUnknown
+	}
+	return res.RowsAffected, nil
+}
+
 func (s *SessionService) DeleteSessionByToken(token string) error {
 	res := s.db.Delete(&domain.Session{}, "token = ?", token)
 	if res.Error != nil {
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"strings"
+	"time"
+)
+
+// DEFAULT_SHOPPING_LIST_NAME is the name of shopping lists created without one.
+const DEFAULT_SHOPPING_LIST_NAME = "Shopping list"
+
+// ShoppingListRecipe is a recipe to shop for. Servings of 0 uses the recipe's own servings.
+type ShoppingListRecipe struct {
+	RecipeID uint
+	Servings int
+}
+
+// ShoppingListItemUpdate holds the changes to a shopping list item. Nil fields are left unchanged.
+type ShoppingListItemUpdate struct {
+	Name     *string
+	Quantity *string
+	Unit     *string
+	Checked  *bool
+}
+
+type ShoppingListService interface {
+	CreateShoppingList(userID uint, name string, recipes []ShoppingListRecipe, from, to *time.Time) (*domain.ShoppingList, error)
+	GetShoppingList(userID, listID uint) (*domain.ShoppingList, error)
+	GetShoppingLists(userID uint) ([]domain.ShoppingList, error)
+	RenameShoppingList(userID, listID uint, name string) (*domain.ShoppingList, error)
+	DeleteShoppingList(userID, listID uint) error
+
+	AddItem(userID, listID uint, name, quantity, unit string) (*domain.ShoppingListItem, error)
+	UpdateItem(userID, listID, itemID uint, update ShoppingListItemUpdate) (*domain.ShoppingListItem, error)
+	DeleteItem(userID, listID, itemID uint) error
+
+	AddMember(userID, listID uint, username string) (*domain.ShoppingList, error)
+	RemoveMember(userID, listID, memberID uint) error
+}
+
+type shoppingListService struct {
+	db  *gorm.DB
+	ctx context.Context
+}
+
+func NewShoppingListService(db *gorm.DB) ShoppingListService {
+	ctx := context.Background()
+	return &shoppingListService{db: db, ctx: ctx}
+}
+
+// CreateShoppingList creates a shopping list with the combined ingredients of
+// the given recipes, scaled to their servings, and of the recipes in the user's
+// meal plan from one date to another, if both are set.
+func (s *shoppingListService) CreateShoppingList(userID uint, name string, recipes []ShoppingListRecipe, from, to *time.Time) (*domain.ShoppingList, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DEFAULT_SHOPPING_LIST_NAME
+	}
+	for _, recipe := range recipes {
+		if recipe.Servings < 0 {
+			return nil, ErrInvalidServings
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var ingredients []domain.Ingredient
+	for _, r := range recipes {
+		recipe, err := getVisibleRecipeWithTx(ctx, s.db.WithContext(ctx), userID, r.RecipeID, "")
+		if err != nil {
+			return nil, err
+		}
+		if r.Servings > 0 {
+			scaled := recipe.Scale(r.Servings)
+			recipe = &scaled
+		}
+		ingredients = append(ingredients, recipe.Ingredients...)
+	}
+
+	if from != nil && to != nil {
+		entries, err := NewMealPlanService(s.db).GetEntries(userID, *from, *to)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			recipe := entry.Recipe
+			if entry.Servings != nil {
+				recipe = recipe.Scale(*entry.Servings)
+			}
+			ingredients = append(ingredients, recipe.Ingredients...)
+		}
+	}
+
+	list := &domain.ShoppingList{
+		Name:    name,
+		UserID:  userID,
+		Items:   domain.AggregateIngredients(ingredients),
+		Members: []domain.ShoppingListMember{},
+	}
+	if list.Items == nil {
+		list.Items = []domain.ShoppingListItem{}
+	}
+
+	err := s.db.WithContext(ctx).Create(list).Error
+	if err != nil {
+		log.Println("error creating shopping list", err)
+		return nil, ErrUnknown
+	}
+	return list, nil
+}
+
+// GetShoppingList returns a shopping list the user owns or has been shared, with
+// its items and members.
+func (s *shoppingListService) GetShoppingList(userID, listID uint) (*domain.ShoppingList, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	return getShoppingListWithTx(s.db.WithContext(ctx), userID, listID)
+}
+
+// GetShoppingLists returns the shopping lists the user owns or has been shared,
+// most recently changed first, without their items.
+func (s *shoppingListService) GetShoppingLists(userID uint) ([]domain.ShoppingList, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	var lists []domain.ShoppingList
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? OR id IN (?)", userID,
+			s.db.Model(&domain.ShoppingListMember{}).Select("shopping_list_id").Where("user_id = ?", userID)).
+		Order("updated_at DESC, id DESC").
+		Find(&lists).Error
+	if err != nil {
+		log.Println("error getting shopping lists", err)
+		return nil, ErrUnknown
+	}
+	return lists, nil
+}
+
+// RenameShoppingList changes the name of a shopping list. Only the owner can rename it.
+func (s *shoppingListService) RenameShoppingList(userID, listID uint, name string) (*domain.ShoppingList, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrShoppingListNameRequired
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	list, err := getOwnShoppingListWithTx(tx, userID, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Model(&domain.ShoppingList{}).Where("id = ?", listID).Update("name", name).Error
+	if err != nil {
+		log.Println("error renaming shopping list", err)
+		return nil, ErrUnknown
+	}
+	list.Name = name
+	return list, nil
+}
+
+// DeleteShoppingList deletes a shopping list with its items. Only the owner can delete it.
+func (s *shoppingListService) DeleteShoppingList(userID, listID uint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer recoverTx(tx)
+
+	if _, err := getOwnShoppingListWithTx(tx, userID, listID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err := tx.Where("shopping_list_id = ?", listID).Delete(&domain.ShoppingListItem{}).Error
+	if err == nil {
+		err = tx.Where("shopping_list_id = ?", listID).Delete(&domain.ShoppingListMember{}).Error
+	}
+	if err == nil {
+		err = tx.Delete(&domain.ShoppingList{}, listID).Error
+	}
+	if err != nil {
+		log.Println("error deleting shopping list", err)
+		tx.Rollback()
+		return ErrUnknown
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return ErrCommit
+	}
+	return nil
+}
+
+// AddItem adds an item by hand to a shopping list the user owns or has been shared.
+func (s *shoppingListService) AddItem(userID, listID uint, name, quantity, unit string) (*domain.ShoppingListItem, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrShoppingListItemNameRequired
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	if _, err := getShoppingListWithTx(tx, userID, listID); err != nil {
+		return nil, err
+	}
+
+	item := &domain.ShoppingListItem{
+		ShoppingListID: listID,
+		Name:           name,
+		Quantity:       strings.TrimSpace(quantity),
+		Unit:           strings.TrimSpace(unit),
+		Manual:         true,
+	}
+	item.Parse()
+
+	if err := tx.Create(item).Error; err != nil {
+		log.Println("error adding shopping list item", err)
+		return nil, ErrUnknown
+	}
+	touchShoppingListWithTx(tx, listID)
+	return item, nil
+}
+
+// UpdateItem changes an item on a shopping list the user owns or has been shared,
+// e.g. to check it off. Only the fields being changed are written, so members
+// editing different fields at the same time do not overwrite each other.
+func (s *shoppingListService) UpdateItem(userID, listID, itemID uint, update ShoppingListItemUpdate) (*domain.ShoppingListItem, error) {
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return nil, ErrShoppingListItemNameRequired
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	if _, err := getShoppingListWithTx(tx, userID, listID); err != nil {
+		return nil, err
+	}
+	item, err := getShoppingListItemWithTx(tx, listID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]any{}
+	if update.Name != nil {
+		item.Name = strings.TrimSpace(*update.Name)
+		changes["name"] = item.Name
+	}
+	if update.Checked != nil {
+		item.Checked = *update.Checked
+		changes["checked"] = item.Checked
+	}
+	if update.Quantity != nil || update.Unit != nil {
+		if update.Quantity != nil {
+			item.Quantity = strings.TrimSpace(*update.Quantity)
+		}
+		if update.Unit != nil {
+			item.Unit = strings.TrimSpace(*update.Unit)
+		}
+		item.Parse()
+		changes["quantity"] = item.Quantity
+		changes["unit"] = item.Unit
+		changes["amount"] = item.Amount
+		changes["amount_max"] = item.AmountMax
+		changes["canonical_unit"] = item.CanonicalUnit
+	}
+	if len(changes) == 0 {
+		return item, nil
+	}
+
+	err = tx.Model(&domain.ShoppingListItem{}).Where("id = ?", itemID).Updates(changes).Error
+	if err != nil {
+		log.Println("error updating shopping list item", err)
+		return nil, ErrUnknown
+	}
+	touchShoppingListWithTx(tx, listID)
+	return item, nil
+}
+
+// DeleteItem removes an item from a shopping list the user owns or has been shared.
+func (s *shoppingListService) DeleteItem(userID, listID, itemID uint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	if _, err := getShoppingListWithTx(tx, userID, listID); err != nil {
+		return err
+	}
+
+	res := tx.Delete(&domain.ShoppingListItem{}, "id = ? AND shopping_list_id = ?", itemID, listID)
+	if res.Error != nil {
+		log.Println("error deleting shopping list item", res.Error)
+		return ErrUnknown
+	}
+	if res.RowsAffected == 0 {
+		return ErrShoppingListItemNotFound
+	}
+	touchShoppingListWithTx(tx, listID)
+	return nil
+}
+
+// AddMember shares a shopping list with another user so they can edit it too.
+// Only the owner can share it, and sharing it twice is not an error.
+func (s *shoppingListService) AddMember(userID, listID uint, username string) (*domain.ShoppingList, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	if _, err := getOwnShoppingListWithTx(tx, userID, listID); err != nil {
+		return nil, err
+	}
+	member, err := getUserByNameWithTx(tx, username)
+	if err != nil {
+		return nil, err
+	}
+	if member.ID == userID {
+		return nil, ErrInvalidShoppingListMember
+	}
+
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.ShoppingListMember{ShoppingListID: listID, UserID: member.ID}).Error
+	if err != nil {
+		log.Println("error adding shopping list member", err)
+		return nil, ErrUnknown
+	}
+	return getShoppingListWithTx(tx, userID, listID)
+}
+
+// RemoveMember stops sharing a shopping list with a user. The owner can remove
+// anyone, and members can remove themselves to leave the list.
+func (s *shoppingListService) RemoveMember(userID, listID, memberID uint) error {
+	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	tx := s.db.WithContext(ctx)
+
+	list, err := getShoppingListWithTx(tx, userID, listID)
+	if err != nil {
+		return err
+	}
+	if list.UserID != userID && memberID != userID {
+		return ErrUnauthorized
+	}
+
+	res := tx.Delete(&domain.ShoppingListMember{}, "shopping_list_id = ? AND user_id = ?", listID, memberID)
+	if res.Error != nil {
+		log.Println("error removing shopping list member", res.Error)
+		return ErrUnknown
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// getShoppingListWithTx returns a shopping list with its items and members if the
+// user owns it or it has been shared with them. Lists the user cannot see are
+// reported as not found.
+func getShoppingListWithTx(tx *gorm.DB, userID, listID uint) (*domain.ShoppingList, error) {
+	var list domain.ShoppingList
+	err := tx.
+		Preload("Items", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("checked, id")
+		}).
+		Preload("Members", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("created_at")
+		}).
+		Preload("Members.User").
+		First(&list, listID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShoppingListNotFound
+		}
+		log.Println("error getting shopping list", err)
+		return nil, ErrUnknown
+	}
+	if !list.HasMember(userID) {
+		return nil, ErrShoppingListNotFound
+	}
+	return &list, nil
+}
+
+func getOwnShoppingListWithTx(tx *gorm.DB, userID, listID uint) (*domain.ShoppingList, error) {
+	list, err := getShoppingListWithTx(tx, userID, listID)
+	if err != nil {
+		return nil, err
+	}
+	if list.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+	return list, nil
+}
+
+func getShoppingListItemWithTx(tx *gorm.DB, listID, itemID uint) (*domain.ShoppingListItem, error) {
+	var item domain.ShoppingListItem
+	err := tx.Where("shopping_list_id = ?", listID).First(&item, itemID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShoppingListItemNotFound
+		}
+		log.Println("error getting shopping list item", err)
+		return nil, ErrUnknown
+	}
+	return &item, nil
+}
+
+// touchShoppingListWithTx marks a shopping list as changed so that members can
+// tell when to refresh it.
+func touchShoppingListWithTx(tx *gorm.DB, listID uint) {
+	err := tx.Model(&domain.ShoppingList{}).Where("id = ?", listID).Update("updated_at", time.Now()).Error
+	if err != nil {
+		log.Println("error touching shopping list", err)
+	}
+}
@@ -100,6 +100,16 @@ func (s *tagService) CreateTag(tag string) (*domain.Tag, error) {
 	}
 }
 
+// findOrCreateTagWithTx returns the tag with the given name, creating it in tx if it does not exist.
+func findOrCreateTagWithTx(tx *gorm.DB, tag string) (*domain.Tag, error) {
+	t := &domain.Tag{}
+	if err := tx.Where(domain.Tag{Tag: tag}).FirstOrCreate(t).Error; err != nil {
+		log.Println("error finding or creating tag", err)
+		return nil, ErrUnknown
+	}
+	return t, nil
+}
+
 func (s *tagService) DeleteTag(id uint) error {
 	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
 	defer cancel()
@@ -13,7 +13,7 @@ import (
 type UserService interface {
 	GetUserById(id uint) (*domain.User, error)
 	GetUserByUsername(name string) (*domain.User, error)
-	GetUsersRecipes(name string, page, limit int) ([]domain.Recipe, error)
+	GetUsersRecipes(name string, viewerID uint, page, limit int) ([]domain.Recipe, error)
 	GetUserFiles(name string, _, _ int) ([]domain.FileDto, error)
 }
 
@@ -104,7 +104,9 @@ func (s userService) GetUserByUsername(name string) (*domain.User, error) {
 	}
 }
 
-func (s userService) GetUsersRecipes(name string, page, limit int) ([]domain.Recipe, error) {
+// GetUsersRecipes returns a page of the user's recipes. Viewers other than the
+// user themselves only see public recipes.
+func (s userService) GetUsersRecipes(name string, viewerID uint, page, limit int) ([]domain.Recipe, error) {
 	ctx, cancel := context.WithTimeout(s.ctx, DEFAULT_TIMEOUT)
 	defer cancel()
 
@@ -128,6 +130,7 @@ func (s userService) GetUsersRecipes(name string, page, limit int) ([]domain.Rec
 			Preload(clause.Associations).
 			Joins("JOIN users ON users.id = recipes.user_id").
 			Where("users.username = ?", name).
+			Scopes(listedFor(viewerID)).
 			Find(&recipes).
 			Error
 
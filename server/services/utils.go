@@ -2,9 +2,13 @@ package services
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"strings"
 	"time"
+	"unicode"
 )
 
 const DEFAULT_TIMEOUT = 5 * time.Second
@@ -42,3 +46,26 @@ func recoverTx(tx *gorm.DB) {
 		tx.Rollback()
 	}
 }
+
+// slugify turns a name into a lower case, dash separated string safe for file names, e.g. "chickpea-curry".
+func slugify(name string) string {
+	slug := strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), "-")
+	if slug == "" {
+		return "recipe"
+	}
+	return slug
+}
+
+// hashToken hashes a random bearer token for storage. Tokens are long and random,
+// so unlike passwords they do not need a salt or a slow hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// escapeLike escapes the wildcards in s for use in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+)
+
+// GetRecipeVersions returns every version of a recipe, newest first.
+func (r *recipeService) GetRecipeVersions(viewerID, recipeID uint) ([]domain.RecipeVersion, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	if _, err := getVisibleRecipeWithTx(ctx, r.db, viewerID, recipeID, ""); err != nil {
+		return nil, err
+	}
+
+	var versions []domain.RecipeVersion
+	err := r.db.WithContext(ctx).
+		Where("recipe_id = ?", recipeID).
+		Order("version DESC").
+		Find(&versions).Error
+	if err != nil {
+		log.Println("error getting recipe versions", err)
+		return nil, ErrUnknown
+	}
+	return versions, nil
+}
+
+// GetRecipeVersion returns a single version of a recipe.
+func (r *recipeService) GetRecipeVersion(viewerID, recipeID uint, version int) (*domain.RecipeVersion, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	if _, err := getVisibleRecipeWithTx(ctx, r.db, viewerID, recipeID, ""); err != nil {
+		return nil, err
+	}
+
+	return getRecipeVersionWithTx(r.db.WithContext(ctx), recipeID, version)
+}
+
+// DiffRecipeVersions compares two versions of a recipe.
+func (r *recipeService) DiffRecipeVersions(viewerID, recipeID uint, from, to int) (*domain.RecipeDiff, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	if _, err := getVisibleRecipeWithTx(ctx, r.db, viewerID, recipeID, ""); err != nil {
+		return nil, err
+	}
+
+	fromVersion, err := getRecipeVersionWithTx(r.db.WithContext(ctx), recipeID, from)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, err := getRecipeVersionWithTx(r.db.WithContext(ctx), recipeID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := domain.DiffSnapshots(fromVersion.Snapshot, toVersion.Snapshot)
+	diff.From = from
+	diff.To = to
+	return &diff, nil
+}
+
+// RestoreRecipeVersion overwrites a recipe with one of its earlier versions.
+// The restore is itself recorded as a new version, so it can be undone.
+func (r *recipeService) RestoreRecipeVersion(userID, recipeID uint, version int) (*domain.Recipe, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+	ch := make(chan recipeVal)
+
+	go func() {
+		defer cancel()
+		tx := r.db.Begin()
+		defer recoverTx(tx)
+
+		recipe, err := getRecipeByIdWithTx(r.ctx, tx, recipeID)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{nil, err}
+			return
+		}
+
+		if err = doesUserOwnRecipe(userID, recipe.UserID); err != nil {
+			tx.Rollback()
+			ch <- recipeVal{nil, err}
+			return
+		}
+
+		v, err := getRecipeVersionWithTx(tx, recipeID, version)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{nil, err}
+			return
+		}
+
+		err = restoreSnapshotWithTx(tx, recipe, v.Snapshot)
+		if err != nil {
+			log.Println("error restoring recipe version", err)
+			tx.Rollback()
+			ch <- recipeVal{nil, ErrUnknown}
+			return
+		}
+
+		err = recipeChangedWithTx(r.ctx, tx, recipeID, userID, domain.VersionChangeRestore)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{nil, err}
+			return
+		}
+
+		restored, err := getRecipeByIdWithTx(r.ctx, tx, recipeID)
+		if err != nil {
+			tx.Rollback()
+			ch <- recipeVal{nil, err}
+			return
+		}
+
+		err = tx.Commit().Error
+		if err != nil {
+			log.Println("error committing transaction", err)
+			ch <- recipeVal{nil, ErrCommit}
+			return
+		}
+		ch <- recipeVal{restored, nil}
+	}()
+
+	select {
+	case v := <-ch:
+		return v.recipe, v.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, ErrTimeoutNoMessage
+	}
+}
+
+// restoreSnapshotWithTx replaces the recipe's fields, ingredients, instructions and tags with those in the snapshot.
+// Ingredients and instructions are updated in place, so that their IDs, and the
+// comments on instructions, are kept; only the ones the snapshot has more or
+// fewer of are created or deleted.
+func restoreSnapshotWithTx(tx *gorm.DB, recipe *domain.Recipe, snapshot domain.RecipeSnapshot) error {
+	restored := snapshot.Recipe()
+
+	err := tx.Model(&domain.Recipe{}).
+		Where("id = ?", recipe.ID).
+		Updates(map[string]any{
+			"name":        restored.Name,
+			"description": restored.Description,
+			"cook_time":   restored.CookTime,
+			"servings":    restored.Servings,
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	if err = restoreIngredientsWithTx(tx, recipe.ID, restored.Ingredients); err != nil {
+		return err
+	}
+	if err = restoreInstructionsWithTx(tx, recipe.ID, restored.Instructions); err != nil {
+		return err
+	}
+
+	tags := make([]*domain.Tag, len(restored.Tags))
+	for i, t := range restored.Tags {
+		tag := &domain.Tag{}
+		if err = tx.Where(domain.Tag{Tag: t.Tag}).FirstOrCreate(tag).Error; err != nil {
+			return err
+		}
+		tags[i] = tag
+	}
+	return tx.Model(recipe).Association("Tags").Replace(tags)
+}
+
+// restoreIngredientsWithTx makes the recipe's ingredients match restored, in order.
+func restoreIngredientsWithTx(tx *gorm.DB, recipeID uint, restored []domain.Ingredient) error {
+	var current []domain.Ingredient
+	if err := tx.Where("recipe_id = ?", recipeID).Order("id").Find(&current).Error; err != nil {
+		return err
+	}
+
+	for i := range restored {
+		restored[i].RecipeID = recipeID
+		restored[i].Parse()
+
+		if i >= len(current) {
+			if err := tx.Create(&restored[i]).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		ingredient := current[i]
+		if ingredient.Name == restored[i].Name && ingredient.Quantity == restored[i].Quantity && ingredient.Unit == restored[i].Unit {
+			continue
+		}
+		err := tx.Model(&domain.Ingredient{}).Where("id = ?", ingredient.ID).Updates(map[string]any{
+			"name":           restored[i].Name,
+			"quantity":       restored[i].Quantity,
+			"unit":           restored[i].Unit,
+			"amount":         restored[i].Amount,
+			"amount_max":     restored[i].AmountMax,
+			"canonical_unit": restored[i].CanonicalUnit,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(current) > len(restored) {
+		extra := make([]uint, 0, len(current)-len(restored))
+		for _, ingredient := range current[len(restored):] {
+			extra = append(extra, ingredient.ID)
+		}
+		return tx.Delete(&domain.Ingredient{}, extra).Error
+	}
+	return nil
+}
+
+// restoreInstructionsWithTx makes the recipe's instructions match restored, step by step.
+func restoreInstructionsWithTx(tx *gorm.DB, recipeID uint, restored []domain.Instruction) error {
+	var current []domain.Instruction
+	if err := tx.Where("recipe_id = ?", recipeID).Order("step").Find(&current).Error; err != nil {
+		return err
+	}
+
+	for i := range restored {
+		restored[i].RecipeID = recipeID
+
+		if i >= len(current) {
+			if err := tx.Create(&restored[i]).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		instruction := current[i]
+		if instruction.Step == restored[i].Step && instruction.Contents == restored[i].Contents {
+			continue
+		}
+		err := tx.Model(&domain.Instruction{}).Where("id = ?", instruction.ID).Updates(map[string]any{
+			"step":     restored[i].Step,
+			"contents": restored[i].Contents,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(current) > len(restored) {
+		extra := make([]uint, 0, len(current)-len(restored))
+		for _, instruction := range current[len(restored):] {
+			extra = append(extra, instruction.ID)
+		}
+		if err := moveCommentsToRecipeWithTx(tx, extra); err != nil {
+			return err
+		}
+		return tx.Delete(&domain.Instruction{}, extra).Error
+	}
+	return nil
+}
+
+func getRecipeVersionWithTx(tx *gorm.DB, recipeID uint, version int) (*domain.RecipeVersion, error) {
+	var v domain.RecipeVersion
+	err := tx.Where("recipe_id = ? AND version = ?", recipeID, version).First(&v).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVersionNotFound
+		}
+		log.Println("error getting recipe version", err)
+		return nil, ErrUnknown
+	}
+	return &v, nil
+}
+
+// recipeChangedWithTx must be called inside the transaction of every change to a
+// recipe. It refreshes the search index and records a new version.
+func recipeChangedWithTx(ctx context.Context, tx *gorm.DB, recipeID, userID uint, change string) error {
+	if err := indexRecipeWithTx(ctx, tx, recipeID); err != nil {
+		return err
+	}
+	return recordVersionWithTx(ctx, tx, recipeID, userID, change)
+}
+
+// recordVersionWithTx snapshots the recipe as it is now in tx and saves it as the next version.
+func recordVersionWithTx(ctx context.Context, tx *gorm.DB, recipeID, userID uint, change string) error {
+	recipe, err := getRecipeByIdWithTx(ctx, tx, recipeID)
+	if err != nil {
+		return err
+	}
+
+	var latest int
+	err = tx.Model(&domain.RecipeVersion{}).
+		Where("recipe_id = ?", recipeID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&latest).Error
+	if err != nil {
+		log.Println("error getting latest recipe version", err)
+		return ErrUnknown
+	}
+
+	err = tx.Create(&domain.RecipeVersion{
+		RecipeID: recipeID,
+		Version:  latest + 1,
+		UserID:   userID,
+		Change:   change,
+		Snapshot: recipe.Snapshot(),
+	}).Error
+	if err != nil {
+		log.Println("error recording recipe version", err)
+		return ErrUnknown
+	}
+	return nil
+}
+
+// RecordMissingVersions records an initial version for every recipe that has no
+// history yet, so that the first edit to it can be undone.
+func RecordMissingVersions(db *gorm.DB) error {
+	var recipes []domain.Recipe
+	err := db.Select("id", "user_id").
+		Where("NOT EXISTS (SELECT 1 FROM recipe_versions v WHERE v.recipe_id = recipes.id)").
+		Find(&recipes).Error
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for _, recipe := range recipes {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return recordVersionWithTx(ctx, tx, recipe.ID, recipe.UserID, domain.VersionChangeInitial)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(recipes) > 0 {
+		log.Printf("recorded initial versions for %d recipes", len(recipes))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jacksonopp/go-recipe/domain"
+	"testing"
+)
+
+func TestRestoreInstructionsWithTx(t *testing.T) {
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "instructions" WHERE recipe_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "step", "contents", "recipe_id"}).
+			AddRow(10, 1, "Boil water", 1).
+			AddRow(11, 2, "Add pasta", 1).
+			AddRow(12, 3, "Drain", 1))
+	// the unchanged first step is left alone and the second is updated, keeping its ID
+	mock.ExpectExec(`UPDATE "instructions" SET "contents"=\$1,"step"=\$2,"updated_at"=\$3 WHERE id = \$4`).
+		WithArgs("Add rice", 2, sqlmock.AnyArg(), 11).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// only the step the snapshot does not have is deleted, and its comments kept on the recipe
+	mock.ExpectExec(`UPDATE "comments" SET "instruction_id"=\$1 WHERE instruction_id IN \(\$2\)`).
+		WithArgs(nil, 12).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE "instructions" SET "deleted_at"=\$1 WHERE "instructions"."id" = \$2`).
+		WithArgs(sqlmock.AnyArg(), 12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	restored := []domain.Instruction{{Step: 1, Contents: "Boil water"}, {Step: 2, Contents: "Add rice"}}
+	if err = restoreInstructionsWithTx(db.Begin(), 1, restored); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRestoreIngredientsWithTx(t *testing.T) {
+	db, mock, err := mockDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "ingredients" WHERE recipe_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "quantity", "unit", "recipe_id"}).
+			AddRow(20, "salt", "1", "tsp", 1))
+	// the existing ingredient is kept and only the new one is created
+	mock.ExpectQuery(`INSERT INTO "ingredients"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(21))
+
+	restored := []domain.Ingredient{
+		{Name: "salt", Quantity: "1", Unit: "tsp"},
+		{Name: "pasta", Quantity: "500", Unit: "g"},
+	}
+	if err = restoreIngredientsWithTx(db.Begin(), 1, restored); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jacksonopp/go-recipe/domain"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// SHARE_TOKEN_LENGTH is the length of the random tokens in recipe share links.
+const SHARE_TOKEN_LENGTH = 32
+
+// listedFor limits a recipes query to those that should be listed for the viewer:
+// every published public recipe and the viewer's own.
+func listedFor(viewerID uint) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(
+			"(recipes.user_id = ? OR (recipes.visibility = ? AND recipes.status = ?))",
+			viewerID, domain.VisibilityPublic, domain.RecipeStatusPublished,
+		)
+	}
+}
+
+// getVisibleRecipeWithTx returns the recipe if the viewer may open it, either
+// because of its visibility or because shareToken is an active share link for it.
+// Recipes the viewer may not see are reported as not found.
+func getVisibleRecipeWithTx(ctx context.Context, tx *gorm.DB, viewerID, recipeID uint, shareToken string) (*domain.Recipe, error) {
+	recipe, err := getRecipeByIdWithTx(ctx, tx, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	if recipe.VisibleTo(viewerID) {
+		return recipe, nil
+	}
+
+	if shareToken != "" {
+		var share domain.RecipeShare
+		err = tx.Where("recipe_id = ? AND token_hash = ?", recipeID, hashToken(shareToken)).First(&share).Error
+		if err == nil && share.Active(time.Now()) {
+			return recipe, nil
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("error getting recipe share", err)
+			return nil, ErrUnknown
+		}
+	}
+
+	return nil, ErrRecipeNotFound
+}
+
+// GetVisibleRecipe returns the recipe with the given ID if the viewer may see it.
+// viewerID is 0 for anonymous viewers and shareToken may be empty.
+func (r *recipeService) GetVisibleRecipe(viewerID, recipeID uint, shareToken string) (*domain.Recipe, error) {
+	return getVisibleRecipeWithTx(r.ctx, r.db, viewerID, recipeID, shareToken)
+}
+
+// SetVisibility changes who can see a recipe.
+func (r *recipeService) SetVisibility(userID, recipeID uint, visibility string) (*domain.Recipe, error) {
+	if !domain.IsValidVisibility(visibility) {
+		return nil, ErrInvalidVisibility
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	recipe, err := getRecipeByIdWithTx(ctx, r.db, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	if err = doesUserOwnRecipe(userID, recipe.UserID); err != nil {
+		return nil, err
+	}
+
+	err = r.db.WithContext(ctx).Model(recipe).Update("visibility", visibility).Error
+	if err != nil {
+		log.Println("error updating recipe visibility", err)
+		return nil, ErrUnknown
+	}
+	recipe.Visibility = visibility
+	return recipe, nil
+}
+
+// CreateShare creates a share link for a recipe and returns it with its token.
+// The token is not stored and cannot be retrieved again.
+func (r *recipeService) CreateShare(userID, recipeID uint, expiresAt *time.Time) (*domain.RecipeShare, string, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	recipe, err := getRecipeByIdWithTx(ctx, r.db, recipeID)
+	if err != nil {
+		return nil, "", err
+	}
+	if err = doesUserOwnRecipe(userID, recipe.UserID); err != nil {
+		return nil, "", err
+	}
+
+	token, err := genRandStr(SHARE_TOKEN_LENGTH)
+	if err != nil {
+		log.Println("error generating share token", err)
+		return nil, "", ErrUnknown
+	}
+
+	share := &domain.RecipeShare{
+		RecipeID:  recipeID,
+		TokenHash: hashToken(token),
+		ExpiresAt: expiresAt,
+	}
+	err = r.db.WithContext(ctx).Create(share).Error
+	if err != nil {
+		log.Println("error creating recipe share", err)
+		return nil, "", ErrUnknown
+	}
+	return share, token, nil
+}
+
+// GetShares returns every share link created for a recipe, newest first.
+func (r *recipeService) GetShares(userID, recipeID uint) ([]domain.RecipeShare, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	recipe, err := getRecipeByIdWithTx(ctx, r.db, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	if err = doesUserOwnRecipe(userID, recipe.UserID); err != nil {
+		return nil, err
+	}
+
+	var shares []domain.RecipeShare
+	err = r.db.WithContext(ctx).Where("recipe_id = ?", recipeID).Order("id DESC").Find(&shares).Error
+	if err != nil {
+		log.Println("error getting recipe shares", err)
+		return nil, ErrUnknown
+	}
+	return shares, nil
+}
+
+// RevokeShare stops a share link from granting access to a recipe.
+func (r *recipeService) RevokeShare(userID, recipeID, shareID uint) error {
+	ctx, cancel := context.WithTimeout(r.ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	recipe, err := getRecipeByIdWithTx(ctx, r.db, recipeID)
+	if err != nil {
+		return err
+	}
+	if err = doesUserOwnRecipe(userID, recipe.UserID); err != nil {
+		return err
+	}
+
+	result := r.db.WithContext(ctx).
+		Model(&domain.RecipeShare{}).
+		Where("id = ? AND recipe_id = ? AND revoked_at IS NULL", shareID, recipeID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Println("error revoking recipe share", result.Error)
+		return ErrUnknown
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}